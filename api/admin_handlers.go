@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+
+	"triple-s/storage"
+	"triple-s/storage/buckets"
+)
+
+// maxQuotaSize bounds the body of a quota document.
+const maxQuotaSize = 64 << 10
+
+// ErrInvalidQuota rejects quota limits below zero.
+var ErrInvalidQuota = &storage.Error{Code: "InvalidArgument", Message: "Quota limits must not be negative.", StatusCode: http.StatusBadRequest}
+
+// handleListBucketQuotas returns the quota and usage of every bucket.
+func (h *Handler) handleListBucketQuotas(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	result, err := buckets.ListBucketQuotas(h.store)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(result)
+}
+
+// handleGetBucketQuota returns the quota and usage of a bucket.
+func (h *Handler) handleGetBucketQuota(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	quota, err := buckets.GetBucketQuota(h.store, req.Bucket)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(quota)
+}
+
+// handlePutBucketQuota sets the quota of a bucket. Writes already stored
+// stay even when they exceed it; later ones that would grow the bucket
+// further are refused.
+func (h *Handler) handlePutBucketQuota(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxQuotaSize+1))
+	if err != nil || len(body) > maxQuotaSize {
+		WriteError(w, r, ErrMalformedXML)
+		return
+	}
+	var config buckets.BucketQuota
+	if err := xml.Unmarshal(body, &config); err != nil {
+		WriteError(w, r, ErrMalformedXML)
+		return
+	}
+	if config.MaxSizeBytes < 0 || config.MaxObjects < 0 {
+		WriteError(w, r, ErrInvalidQuota)
+		return
+	}
+
+	quota := storage.Quota{MaxBytes: config.MaxSizeBytes, MaxObjects: config.MaxObjects}
+	if err := buckets.SetBucketQuota(h.store, req.Bucket, quota); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	h.handleGetBucketQuota(w, r, req)
+}
+
+// handleDeleteBucketQuota removes the quota of a bucket.
+func (h *Handler) handleDeleteBucketQuota(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	if err := buckets.SetBucketQuota(h.store, req.Bucket, storage.Quota{}); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -11,35 +11,17 @@ import (
 )
 
 // handlePutBucket creates a new bucket if it doesn't already exist.
-func handlePutBucket(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	bucketName := r.URL.Path[1:]
-	if bucketName == "" {
-		http.Error(w, "Bucket name is required", http.StatusBadRequest)
-		return
-	}
+func (h *Handler) handlePutBucket(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	bucketName := req.Bucket
 
 	if !utils.ValidateBucketName(bucketName) {
-		http.Error(w, "400 Bad Request: Invalid bucket name", http.StatusBadRequest)
-		return
-	}
-
-	exists, err := storage.BucketExists(bucketName)
-	if err != nil {
-		http.Error(w, "500 Internal Server Error: Error checking bucket existence", http.StatusInternalServerError)
-		return
-	}
-	if exists {
-		http.Error(w, "409 Conflict: Bucket already exists", http.StatusConflict)
+		WriteError(w, r, storage.ErrInvalidBucketName)
 		return
 	}
 
-	if err := buckets.CreateBucketDirectory(bucketName); err != nil {
-		http.Error(w, "500 Internal Server Error: Error creating bucket", http.StatusInternalServerError)
+	// An existing bucket is reported as BucketAlreadyOwnedByYou
+	if err := buckets.CreateBucketDirectory(h.store, bucketName); err != nil {
+		WriteError(w, r, err)
 		return
 	}
 
@@ -50,75 +32,110 @@ func handlePutBucket(w http.ResponseWriter, r *http.Request) {
 }
 
 // handleGetBuckets lists all available buckets.
-func handleGetBuckets(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	bucketData, err := buckets.ListBuckets()
+func (h *Handler) handleGetBuckets(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	bucketData, err := buckets.ListBuckets(h.store)
 	if err != nil {
-		fmt.Printf("Error retrieving bucket list: %v\n", err)
-		http.Error(w, "500 Internal Server Error: Error retrieving bucket list", http.StatusInternalServerError)
+		WriteError(w, r, err)
 		return
 	}
 
-	var bucketList buckets.BucketList
-	for _, data := range bucketData {
-		bucketList.Buckets = append(bucketList.Buckets, buckets.Bucket{
-			Name:             data.Name,
-			CreationTime:     data.CreationTime,
-			LastModifiedTime: data.LastModifiedTime,
-		})
+	var bucketList interface{}
+	if h.legacyXML {
+		var legacy buckets.BucketList
+		for _, data := range bucketData {
+			legacy.Buckets = append(legacy.Buckets, buckets.Bucket{
+				Name:             data.Name,
+				CreationTime:     data.CreationTime,
+				LastModifiedTime: data.LastModifiedTime,
+			})
+		}
+		bucketList = legacy
+	} else {
+		result := buckets.ListAllMyBucketsResult{Xmlns: storage.XMLNamespace, Owner: buckets.DefaultOwner}
+		for _, data := range bucketData {
+			result.Buckets = append(result.Buckets, buckets.BucketEntry{Name: data.Name, CreationDate: data.CreationTime})
+		}
+		bucketList = result
 	}
 
 	w.Header().Set("Content-Type", "application/xml")
 	w.WriteHeader(http.StatusOK)
 	if err := xml.NewEncoder(w).Encode(bucketList); err != nil {
-		http.Error(w, "500 Internal Server Error: Unable to encode response", http.StatusInternalServerError)
+		fmt.Printf("Error encoding bucket list: %v\n", err)
 	}
 }
 
 // handleDeleteBucket removes a bucket if it exists and is empty.
-func handleDeleteBucket(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodDelete {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+func (h *Handler) handleDeleteBucket(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	bucketName := req.Bucket
+
+	// Missing and non-empty buckets are reported as NoSuchBucket and BucketNotEmpty
+	if err := buckets.DeleteBucketDirectory(h.store, bucketName); err != nil {
+		WriteError(w, r, err)
 		return
 	}
 
-	bucketName := r.URL.Path[1:]
-	if bucketName == "" {
-		http.Error(w, "Bucket name is required", http.StatusBadRequest)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePutBucketVersioning enables or suspends versioning on a bucket.
+func (h *Handler) handlePutBucketVersioning(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	bucketName := req.Bucket
+
+	var config buckets.VersioningConfiguration
+	if err := xml.NewDecoder(r.Body).Decode(&config); err != nil {
+		WriteError(w, r, ErrMalformedXML)
 		return
 	}
-
-	exists, err := storage.BucketExists(bucketName)
-	if err != nil {
-		fmt.Printf("Error checking bucket existence: %v\n", err)
-		http.Error(w, "500 Internal Server Error: Error checking bucket existence", http.StatusInternalServerError)
+	if config.Status != storage.VersioningEnabled && config.Status != storage.VersioningSuspended {
+		WriteError(w, r, ErrIllegalVersioning)
 		return
 	}
 
-	if !exists {
-		w.WriteHeader(http.StatusNotFound)
-		xml.NewEncoder(w).Encode(storage.ErrorResponse{Message: "Bucket not found"})
+	if err := buckets.SetBucketVersioning(h.store, bucketName, config.Status); err != nil {
+		WriteError(w, r, err)
 		return
 	}
 
-	if !storage.IsBucketEmpty(bucketName) {
-		w.WriteHeader(http.StatusConflict)
-		xml.NewEncoder(w).Encode(storage.ErrorResponse{Message: "Bucket is not empty"})
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleGetBucketVersioning reports the versioning state of a bucket.
+func (h *Handler) handleGetBucketVersioning(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	bucketName := req.Bucket
+
+	exists, err := h.store.BucketExists(bucketName)
+	if err == nil && !exists {
+		err = storage.ErrNoSuchBucket
+	}
+	if err != nil {
+		WriteError(w, r, err)
 		return
 	}
 
-	if err := buckets.DeleteBucketDirectory(bucketName); err != nil {
-		fmt.Printf("Error deleting bucket: %v\n", err)
-		http.Error(w, "500 Internal Server Error: Error deleting bucket", http.StatusInternalServerError)
+	status, err := h.store.BucketVersioning(bucketName)
+	if err != nil {
+		WriteError(w, r, err)
 		return
 	}
 
-	response := buckets.Bucket{Name: bucketName, Status: "Deleted"}
 	w.Header().Set("Content-Type", "application/xml")
-	w.WriteHeader(http.StatusNoContent)
-	xml.NewEncoder(w).Encode(response)
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(buckets.VersioningConfiguration{Status: status})
+}
+
+// handleHeadBucket reports whether a bucket exists, without a body.
+func (h *Handler) handleHeadBucket(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	bucketName := req.Bucket
+
+	exists, err := h.store.BucketExists(bucketName)
+	if err == nil && !exists {
+		err = storage.ErrNoSuchBucket
+	}
+	if err != nil {
+		WriteError(w, r, err) // HEAD responses carry no body
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
 }
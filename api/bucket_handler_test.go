@@ -0,0 +1,140 @@
+package api
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"triple-s/storage"
+)
+
+// The response documents as the AWS SDKs read them.
+type sdkListAllMyBuckets struct {
+	XMLName xml.Name
+	Owner   struct {
+		ID          string
+		DisplayName string
+	}
+	Buckets []struct {
+		Name         string
+		CreationDate time.Time
+	} `xml:"Buckets>Bucket"`
+}
+
+type sdkListBucketResult struct {
+	XMLName     xml.Name
+	Name        string
+	Prefix      string
+	KeyCount    int
+	MaxKeys     int
+	IsTruncated bool
+	Contents    []struct {
+		Key          string
+		LastModified time.Time
+		ETag         string
+		Size         int64
+		StorageClass string
+	}
+}
+
+func TestListAllMyBuckets(t *testing.T) {
+	ts := newTestServer(t)
+	for _, name := range []string{"beta", "alpha"} {
+		mustDo(t, ts, http.MethodPut, "/"+name, "", nil)
+	}
+
+	resp, body := mustDo(t, ts, http.MethodGet, "/", "", nil)
+	if got := resp.Header.Get("Content-Type"); got != "application/xml" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	var result sdkListAllMyBuckets
+	if err := xml.Unmarshal([]byte(body), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.XMLName != (xml.Name{Space: storage.XMLNamespace, Local: "ListAllMyBucketsResult"}) {
+		t.Errorf("root element %v", result.XMLName)
+	}
+	if result.Owner.ID == "" {
+		t.Error("no Owner ID")
+	}
+	if len(result.Buckets) != 2 || result.Buckets[0].Name != "alpha" || result.Buckets[1].Name != "beta" {
+		t.Fatalf("buckets in %s", body)
+	}
+	for _, bucket := range result.Buckets {
+		if time.Since(bucket.CreationDate) > time.Minute {
+			t.Errorf("%s: CreationDate %v", bucket.Name, bucket.CreationDate)
+		}
+	}
+}
+
+func TestListBucketResult(t *testing.T) {
+	ts := newTestServer(t)
+	mustDo(t, ts, http.MethodPut, "/bucket", "", nil)
+	put, _ := mustDo(t, ts, http.MethodPut, "/bucket/dir/key", "hello", nil)
+
+	for _, query := range []string{"", "?list-type=2"} {
+		_, body := mustDo(t, ts, http.MethodGet, "/bucket"+query, "", nil)
+		var result sdkListBucketResult
+		if err := xml.Unmarshal([]byte(body), &result); err != nil {
+			t.Fatal(err)
+		}
+		if result.XMLName != (xml.Name{Space: storage.XMLNamespace, Local: "ListBucketResult"}) {
+			t.Errorf("%q: root element %v", query, result.XMLName)
+		}
+		if result.Name != "bucket" || result.MaxKeys != 1000 || result.IsTruncated {
+			t.Errorf("%q: Name %q, MaxKeys %d, IsTruncated %v", query, result.Name, result.MaxKeys, result.IsTruncated)
+		}
+		if len(result.Contents) != 1 {
+			t.Fatalf("%q: contents in %s", query, body)
+		}
+		object := result.Contents[0]
+		if object.Key != "dir/key" || object.Size != 5 || object.ETag != put.Header.Get("ETag") || object.StorageClass != "STANDARD" || object.LastModified.IsZero() {
+			t.Errorf("%q: object %+v", query, object)
+		}
+	}
+	_, body := mustDo(t, ts, http.MethodGet, "/bucket?list-type=2", "", nil)
+	if !strings.Contains(body, "<KeyCount>1</KeyCount>") {
+		t.Errorf("ListObjectsV2 without KeyCount: %s", body)
+	}
+}
+
+func TestLegacyXML(t *testing.T) {
+	ts := httptest.NewServer(NewHandler(newTestStore(t), nil, true))
+	t.Cleanup(ts.Close)
+	mustDo(t, ts, http.MethodPut, "/bucket", "", nil)
+	mustDo(t, ts, http.MethodPut, "/bucket/key", "hello", map[string]string{"Content-Type": "text/plain"})
+
+	_, body := mustDo(t, ts, http.MethodGet, "/", "", nil)
+	var bucketList struct {
+		XMLName xml.Name `xml:"BucketList"`
+		Buckets []struct {
+			Name string
+		} `xml:"Bucket"`
+	}
+	if err := xml.Unmarshal([]byte(body), &bucketList); err != nil || len(bucketList.Buckets) != 1 || bucketList.Buckets[0].Name != "bucket" {
+		t.Errorf("legacy bucket list %s: %v", body, err)
+	}
+
+	_, body = mustDo(t, ts, http.MethodGet, "/bucket", "", nil)
+	var objectList struct {
+		XMLName xml.Name `xml:"ObjectList"`
+		Objects []struct {
+			Key         string `xml:"key"`
+			ContentType string `xml:"contentType"`
+			Size        string `xml:"size"`
+		} `xml:"Object"`
+	}
+	if err := xml.Unmarshal([]byte(body), &objectList); err != nil || len(objectList.Objects) != 1 ||
+		objectList.Objects[0].Key != "key" || objectList.Objects[0].ContentType != "text/plain" || objectList.Objects[0].Size != "5" {
+		t.Errorf("legacy object list %s: %v", body, err)
+	}
+
+	// ListObjectsV2 has no legacy form
+	_, body = mustDo(t, ts, http.MethodGet, "/bucket?list-type=2", "", nil)
+	if !strings.Contains(body, "<ListBucketResult") {
+		t.Errorf("ListObjectsV2 with legacy XML: %s", body)
+	}
+}
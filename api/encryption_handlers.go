@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/xml"
+	"net/http"
+
+	"triple-s/storage"
+	"triple-s/storage/buckets"
+	"triple-s/storage/objects"
+)
+
+var ErrNoSuchEncryptionConfiguration = &storage.Error{Code: "ServerSideEncryptionConfigurationNotFoundError", Message: "The server side encryption configuration was not found.", StatusCode: http.StatusNotFound}
+
+// handlePutBucketEncryption sets the default encryption of a bucket. Only
+// SSE-S3 is supported, and only when the server has a master key.
+func (h *Handler) handlePutBucketEncryption(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	var config buckets.ServerSideEncryptionConfiguration
+	if err := xml.NewDecoder(r.Body).Decode(&config); err != nil {
+		WriteError(w, r, ErrMalformedXML)
+		return
+	}
+	if len(config.Rules) != 1 || config.Rules[0].ApplyServerSideEncryptionByDefault == nil {
+		WriteError(w, r, ErrMalformedXML)
+		return
+	}
+	if config.Rules[0].ApplyServerSideEncryptionByDefault.SSEAlgorithm != objects.SSEAlgorithm {
+		WriteError(w, r, objects.ErrInvalidEncryptionAlgorithm)
+		return
+	}
+	if h.store.MasterKey == nil {
+		WriteError(w, r, objects.ErrNoMasterKey)
+		return
+	}
+
+	if err := buckets.SetBucketEncryption(h.store, req.Bucket, objects.SSEAlgorithm); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleGetBucketEncryption returns the default encryption of a bucket.
+func (h *Handler) handleGetBucketEncryption(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	exists, err := h.store.BucketExists(req.Bucket)
+	if err == nil && !exists {
+		err = storage.ErrNoSuchBucket
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	algorithm, err := h.store.BucketEncryption(req.Bucket)
+	if err == nil && algorithm == "" {
+		err = ErrNoSuchEncryptionConfiguration
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	response := buckets.ServerSideEncryptionConfiguration{
+		Xmlns: storage.XMLNamespace,
+		Rules: []buckets.ServerSideEncryption{{
+			ApplyServerSideEncryptionByDefault: &buckets.EncryptionByDefault{SSEAlgorithm: algorithm},
+		}},
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(response)
+}
+
+// handleDeleteBucketEncryption stops encrypting the new objects of a bucket by
+// default. Objects already stored stay encrypted.
+func (h *Handler) handleDeleteBucketEncryption(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	if err := buckets.SetBucketEncryption(h.store, req.Bucket, ""); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"triple-s/auth"
+	"triple-s/storage"
+)
+
+// Errors of malformed requests, found before they reach the storage layer.
+var (
+	ErrInvalidURI         = &storage.Error{Code: "InvalidURI", Message: "Couldn't parse the specified URI.", StatusCode: http.StatusBadRequest}
+	ErrMethodNotAllowed   = &storage.Error{Code: "MethodNotAllowed", Message: "The specified method is not allowed against this resource.", StatusCode: http.StatusMethodNotAllowed}
+	ErrMalformedXML       = &storage.Error{Code: "MalformedXML", Message: "The XML you provided was not well-formed or did not validate against our published schema.", StatusCode: http.StatusBadRequest}
+	ErrInvalidObjectKey   = &storage.Error{Code: "InvalidArgument", Message: "The specified object key is not valid.", StatusCode: http.StatusBadRequest}
+	ErrInvalidPartNumber  = &storage.Error{Code: "InvalidArgument", Message: "Part number must be an integer between 1 and 10000, inclusive.", StatusCode: http.StatusBadRequest}
+	ErrInvalidMaxKeys     = &storage.Error{Code: "InvalidArgument", Message: "Provided max-keys not an integer or within integer range.", StatusCode: http.StatusBadRequest}
+	ErrIllegalVersioning  = &storage.Error{Code: "IllegalVersioningConfigurationException", Message: "The versioning configuration specified in the request is invalid.", StatusCode: http.StatusBadRequest}
+	ErrNotImplemented     = &storage.Error{Code: "NotImplemented", Message: "A header or query you provided implies functionality that is not implemented.", StatusCode: http.StatusNotImplemented}
+	ErrServiceUnavailable = &storage.Error{Code: "ServiceUnavailable", Message: "The server is shutting down.", StatusCode: http.StatusServiceUnavailable}
+)
+
+// setRequestID gives the response an x-amz-request-id header, unless it has
+// one already, and returns the ID.
+func setRequestID(w http.ResponseWriter) string {
+	if id := w.Header().Get("x-amz-request-id"); id != "" {
+		return id
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	id := strings.ToUpper(hex.EncodeToString(b))
+	w.Header().Set("x-amz-request-id", id)
+	return id
+}
+
+// WriteError reports err as an S3 error document. Errors without an S3 code
+// are logged and reported as InternalError, so no internal detail leaks.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	var s3Err *storage.Error
+	var authErr *auth.Error
+	switch {
+	case errors.As(err, &s3Err):
+	case errors.As(err, &authErr):
+		s3Err = &storage.Error{Code: authErr.Code, Message: authErr.Message, StatusCode: authErr.StatusCode}
+	default:
+		operation := r.Method
+		if info := RequestInfoFrom(r.Context()); info != nil && info.Operation != "" {
+			operation = info.Operation
+		}
+		fmt.Printf("Error handling %s %s: %v\n", operation, r.URL.Path, err)
+		s3Err = storage.ErrInternalError
+	}
+
+	requestID := setRequestID(w)
+	if s3Err.StatusCode == http.StatusNotModified {
+		w.WriteHeader(s3Err.StatusCode)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(s3Err.StatusCode)
+	xml.NewEncoder(w).Encode(storage.ErrorResponse{
+		Code:      s3Err.Code,
+		Message:   s3Err.Message,
+		Resource:  r.URL.Path,
+		RequestID: requestID,
+	})
+}
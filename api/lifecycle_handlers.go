@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+
+	"triple-s/storage"
+	"triple-s/storage/buckets"
+	"triple-s/storage/lifecycle"
+)
+
+// maxLifecycleSize bounds the body of a lifecycle configuration.
+const maxLifecycleSize = 1 << 20
+
+// handlePutBucketLifecycle replaces the lifecycle rules of a bucket.
+func (h *Handler) handlePutBucketLifecycle(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxLifecycleSize+1))
+	if err != nil || len(body) > maxLifecycleSize {
+		WriteError(w, r, ErrMalformedXML)
+		return
+	}
+	config, err := lifecycle.Parse(body)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	config.Xmlns = storage.XMLNamespace
+	stored, err := xml.Marshal(config)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if err := buckets.SetBucketLifecycle(h.store, req.Bucket, string(stored)); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleGetBucketLifecycle returns the lifecycle rules of a bucket.
+func (h *Handler) handleGetBucketLifecycle(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	exists, err := h.store.BucketExists(req.Bucket)
+	if err == nil && !exists {
+		err = storage.ErrNoSuchBucket
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	config, err := h.store.BucketLifecycle(req.Bucket)
+	if err == nil && config == "" {
+		err = lifecycle.ErrNoSuchLifecycleConfiguration
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, config)
+}
+
+// handleDeleteBucketLifecycle removes the lifecycle rules of a bucket.
+func (h *Handler) handleDeleteBucketLifecycle(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	if err := buckets.SetBucketLifecycle(h.store, req.Bucket, ""); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
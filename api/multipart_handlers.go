@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strconv"
+
+	"triple-s/storage/objects"
+	"triple-s/utils"
+)
+
+// handleInitiateMultipartUpload starts a multipart upload for an object.
+func (h *Handler) handleInitiateMultipartUpload(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	bucketName, objectKey := req.Bucket, req.Key
+	if !utils.ValidateObjectKey(objectKey) {
+		WriteError(w, r, ErrInvalidObjectKey)
+		return
+	}
+
+	uploadID, err := objects.InitiateUpload(h.store, bucketName, objectKey, w, r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	response := objects.InitiateMultipartUploadResult{Bucket: bucketName, Key: objectKey, UploadID: uploadID}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(response)
+}
+
+// handleUploadPart stores one part of a multipart upload.
+func (h *Handler) handleUploadPart(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	bucketName, objectKey := req.Bucket, req.Key
+
+	query := r.URL.Query()
+	partNumber, err := strconv.Atoi(query.Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > objects.MaxPartNumber {
+		WriteError(w, r, ErrInvalidPartNumber)
+		return
+	}
+
+	etag, err := objects.UploadPart(h.store, bucketName, objectKey, query.Get("uploadId"), partNumber, w, r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", `"`+etag+`"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleCompleteMultipartUpload joins the uploaded parts into the final object.
+func (h *Handler) handleCompleteMultipartUpload(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	bucketName, objectKey := req.Bucket, req.Key
+
+	var request objects.CompleteMultipartUpload
+	if err := xml.NewDecoder(r.Body).Decode(&request); err != nil {
+		WriteError(w, r, ErrMalformedXML)
+		return
+	}
+
+	etag, versionID, err := objects.CompleteUpload(h.store, bucketName, objectKey, r.URL.Query().Get("uploadId"), request.Parts, w, r)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if versionID != "" {
+		w.Header().Set("x-amz-version-id", versionID)
+	}
+
+	response := objects.CompleteMultipartUploadResult{
+		Location: "/" + bucketName + "/" + objectKey,
+		Bucket:   bucketName,
+		Key:      objectKey,
+		ETag:     `"` + etag + `"`,
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(response)
+}
+
+// handleAbortMultipartUpload discards a multipart upload and its parts.
+func (h *Handler) handleAbortMultipartUpload(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	bucketName, objectKey := req.Bucket, req.Key
+
+	if err := objects.AbortUpload(h.store, bucketName, objectKey, r.URL.Query().Get("uploadId")); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListParts lists the parts uploaded so far for a multipart upload.
+func (h *Handler) handleListParts(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	bucketName, objectKey := req.Bucket, req.Key
+
+	result, err := objects.ListParts(h.store, bucketName, objectKey, r.URL.Query().Get("uploadId"))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(result)
+}
+
+// handleListMultipartUploads lists the multipart uploads in progress in a bucket.
+func (h *Handler) handleListMultipartUploads(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	bucketName := req.Bucket
+
+	result, err := objects.ListUploads(h.store, bucketName)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(result)
+}
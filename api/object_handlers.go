@@ -1,84 +1,143 @@
 package api
 
 import (
+	"encoding/xml"
 	"net/http"
-	"strings"
+	"strconv"
 
 	"triple-s/storage/objects"
 	"triple-s/utils"
 )
 
-func handlePutObject(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+// handlePutObject stores an object, or copies one named by x-amz-copy-source.
+func (h *Handler) handlePutObject(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	bucketName, objectKey := req.Bucket, req.Key
+
+	// Validate the object key
+	if !utils.ValidateObjectKey(objectKey) {
+		WriteError(w, r, ErrInvalidObjectKey)
 		return
 	}
 
-	// Split the URL path to get the bucket name and object key
-	parts := strings.SplitN(strings.Trim(r.URL.Path, "/"), "/", 2)
-	if len(parts) != 2 {
-		http.Error(w, "Invalid URL. Expected /{BucketName}/{ObjectKey}", http.StatusBadRequest)
+	// Copy the object named by x-amz-copy-source on the server side
+	if r.Header.Get("X-Amz-Copy-Source") != "" {
+		if err := objects.CopyObject(h.store, bucketName, objectKey, w, r); err != nil {
+			WriteError(w, r, err)
+		}
 		return
 	}
 
-	bucketName, objectKey := parts[0], parts[1]
-	// Validate the object key
-	if !utils.ValidateObjectKey(objectKey) {
-		http.Error(w, "400 Bad Request: Invalid object key", http.StatusBadRequest)
+	// Create the object using the uploaded file and extracted metadata
+	// A body that did not match its signed hash fails with an auth error
+	if err := objects.CreateObject(h.store, bucketName, objectKey, w, r); err != nil {
+		WriteError(w, r, err)
 		return
 	}
+}
 
-	// Create the object using the uploaded file and extracted metadata
-	if err := objects.CreateObject(bucketName, objectKey, w, r); err != nil {
-		http.Error(w, "500 Internal Server Error: Failed to create object", http.StatusInternalServerError)
+// handleGetObject streams the object's content to the client.
+func (h *Handler) handleGetObject(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	bucketName, objectKey := req.Bucket, req.Key
+
+	// Get object metadata
+	err := objects.GetObject(h.store, bucketName, objectKey, r.URL.Query().Get("versionId"), w, r)
+	if err != nil {
+		WriteError(w, r, err)
 		return
 	}
 }
 
-// handleGetObject retrieves and responds with the object's metadata in XML format.
-func handleGetObject(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+// handleHeadObject responds with the object's stored headers and no body.
+func (h *Handler) handleHeadObject(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	bucketName, objectKey := req.Bucket, req.Key
+
+	if err := objects.GetObject(h.store, bucketName, objectKey, r.URL.Query().Get("versionId"), w, r); err != nil {
+		WriteError(w, r, err)
 		return
 	}
+}
+
+// handleDeleteObject removes the object and its metadata.
+func (h *Handler) handleDeleteObject(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	bucketName, objectKey := req.Bucket, req.Key
 
-	parts := strings.SplitN(r.URL.Path[1:], "/", 2)
-	if len(parts) != 2 {
-		http.Error(w, "Invalid URL. Expected /{BucketName}/{ObjectKey}", http.StatusBadRequest)
+	result, err := objects.DeleteObject(h.store, bucketName, objectKey, r.URL.Query().Get("versionId"), r)
+	if err != nil {
+		WriteError(w, r, err)
 		return
 	}
-	bucketName, objectKey := parts[0], parts[1]
 
-	// Get object metadata
-	err := objects.GetObject(bucketName, objectKey, w, r)
+	if result.VersionID != "" {
+		w.Header().Set("x-amz-version-id", result.VersionID)
+	}
+	if result.DeleteMarker {
+		w.Header().Set("x-amz-delete-marker", "true")
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListObjectVersions lists every version and delete marker in a bucket.
+func (h *Handler) handleListObjectVersions(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	bucketName := req.Bucket
+
+	result, err := objects.ListObjectVersions(h.store, bucketName, r.URL.Query().Get("prefix"))
 	if err != nil {
-		http.Error(w, "404 Not Found: Object not found", http.StatusNotFound)
+		WriteError(w, r, err)
 		return
 	}
 
-	// Set the response header for XML content
 	w.Header().Set("Content-Type", "application/xml")
 	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(result)
 }
 
-// handleDeleteObject removes the object and its metadata.
-func handleDeleteObject(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodDelete {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+// handleListObjects lists the objects of a bucket. Requests with list-type=2
+// get a ListObjectsV2 result and the rest a ListObjects one, or the full
+// ObjectList in the legacy XML format.
+func (h *Handler) handleListObjects(w http.ResponseWriter, r *http.Request, req *RequestInfo) {
+	bucketName := req.Bucket
+
+	query := r.URL.Query()
+	listV2 := query.Get("list-type") == "2"
+	if !listV2 && h.legacyXML {
+		if err := objects.ListObjectsLegacy(h.store, w, r, bucketName); err != nil {
+			WriteError(w, r, err)
+		}
 		return
 	}
 
-	parts := strings.SplitN(r.URL.Path[1:], "/", 2)
-	if len(parts) != 2 {
-		http.Error(w, "Invalid URL. Expected /{BucketName}/{ObjectKey}", http.StatusBadRequest)
-		return
+	params := objects.ListParams{
+		Prefix:            query.Get("prefix"),
+		Delimiter:         query.Get("delimiter"),
+		Marker:            query.Get("marker"),
+		StartAfter:        query.Get("start-after"),
+		ContinuationToken: query.Get("continuation-token"),
+		MaxKeys:           objects.DefaultMaxKeys,
+	}
+	if maxKeys := query.Get("max-keys"); maxKeys != "" {
+		n, err := strconv.Atoi(maxKeys)
+		if err != nil || n < 0 {
+			WriteError(w, r, ErrInvalidMaxKeys)
+			return
+		}
+		if n < params.MaxKeys {
+			params.MaxKeys = n
+		}
 	}
-	bucketName, objectKey := parts[0], parts[1]
 
-	if err := objects.DeleteObject(bucketName, objectKey); err != nil {
-		http.Error(w, "500 Internal Server Error: Error deleting object", http.StatusInternalServerError)
+	var result interface{}
+	var err error
+	if listV2 {
+		result, err = objects.ListObjectsV2(h.store, bucketName, params)
+	} else {
+		result, err = objects.ListObjects(h.store, bucketName, params)
+	}
+	if err != nil {
+		WriteError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(result)
 }
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"triple-s/storage"
+)
+
+// newTestStore returns a store held in memory.
+func newTestStore(t *testing.T) *storage.Store {
+	t.Helper()
+	st := storage.New("")
+	if err := st.OpenData(storage.DataBackendMemory); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.OpenMeta(storage.MetaBackendMemory); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+// newTestServer serves a handler over a store held in memory.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(NewHandler(newTestStore(t), nil, false))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// do sends a request and returns the response with its body read.
+func do(t *testing.T, ts *httptest.Server, method, path, body string, header map[string]string) (*http.Response, string) {
+	t.Helper()
+	r, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range header {
+		r.Header.Set(name, value)
+	}
+	resp, err := ts.Client().Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(data)
+}
+
+// mustDo is do for requests that must succeed.
+func mustDo(t *testing.T, ts *httptest.Server, method, path, body string, header map[string]string) (*http.Response, string) {
+	t.Helper()
+	resp, data := do(t, ts, method, path, body, header)
+	if resp.StatusCode >= 300 {
+		t.Fatalf("%s %s: %d %s", method, path, resp.StatusCode, data)
+	}
+	return resp, data
+}
+
+func TestHeadBucket(t *testing.T) {
+	ts := newTestServer(t)
+	mustDo(t, ts, http.MethodPut, "/bucket", "", nil)
+
+	if resp, body := do(t, ts, http.MethodHead, "/bucket", "", nil); resp.StatusCode != http.StatusOK || body != "" {
+		t.Errorf("HEAD of a bucket: %d %q, want 200 without a body", resp.StatusCode, body)
+	}
+	resp, body := do(t, ts, http.MethodHead, "/missing", "", nil)
+	if resp.StatusCode != http.StatusNotFound || body != "" {
+		t.Errorf("HEAD of a missing bucket: %d %q, want 404 without a body", resp.StatusCode, body)
+	}
+	if resp.Header.Get("x-amz-request-id") == "" {
+		t.Error("HEAD of a missing bucket has no request ID")
+	}
+}
+
+func TestHeadObject(t *testing.T) {
+	ts := newTestServer(t)
+	mustDo(t, ts, http.MethodPut, "/bucket", "", nil)
+	put, _ := mustDo(t, ts, http.MethodPut, "/bucket/key", "hello", map[string]string{"Content-Type": "text/plain"})
+
+	resp, body := do(t, ts, http.MethodHead, "/bucket/key", "", nil)
+	if resp.StatusCode != http.StatusOK || body != "" {
+		t.Fatalf("HEAD of an object: %d %q, want 200 without a body", resp.StatusCode, body)
+	}
+	for name, want := range map[string]string{
+		"Content-Length": "5",
+		"Content-Type":   "text/plain",
+		"ETag":           put.Header.Get("ETag"),
+		"Accept-Ranges":  "bytes",
+	} {
+		if got := resp.Header.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if resp.Header.Get("Last-Modified") == "" {
+		t.Error("HEAD of an object has no Last-Modified")
+	}
+
+	if resp, _ := do(t, ts, http.MethodHead, "/bucket/key", "", map[string]string{"If-None-Match": put.Header.Get("ETag")}); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("HEAD with a matching If-None-Match: %d, want 304", resp.StatusCode)
+	}
+	if resp, _ := do(t, ts, http.MethodHead, "/bucket/key", "", map[string]string{"Range": "bytes=1-2"}); resp.StatusCode != http.StatusPartialContent || resp.Header.Get("Content-Length") != "2" {
+		t.Errorf("HEAD with a range: %d with length %s, want 206 with 2", resp.StatusCode, resp.Header.Get("Content-Length"))
+	}
+	if resp, body := do(t, ts, http.MethodHead, "/bucket/missing", "", nil); resp.StatusCode != http.StatusNotFound || body != "" {
+		t.Errorf("HEAD of a missing object: %d %q, want 404 without a body", resp.StatusCode, body)
+	}
+	if resp, _ := do(t, ts, http.MethodHead, "/missing/key", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("HEAD in a missing bucket: %d, want 404", resp.StatusCode)
+	}
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// RequestInfo is what the router learned about a request: the S3 operation
+// it names, its bucket and key, and the subresources in its query string.
+type RequestInfo struct {
+	Operation    string // such as "GetObject", empty when no route matched
+	Bucket       string
+	Key          string   // URL-decoded, slashes kept
+	Subresources []string // sorted
+	// Admin is set for requests to the admin API, whose paths name the
+	// resource first: /_admin/quota/bucket has the subresource "quota".
+	Admin bool
+}
+
+// adminPath is the first element of the paths of the admin API. Bucket
+// names hold no underscore, so it never names a bucket.
+const adminPath = "_admin"
+
+type requestInfoKey struct{}
+
+// RequestInfoFrom returns the RequestInfo the router stored in the context
+// of a request, or nil outside of the router.
+func RequestInfoFrom(ctx context.Context) *RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*RequestInfo)
+	return info
+}
+
+// Route levels: the service, a bucket or an object.
+const (
+	levelService = iota
+	levelBucket
+	levelObject
+)
+
+// route maps a method, a level and a subresource to an operation.
+type route struct {
+	method      string
+	level       int
+	subresource string // empty for requests without a subresource
+	operation   string
+	handle      func(h *Handler, w http.ResponseWriter, r *http.Request, req *RequestInfo)
+}
+
+var routes = []route{
+	{http.MethodGet, levelService, "", "ListBuckets", (*Handler).handleGetBuckets},
+
+	{http.MethodPut, levelBucket, "", "CreateBucket", (*Handler).handlePutBucket},
+	{http.MethodHead, levelBucket, "", "HeadBucket", (*Handler).handleHeadBucket},
+	{http.MethodDelete, levelBucket, "", "DeleteBucket", (*Handler).handleDeleteBucket},
+	{http.MethodGet, levelBucket, "", "ListObjects", (*Handler).handleListObjects},
+	{http.MethodGet, levelBucket, "versions", "ListObjectVersions", (*Handler).handleListObjectVersions},
+	{http.MethodGet, levelBucket, "uploads", "ListMultipartUploads", (*Handler).handleListMultipartUploads},
+	{http.MethodGet, levelBucket, "versioning", "GetBucketVersioning", (*Handler).handleGetBucketVersioning},
+	{http.MethodPut, levelBucket, "versioning", "PutBucketVersioning", (*Handler).handlePutBucketVersioning},
+	{http.MethodGet, levelBucket, "lifecycle", "GetBucketLifecycleConfiguration", (*Handler).handleGetBucketLifecycle},
+	{http.MethodPut, levelBucket, "lifecycle", "PutBucketLifecycleConfiguration", (*Handler).handlePutBucketLifecycle},
+	{http.MethodDelete, levelBucket, "lifecycle", "DeleteBucketLifecycle", (*Handler).handleDeleteBucketLifecycle},
+	{http.MethodGet, levelBucket, "encryption", "GetBucketEncryption", (*Handler).handleGetBucketEncryption},
+	{http.MethodPut, levelBucket, "encryption", "PutBucketEncryption", (*Handler).handlePutBucketEncryption},
+	{http.MethodDelete, levelBucket, "encryption", "DeleteBucketEncryption", (*Handler).handleDeleteBucketEncryption},
+
+	{http.MethodPut, levelObject, "", "PutObject", (*Handler).handlePutObject},
+	{http.MethodGet, levelObject, "", "GetObject", (*Handler).handleGetObject},
+	{http.MethodHead, levelObject, "", "HeadObject", (*Handler).handleHeadObject},
+	{http.MethodDelete, levelObject, "", "DeleteObject", (*Handler).handleDeleteObject},
+	{http.MethodPost, levelObject, "uploads", "CreateMultipartUpload", (*Handler).handleInitiateMultipartUpload},
+	{http.MethodPut, levelObject, "uploadId", "UploadPart", (*Handler).handleUploadPart},
+	{http.MethodPost, levelObject, "uploadId", "CompleteMultipartUpload", (*Handler).handleCompleteMultipartUpload},
+	{http.MethodDelete, levelObject, "uploadId", "AbortMultipartUpload", (*Handler).handleAbortMultipartUpload},
+	{http.MethodGet, levelObject, "uploadId", "ListParts", (*Handler).handleListParts},
+}
+
+// adminRoutes are the routes of the admin API, matched like routes.
+var adminRoutes = []route{
+	{http.MethodGet, levelService, "quota", "ListBucketQuotas", (*Handler).handleListBucketQuotas},
+	{http.MethodGet, levelBucket, "quota", "GetBucketQuota", (*Handler).handleGetBucketQuota},
+	{http.MethodPut, levelBucket, "quota", "PutBucketQuota", (*Handler).handlePutBucketQuota},
+	{http.MethodDelete, levelBucket, "quota", "DeleteBucketQuota", (*Handler).handleDeleteBucketQuota},
+}
+
+// subresources are the query parameters that select an S3 operation rather
+// than qualify one. Requests naming one without a route are not implemented.
+var subresources = map[string]bool{
+	"accelerate": true, "acl": true, "analytics": true, "attributes": true,
+	"cors": true, "delete": true, "encryption": true, "intelligent-tiering": true,
+	"inventory": true, "legal-hold": true, "lifecycle": true, "location": true,
+	"logging": true, "metrics": true, "notification": true, "object-lock": true,
+	"ownershipControls": true, "policy": true, "policyStatus": true,
+	"publicAccessBlock": true, "replication": true, "requestPayment": true,
+	"restore": true, "retention": true, "select": true, "tagging": true,
+	"torrent": true, "uploadId": true, "uploads": true, "versioning": true,
+	"versions": true, "website": true,
+}
+
+// parseRequest splits the path of r into bucket and key and collects its
+// subresources.
+func parseRequest(r *http.Request) *RequestInfo {
+	info := &RequestInfo{}
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if first, rest, _ := strings.Cut(path, "/"); first == adminPath {
+		// The admin API takes no subresources from the query
+		info.Admin = true
+		resource, target, _ := strings.Cut(rest, "/")
+		info.Bucket, info.Key, _ = strings.Cut(target, "/")
+		if resource != "" {
+			info.Subresources = []string{resource}
+		}
+		return info
+	}
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		info.Bucket, info.Key = path[:i], path[i+1:]
+	} else {
+		info.Bucket = path
+	}
+
+	for name := range r.URL.Query() {
+		if subresources[name] {
+			info.Subresources = append(info.Subresources, name)
+		}
+	}
+	sort.Strings(info.Subresources)
+	return info
+}
+
+func (info *RequestInfo) level() int {
+	switch {
+	case info.Bucket == "":
+		return levelService
+	case info.Key == "":
+		return levelBucket
+	default:
+		return levelObject
+	}
+}
+
+// match finds the route of a request. It returns ErrNotImplemented for a
+// subresource without a route and ErrMethodNotAllowed for the rest.
+func match(r *http.Request, info *RequestInfo) (*route, error) {
+	subresource := ""
+	switch len(info.Subresources) {
+	case 0:
+	case 1:
+		subresource = info.Subresources[0]
+	default:
+		// No supported operation combines subresources
+		return nil, ErrNotImplemented
+	}
+
+	table := routes
+	if info.Admin {
+		table = adminRoutes
+	}
+	level := info.level()
+	for i := range table {
+		rt := &table[i]
+		if rt.method == r.Method && rt.level == level && rt.subresource == subresource {
+			return rt, nil
+		}
+	}
+	if subresource != "" {
+		return nil, ErrNotImplemented
+	}
+	return nil, ErrMethodNotAllowed
+}
+
+// operationName refines the operation of a route where S3 tells several
+// apart by a header or a query parameter.
+func operationName(rt *route, r *http.Request) string {
+	switch {
+	case rt.operation == "PutObject" && r.Header.Get("X-Amz-Copy-Source") != "":
+		return "CopyObject"
+	case rt.operation == "ListObjects" && r.URL.Query().Get("list-type") == "2":
+		return "ListObjectsV2"
+	}
+	return rt.operation
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseRequest(t *testing.T) {
+	tests := []struct {
+		target string
+		want   RequestInfo
+	}{
+		{"/", RequestInfo{}},
+		{"/bucket", RequestInfo{Bucket: "bucket"}},
+		{"/bucket/", RequestInfo{Bucket: "bucket"}},
+		{"/bucket/key", RequestInfo{Bucket: "bucket", Key: "key"}},
+		{"/bucket/dir/sub/key.txt", RequestInfo{Bucket: "bucket", Key: "dir/sub/key.txt"}},
+		{"/bucket/dir/", RequestInfo{Bucket: "bucket", Key: "dir/"}},
+		{"/bucket/a%20b%2Fc%3Fd", RequestInfo{Bucket: "bucket", Key: "a b/c?d"}},
+		{"/bucket/%C3%A9t%C3%A9", RequestInfo{Bucket: "bucket", Key: "été"}},
+		{"/bucket?versioning", RequestInfo{Bucket: "bucket", Subresources: []string{"versioning"}}},
+		{"/bucket?uploads&prefix=a", RequestInfo{Bucket: "bucket", Subresources: []string{"uploads"}}},
+		{"/bucket/key?versionId=1&uploadId=2", RequestInfo{Bucket: "bucket", Key: "key", Subresources: []string{"uploadId"}}},
+		{"/bucket/key?tagging&acl", RequestInfo{Bucket: "bucket", Key: "key", Subresources: []string{"acl", "tagging"}}},
+		{"/_admin/quota", RequestInfo{Subresources: []string{"quota"}, Admin: true}},
+		{"/_admin/quota/bucket?versioning", RequestInfo{Bucket: "bucket", Subresources: []string{"quota"}, Admin: true}},
+	}
+	for _, tt := range tests {
+		got := parseRequest(httptest.NewRequest(http.MethodGet, tt.target, nil))
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("parseRequest(%s) = %+v, want %+v", tt.target, *got, tt.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		method, target string
+		header         map[string]string
+		operation      string
+		err            error
+	}{
+		{http.MethodGet, "/", nil, "ListBuckets", nil},
+		{http.MethodPut, "/bucket", nil, "CreateBucket", nil},
+		{http.MethodGet, "/bucket", nil, "ListObjects", nil},
+		{http.MethodGet, "/bucket?list-type=2", nil, "ListObjectsV2", nil},
+		{http.MethodGet, "/bucket?versions", nil, "ListObjectVersions", nil},
+		{http.MethodPut, "/bucket?versioning", nil, "PutBucketVersioning", nil},
+		{http.MethodGet, "/bucket/dir/key", nil, "GetObject", nil},
+		{http.MethodPut, "/bucket/dir/key", nil, "PutObject", nil},
+		{http.MethodPut, "/bucket/key", map[string]string{"X-Amz-Copy-Source": "bucket/other"}, "CopyObject", nil},
+		{http.MethodPost, "/bucket/key?uploads", nil, "CreateMultipartUpload", nil},
+		{http.MethodPut, "/bucket/key?partNumber=1&uploadId=x", nil, "UploadPart", nil},
+		{http.MethodDelete, "/bucket/key?uploadId=x", nil, "AbortMultipartUpload", nil},
+		{http.MethodGet, "/_admin/quota", nil, "ListBucketQuotas", nil},
+		{http.MethodPut, "/_admin/quota/bucket", nil, "PutBucketQuota", nil},
+
+		// Unknown subresources are not implemented; known paths with the wrong method are not allowed
+		{http.MethodGet, "/bucket?acl", nil, "", ErrNotImplemented},
+		{http.MethodGet, "/bucket/key?tagging&acl", nil, "", ErrNotImplemented},
+		{http.MethodPost, "/bucket?versioning", nil, "", ErrNotImplemented},
+		{http.MethodPost, "/bucket", nil, "", ErrMethodNotAllowed},
+		{http.MethodDelete, "/", nil, "", ErrMethodNotAllowed},
+		{http.MethodPost, "/bucket/key", nil, "", ErrMethodNotAllowed},
+		{http.MethodGet, "/_admin/other/bucket", nil, "", ErrNotImplemented},
+		{http.MethodGet, "/_admin/quota/bucket/key", nil, "", ErrNotImplemented},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.target, nil)
+		for name, value := range tt.header {
+			r.Header.Set(name, value)
+		}
+		rt, err := match(r, parseRequest(r))
+		if err != tt.err {
+			t.Errorf("%s %s: error %v, want %v", tt.method, tt.target, err, tt.err)
+			continue
+		}
+		if rt != nil && operationName(rt, r) != tt.operation {
+			t.Errorf("%s %s: operation %s, want %s", tt.method, tt.target, operationName(rt, r), tt.operation)
+		}
+	}
+}
+
+func TestRouterServesKeysWithSlashes(t *testing.T) {
+	ts := newTestServer(t)
+	mustDo(t, ts, http.MethodPut, "/bucket", "", nil)
+	mustDo(t, ts, http.MethodPut, "/bucket/releases/v1.2/App.tar.gz", "app", nil)
+	if _, body := mustDo(t, ts, http.MethodGet, "/bucket/releases/v1.2/App.tar.gz", "", nil); body != "app" {
+		t.Errorf("GET of a key with slashes = %q", body)
+	}
+
+	for _, tt := range []struct {
+		method, path string
+		status       int
+	}{
+		{http.MethodGet, "/bucket?acl", http.StatusNotImplemented},
+		{http.MethodPost, "/bucket", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/bucket/releases/v1.2", http.StatusNotFound},
+	} {
+		if resp, body := do(t, ts, tt.method, tt.path, "", nil); resp.StatusCode != tt.status {
+			t.Errorf("%s %s: %d %s, want %d", tt.method, tt.path, resp.StatusCode, body, tt.status)
+		}
+	}
+}
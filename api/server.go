@@ -1,61 +1,52 @@
 package api
 
 import (
-	"log"
+	"context"
 	"net/http"
-	"strings"
 
-	"triple-s/config"
-	"triple-s/storage/objects"
+	"triple-s/auth"
+	"triple-s/storage"
 )
 
-// StartServer initializes and starts the HTTP server
-func StartServer(config *config.Config) error {
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-
-		switch r.Method {
-		case http.MethodPut:
-			if len(pathParts) == 1 && pathParts[0] != "" {
-				handlePutBucket(w, r) // Handle bucket creation
-			} else if len(pathParts) == 2 {
-				handlePutObject(w, r) // Handle object upload
-			} else {
-				http.Error(w, "Invalid URL or missing parameters", http.StatusBadRequest)
-			}
-
-		case http.MethodGet:
-
-			if r.URL.Path == "/" {
-				handleGetBuckets(w, r) // List all buckets
-			} else if len(pathParts) == 1 {
-				objects.ListObjects(w, r, pathParts[0])
-			} else if len(pathParts) == 2 {
-				handleGetObject(w, r) // Retrieve a specific object
-			} else {
-				http.Error(w, "Bucket name or object key is required", http.StatusBadRequest)
-			}
+// Handler serves the S3 API for one storage directory.
+type Handler struct {
+	store     *storage.Store
+	creds     *auth.Credentials
+	legacyXML bool // list buckets and objects as BucketList and ObjectList
+}
 
-		case http.MethodDelete:
-			if len(pathParts) == 1 && pathParts[0] != "" {
-				handleDeleteBucket(w, r) // Delete a bucket
-			} else if len(pathParts) == 2 {
-				handleDeleteObject(w, r) // Delete a specific object
-			} else {
-				http.Error(w, "Invalid URL or missing parameters", http.StatusBadRequest)
-			}
+// NewHandler returns the handler serving store. Requests must be signed with
+// one of creds unless it is nil or empty. With legacyXML, bucket and object
+// listings use the XML formats that predate the S3 ones.
+func NewHandler(store *storage.Store, creds *auth.Credentials, legacyXML bool) *Handler {
+	return &Handler{store: store, creds: creds, legacyXML: legacyXML}
+}
 
-		default:
-			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		}
-	})
+// ServeHTTP routes a request to the handler of its S3 operation, after
+// checking its signature. Only the admin access key reaches the admin API.
+// The RequestInfo of the request is kept in its context.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	setRequestID(w)
+
+	info := parseRequest(r)
+	r = r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info))
+	rt, routeErr := match(r, info)
+	if rt != nil {
+		info.Operation = operationName(rt, r)
+	}
 
-	// Start the server on the specified port
-	log.Printf("Server is listening on port %s", config.Port)
-	err := http.ListenAndServe(":"+config.Port, nil)
-	if err != nil {
-		log.Fatalf("Could not listen on port %s: %v", config.Port, err)
-		return err
+	// Reject unsigned or badly signed requests before anything else
+	if err := h.creds.Verify(r); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if info.Admin && !h.creds.Admin(r) {
+		WriteError(w, r, auth.ErrAccessDenied)
+		return
+	}
+	if routeErr != nil {
+		WriteError(w, r, routeErr)
+		return
 	}
-	return nil
+	rt.handle(h, w, r, info)
 }
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// Credentials maps access key IDs to their secret keys. Authentication is
+// disabled while there are none; a nil *Credentials has none.
+type Credentials struct {
+	secrets map[string]string
+	// adminKey is the access key allowed to use the admin API.
+	adminKey string
+
+	// FirstAccessKey is the first access key listed in the credentials file,
+	// which presign uses by default. It is empty for credentials built with
+	// NewCredentials, whose keys have no order.
+	FirstAccessKey string
+}
+
+// NewCredentials returns credentials holding the given access key/secret pairs.
+func NewCredentials(secrets map[string]string) *Credentials {
+	c := &Credentials{secrets: make(map[string]string, len(secrets))}
+	for accessKey, secret := range secrets {
+		c.secrets[accessKey] = secret
+	}
+	return c
+}
+
+// SetAdminKey names the access key allowed to use the admin API. Until one
+// is set, only servers without credentials serve the admin API.
+func (c *Credentials) SetAdminKey(accessKey string) error {
+	if _, ok := c.secrets[accessKey]; !ok {
+		return fmt.Errorf("admin key %q is not one of the credentials", accessKey)
+	}
+	c.adminKey = accessKey
+	return nil
+}
+
+// LoadCredentials reads access key/secret pairs from a CSV file with the
+// header "AccessKeyID,SecretAccessKey".
+func LoadCredentials(path string) (*Credentials, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials: %w", err)
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("no credentials found in %s", path)
+	}
+
+	creds := &Credentials{secrets: make(map[string]string, len(records)-1), FirstAccessKey: records[1][0]}
+	for _, record := range records[1:] {
+		if len(record) != 2 || record[0] == "" || record[1] == "" {
+			return nil, fmt.Errorf("invalid credentials record %q", record)
+		}
+		creds.secrets[record[0]] = record[1]
+	}
+	return creds, nil
+}
+
+// Enabled reports whether requests must be signed.
+func (c *Credentials) Enabled() bool {
+	return c != nil && len(c.secrets) > 0
+}
+
+// Admin reports whether r may use the admin API, which takes the key set
+// with SetAdminKey. Every request may while there are no credentials. Call it
+// after Verify.
+func (c *Credentials) Admin(r *http.Request) bool {
+	if !c.Enabled() {
+		return true
+	}
+	return c.adminKey != "" && AccessKey(r) == c.adminKey
+}
+
+// secret returns the secret key of an access key.
+func (c *Credentials) secret(accessKey string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	secret, ok := c.secrets[accessKey]
+	return secret, ok
+}
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAdmin(t *testing.T) {
+	creds := NewCredentials(map[string]string{"admin": "secret1", "user": "secret2"})
+	request := func(accessKey, secret string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "http://localhost:8080/", nil)
+		sign(r, accessKey, secret, time.Now().UTC(), emptySHA256)
+		return r
+	}
+	if creds.Admin(request("admin", "secret1")) {
+		t.Error("Admin before SetAdminKey = true, want false")
+	}
+	if err := creds.SetAdminKey("nobody"); err == nil {
+		t.Error("SetAdminKey of an unknown key succeeded")
+	}
+	if err := creds.SetAdminKey("admin"); err != nil {
+		t.Fatal(err)
+	}
+	if !creds.Admin(request("admin", "secret1")) {
+		t.Error("Admin for the admin key = false, want true")
+	}
+	if creds.Admin(request("user", "secret2")) {
+		t.Error("Admin for another key = true, want false")
+	}
+}
@@ -0,0 +1,29 @@
+package auth
+
+import "net/http"
+
+// Error is an authentication failure carrying its S3 error code.
+type Error struct {
+	Code       string
+	Message    string
+	StatusCode int
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+var (
+	ErrAccessDenied            = &Error{"AccessDenied", "Access Denied", http.StatusForbidden}
+	ErrExpiredRequest          = &Error{"AccessDenied", "Request has expired", http.StatusForbidden}
+	ErrSignatureDoesNotMatch   = &Error{"SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided", http.StatusForbidden}
+	ErrInvalidAccessKeyID      = &Error{"InvalidAccessKeyId", "The AWS access key Id you provided does not exist in our records", http.StatusForbidden}
+	ErrRequestTimeTooSkewed    = &Error{"RequestTimeTooSkewed", "The difference between the request time and the server's time is too large", http.StatusForbidden}
+	ErrMalformedHeader         = &Error{"AuthorizationHeaderMalformed", "The authorization header is malformed", http.StatusBadRequest}
+	ErrMalformedQuery          = &Error{"AuthorizationQueryParametersError", "The authorization query parameters are malformed", http.StatusBadRequest}
+	ErrUnsupportedAlgorithm    = &Error{"InvalidRequest", "Please use AWS4-HMAC-SHA256", http.StatusBadRequest}
+	ErrMissingDate             = &Error{"AccessDenied", "AWS authentication requires a valid Date or x-amz-date header", http.StatusForbidden}
+	ErrContentSHA256Mismatch   = &Error{"XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed", http.StatusBadRequest}
+	ErrInvalidContentSHA256    = &Error{"InvalidArgument", "x-amz-content-sha256 must be UNSIGNED-PAYLOAD, STREAMING-AWS4-HMAC-SHA256-PAYLOAD, STREAMING-UNSIGNED-PAYLOAD-TRAILER or a valid sha256 value", http.StatusBadRequest}
+	ErrMalformedChunkedPayload = &Error{"IncompleteBody", "The chunked request body is malformed", http.StatusBadRequest}
+)
@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var sha256Regex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// body pairs a replacement reader with the original request body closer.
+type body struct {
+	io.Reader
+	io.Closer
+}
+
+// wrapBody makes r.Body verify the payload hash declared in x-amz-content-sha256.
+func wrapBody(r *http.Request, payloadHash string, key []byte, scope, timestamp, seedSignature string) error {
+	switch {
+	case payloadHash == unsignedPayload:
+		return nil
+
+	case payloadHash == streamingPayload || payloadHash == streamingUnsignedTrailer:
+		chunked := &chunkedReader{r: bufio.NewReader(r.Body), scope: scope, timestamp: timestamp, prevSignature: seedSignature}
+		if payloadHash == streamingPayload {
+			chunked.key = key
+		}
+		r.Body = body{chunked, r.Body}
+
+		// Downstream code sees the decoded payload, not the aws-chunked framing.
+		if decoded := r.Header.Get("X-Amz-Decoded-Content-Length"); decoded != "" {
+			size, err := strconv.ParseInt(decoded, 10, 64)
+			if err != nil {
+				return ErrMalformedChunkedPayload
+			}
+			r.ContentLength = size
+			r.Header.Set("Content-Length", decoded)
+		}
+		var encodings []string
+		for _, encoding := range strings.Split(r.Header.Get("Content-Encoding"), ",") {
+			if encoding = strings.TrimSpace(encoding); encoding != "" && encoding != "aws-chunked" {
+				encodings = append(encodings, encoding)
+			}
+		}
+		if len(encodings) == 0 {
+			r.Header.Del("Content-Encoding")
+		} else {
+			r.Header.Set("Content-Encoding", strings.Join(encodings, ","))
+		}
+		return nil
+
+	case sha256Regex.MatchString(payloadHash):
+		r.Body = body{&hashingReader{r: r.Body, hash: sha256.New(), expected: payloadHash}, r.Body}
+		return nil
+	}
+	return ErrInvalidContentSHA256
+}
+
+// hashingReader fails at EOF when the data read does not match the expected SHA-256.
+type hashingReader struct {
+	r        io.Reader
+	hash     hash.Hash
+	expected string
+}
+
+func (h *hashingReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.hash.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(h.hash.Sum(nil)) != h.expected {
+		return n, ErrContentSHA256Mismatch
+	}
+	return n, err
+}
+
+// chunkedReader decodes an aws-chunked body. When key is set every chunk
+// signature is checked against the previous one, starting from the seed
+// signature of the request.
+type chunkedReader struct {
+	r             *bufio.Reader
+	key           []byte
+	scope         string
+	timestamp     string
+	prevSignature string
+
+	remaining int64
+	signature string
+	hash      hash.Hash
+	err       error
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.remaining == 0 {
+		if c.err = c.nextChunk(); c.err != nil {
+			return 0, c.err
+		}
+	}
+
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.r.Read(p)
+	c.remaining -= int64(n)
+	if c.hash != nil {
+		c.hash.Write(p[:n])
+	}
+	if err == io.EOF {
+		err = ErrMalformedChunkedPayload
+	}
+	if err == nil && c.remaining == 0 {
+		err = c.endChunk()
+	}
+	c.err = err
+	return n, err
+}
+
+// nextChunk reads a chunk header. It returns io.EOF after the final chunk.
+func (c *chunkedReader) nextChunk() error {
+	line, err := c.readLine()
+	if err == io.EOF {
+		return ErrMalformedChunkedPayload
+	}
+	if err != nil {
+		return err
+	}
+	sizeField, params, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(sizeField, 16, 64)
+	if err != nil || size < 0 {
+		return ErrMalformedChunkedPayload
+	}
+	if c.key != nil {
+		signature, found := strings.CutPrefix(params, "chunk-signature=")
+		if !found {
+			return ErrMalformedChunkedPayload
+		}
+		c.signature = signature
+		c.hash = sha256.New()
+	}
+
+	if size > 0 {
+		c.remaining = size
+		return nil
+	}
+
+	// The final chunk is empty and is followed by optional trailers and a blank line.
+	if err := c.verifyChunk(); err != nil {
+		return err
+	}
+	for {
+		line, err := c.readLine()
+		if err == io.EOF || (err == nil && line == "") {
+			return io.EOF
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// endChunk consumes the CRLF after the chunk data and checks its signature.
+func (c *chunkedReader) endChunk() error {
+	line, err := c.readLine()
+	if err != nil || line != "" {
+		return ErrMalformedChunkedPayload
+	}
+	return c.verifyChunk()
+}
+
+// verifyChunk checks the signature of the chunk just read.
+func (c *chunkedReader) verifyChunk() error {
+	if c.key == nil {
+		return nil
+	}
+	toSign := strings.Join([]string{
+		algorithm + "-PAYLOAD",
+		c.timestamp,
+		c.scope,
+		c.prevSignature,
+		emptySHA256,
+		hex.EncodeToString(c.hash.Sum(nil)),
+	}, "\n")
+	expected := hex.EncodeToString(hmacSHA256(c.key, toSign))
+	if !hmac.Equal([]byte(expected), []byte(c.signature)) {
+		return ErrSignatureDoesNotMatch
+	}
+	c.prevSignature = c.signature
+	return nil
+}
+
+// readLine reads one CRLF-terminated line without the line ending.
+func (c *chunkedReader) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return "", io.EOF
+	}
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	if !strings.HasSuffix(line, "\n") {
+		return "", ErrMalformedChunkedPayload
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
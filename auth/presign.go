@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultRegion is the region put in the credential scope of presigned URLs.
+const DefaultRegion = "us-east-1"
+
+// Presign returns a URL that grants method on the object for ttl without
+// further credentials. endpoint is the scheme and host clients will use,
+// e.g. "http://localhost:8080".
+func (c *Credentials) Presign(method, endpoint, bucketName, objectKey, accessKey string, ttl time.Duration) (string, error) {
+	secret, ok := c.secret(accessKey)
+	if !ok {
+		return "", fmt.Errorf("unknown access key %q", accessKey)
+	}
+	if ttl < time.Second || ttl > MaxPresignExpiry {
+		return "", errors.New("ttl must be between 1s and 168h")
+	}
+
+	base, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil || base.Host == "" {
+		return "", fmt.Errorf("invalid endpoint %q", endpoint)
+	}
+
+	now := time.Now().UTC()
+	cred := credential{accessKey: accessKey, date: now.Format(dateFormat), region: DefaultRegion, service: "s3"}
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", algorithm)
+	query.Set("X-Amz-Credential", cred.accessKey+"/"+cred.scope())
+	query.Set("X-Amz-Date", now.Format(timeFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(ttl/time.Second)))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	r, err := http.NewRequest(method, base.String()+"/"+bucketName+"/"+uriEncode(objectKey, false)+"?"+canonicalQuery(query), nil)
+	if err != nil {
+		return "", err
+	}
+	canonical := canonicalRequest(r, []string{"host"}, unsignedPayload)
+	signature := hex.EncodeToString(hmacSHA256(signingKey(secret, cred), stringToSign(now.Format(timeFormat), cred.scope(), canonical)))
+
+	return r.URL.String() + "&X-Amz-Signature=" + signature, nil
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// presigned returns a request for a URL made by Presign after edit changed
+// its query.
+func presigned(t *testing.T, method, objectKey string, edit func(query url.Values)) *http.Request {
+	t.Helper()
+	signed, err := exampleCredentials.Presign(method, "http://localhost:8080", "bucket", objectKey, exampleAccessKey, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edit != nil {
+		query := u.Query()
+		edit(query)
+		u.RawQuery = query.Encode()
+	}
+	return httptest.NewRequest(method, u.String(), strings.NewReader("body"))
+}
+
+func TestPresign(t *testing.T) {
+	for _, key := range []string{"key", "dir/sub/key", "a b+c&d=é"} {
+		for _, method := range []string{http.MethodGet, http.MethodPut} {
+			r := presigned(t, method, key, nil)
+			if err := exampleCredentials.Verify(r); err != nil {
+				t.Errorf("%s %q: %v", method, key, err)
+			}
+			if got := AccessKey(r); got != exampleAccessKey {
+				t.Errorf("%s %q: AccessKey = %q", method, key, got)
+			}
+			if got := strings.TrimPrefix(r.URL.Path, "/bucket/"); got != key {
+				t.Errorf("%s %q: URL path holds key %q", method, key, got)
+			}
+		}
+	}
+}
+
+func TestPresignedRequestRejected(t *testing.T) {
+	old := time.Now().UTC().Add(-2 * time.Hour)
+	tests := []struct {
+		name   string
+		method string
+		edit   func(query url.Values)
+		want   error
+	}{
+		{"other method", http.MethodDelete, nil, ErrSignatureDoesNotMatch},
+		{"longer expiry", http.MethodGet, func(q url.Values) { q.Set("X-Amz-Expires", "7200") }, ErrSignatureDoesNotMatch},
+		{"added parameter", http.MethodGet, func(q url.Values) { q.Set("versionId", "1") }, ErrSignatureDoesNotMatch},
+		{"expired", http.MethodGet, func(q url.Values) {
+			q.Set("X-Amz-Date", old.Format(timeFormat))
+			q.Set("X-Amz-Credential", exampleAccessKey+"/"+old.Format(dateFormat)+"/us-east-1/s3/aws4_request")
+		}, ErrExpiredRequest},
+		{"expiry past a week", http.MethodGet, func(q url.Values) { q.Set("X-Amz-Expires", "604801") }, ErrMalformedQuery},
+		{"no expiry", http.MethodGet, func(q url.Values) { q.Del("X-Amz-Expires") }, ErrMalformedQuery},
+		{"other algorithm", http.MethodGet, func(q url.Values) { q.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA1") }, ErrUnsupportedAlgorithm},
+		{"unknown key", http.MethodGet, func(q url.Values) {
+			q.Set("X-Amz-Credential", strings.Replace(q.Get("X-Amz-Credential"), exampleAccessKey, "AKIDUNKNOWN", 1))
+		}, ErrInvalidAccessKeyID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := presigned(t, http.MethodGet, "key", tt.edit)
+			r.Method = tt.method
+			if err := exampleCredentials.Verify(r); err != tt.want {
+				t.Errorf("Verify: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPresignArguments(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoint  string
+		accessKey string
+		ttl       time.Duration
+	}{
+		{"unknown key", "http://localhost:8080", "AKIDUNKNOWN", time.Hour},
+		{"short ttl", "http://localhost:8080", exampleAccessKey, time.Millisecond},
+		{"long ttl", "http://localhost:8080", exampleAccessKey, MaxPresignExpiry + time.Second},
+		{"no host", "localhost", exampleAccessKey, time.Hour},
+	}
+	for _, tt := range tests {
+		if _, err := exampleCredentials.Presign(http.MethodGet, tt.endpoint, "bucket", "key", tt.accessKey, tt.ttl); err == nil {
+			t.Errorf("%s: Presign succeeded", tt.name)
+		}
+	}
+}
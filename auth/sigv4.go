@@ -0,0 +1,300 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AWS Signature Version 4: https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-authenticating-requests.html
+const (
+	algorithm  = "AWS4-HMAC-SHA256"
+	timeFormat = "20060102T150405Z"
+	dateFormat = "20060102"
+
+	// MaxClockSkew is how far the request time may drift from the server clock.
+	MaxClockSkew = 15 * time.Minute
+	// MaxPresignExpiry is the longest lifetime a query-string signature may claim.
+	MaxPresignExpiry = 7 * 24 * time.Hour
+
+	unsignedPayload          = "UNSIGNED-PAYLOAD"
+	streamingPayload         = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	streamingUnsignedTrailer = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+	emptySHA256              = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// credential is the parsed Credential component of a signature.
+type credential struct {
+	accessKey string
+	date      string
+	region    string
+	service   string
+}
+
+// scope returns the credential scope used in the string to sign.
+func (c credential) scope() string {
+	return strings.Join([]string{c.date, c.region, c.service, "aws4_request"}, "/")
+}
+
+// parseCredential splits "AKID/20130524/us-east-1/s3/aws4_request".
+func parseCredential(value string) (credential, bool) {
+	parts := strings.Split(value, "/")
+	if len(parts) != 5 || parts[0] == "" || parts[4] != "aws4_request" || parts[3] != "s3" {
+		return credential{}, false
+	}
+	return credential{accessKey: parts[0], date: parts[1], region: parts[2], service: parts[3]}, true
+}
+
+// Verify authenticates r using either the Authorization header or the
+// X-Amz-* query parameters. Signed payloads are checked while the body is
+// read, so r.Body may be replaced by a verifying reader. Verify accepts
+// every request while there are no credentials.
+func (c *Credentials) Verify(r *http.Request) error {
+	if !c.Enabled() {
+		return nil
+	}
+	if r.URL.Query().Has("X-Amz-Signature") {
+		return c.verifyQuery(r)
+	}
+	if header := r.Header.Get("Authorization"); header != "" {
+		return c.verifyHeader(r, header)
+	}
+	return ErrAccessDenied
+}
+
+// AccessKey returns the access key r claims to be signed with, or "" for an
+// unsigned request. It does not check the signature; call it after Verify.
+func AccessKey(r *http.Request) string {
+	var value string
+	if query := r.URL.Query(); query.Has("X-Amz-Signature") {
+		value = query.Get("X-Amz-Credential")
+	} else {
+		_, fields, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		for _, field := range strings.Split(fields, ",") {
+			if key, v, _ := strings.Cut(strings.TrimSpace(field), "="); key == "Credential" {
+				value = v
+			}
+		}
+	}
+	cred, _ := parseCredential(value)
+	return cred.accessKey
+}
+
+// verifyHeader checks a request signed with the Authorization header.
+func (c *Credentials) verifyHeader(r *http.Request, header string) error {
+	scheme, fields, found := strings.Cut(header, " ")
+	if !found || scheme != algorithm {
+		return ErrUnsupportedAlgorithm
+	}
+
+	params := make(map[string]string)
+	for _, field := range strings.Split(fields, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(field), "=")
+		if !found {
+			return ErrMalformedHeader
+		}
+		params[key] = value
+	}
+	cred, ok := parseCredential(params["Credential"])
+	if !ok || params["SignedHeaders"] == "" || params["Signature"] == "" {
+		return ErrMalformedHeader
+	}
+
+	requestTime, err := requestTime(r)
+	if err != nil {
+		return err
+	}
+	if skew := time.Since(requestTime); skew > MaxClockSkew || skew < -MaxClockSkew {
+		return ErrRequestTimeTooSkewed
+	}
+	if cred.date != requestTime.Format(dateFormat) {
+		return ErrMalformedHeader
+	}
+
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		return ErrInvalidContentSHA256
+	}
+
+	signedHeaders := strings.Split(params["SignedHeaders"], ";")
+	key, err := c.verifySignature(r, cred, requestTime, signedHeaders, payloadHash, params["Signature"])
+	if err != nil {
+		return err
+	}
+
+	return wrapBody(r, payloadHash, key, cred.scope(), requestTime.Format(timeFormat), params["Signature"])
+}
+
+// verifyQuery checks a presigned request whose signature is in the query string.
+func (c *Credentials) verifyQuery(r *http.Request) error {
+	query := r.URL.Query()
+	if query.Get("X-Amz-Algorithm") != algorithm {
+		return ErrUnsupportedAlgorithm
+	}
+
+	cred, ok := parseCredential(query.Get("X-Amz-Credential"))
+	signedHeaders := query.Get("X-Amz-SignedHeaders")
+	signature := query.Get("X-Amz-Signature")
+	if !ok || signedHeaders == "" || signature == "" {
+		return ErrMalformedQuery
+	}
+
+	requestTime, err := time.Parse(timeFormat, query.Get("X-Amz-Date"))
+	if err != nil || cred.date != requestTime.Format(dateFormat) {
+		return ErrMalformedQuery
+	}
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || expires < 1 || time.Duration(expires)*time.Second > MaxPresignExpiry {
+		return ErrMalformedQuery
+	}
+
+	now := time.Now()
+	if requestTime.Sub(now) > MaxClockSkew {
+		return ErrRequestTimeTooSkewed
+	}
+	if now.After(requestTime.Add(time.Duration(expires) * time.Second)) {
+		return ErrExpiredRequest
+	}
+
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		payloadHash = unsignedPayload
+	}
+
+	key, err := c.verifySignature(r, cred, requestTime, strings.Split(signedHeaders, ";"), payloadHash, signature)
+	if err != nil {
+		return err
+	}
+
+	return wrapBody(r, payloadHash, key, cred.scope(), requestTime.Format(timeFormat), signature)
+}
+
+// requestTime reads the signing time from X-Amz-Date, falling back to Date.
+func requestTime(r *http.Request) (time.Time, error) {
+	if value := r.Header.Get("X-Amz-Date"); value != "" {
+		t, err := time.Parse(timeFormat, value)
+		if err != nil {
+			return time.Time{}, ErrMissingDate
+		}
+		return t, nil
+	}
+	if value := r.Header.Get("Date"); value != "" {
+		t, err := http.ParseTime(value)
+		if err != nil {
+			return time.Time{}, ErrMissingDate
+		}
+		return t.UTC(), nil
+	}
+	return time.Time{}, ErrMissingDate
+}
+
+// verifySignature recomputes the request signature and compares it with the
+// one the client sent. It returns the signing key for checking chunk signatures.
+func (c *Credentials) verifySignature(r *http.Request, cred credential, requestTime time.Time, signedHeaders []string, payloadHash, signature string) ([]byte, error) {
+	secret, ok := c.secret(cred.accessKey)
+	if !ok {
+		return nil, ErrInvalidAccessKeyID
+	}
+
+	hasHost := false
+	for _, name := range signedHeaders {
+		hasHost = hasHost || name == "host"
+	}
+	if !hasHost {
+		return nil, ErrAccessDenied
+	}
+
+	canonical := canonicalRequest(r, signedHeaders, payloadHash)
+	key := signingKey(secret, cred)
+	expected := hex.EncodeToString(hmacSHA256(key, stringToSign(requestTime.Format(timeFormat), cred.scope(), canonical)))
+
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return nil, ErrSignatureDoesNotMatch
+	}
+	return key, nil
+}
+
+// canonicalRequest builds the canonical form of r covered by the signature.
+func canonicalRequest(r *http.Request, signedHeaders []string, payloadHash string) string {
+	path := uriEncode(r.URL.Path, false)
+	if path == "" {
+		path = "/"
+	}
+
+	var headers strings.Builder
+	for _, name := range signedHeaders {
+		value := strings.Join(r.Header.Values(name), ",")
+		if name == "host" {
+			value = r.Host
+		}
+		headers.WriteString(name + ":" + strings.Join(strings.Fields(value), " ") + "\n")
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		path,
+		canonicalQuery(r.URL.Query()),
+		headers.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+}
+
+// canonicalQuery encodes the query parameters sorted by name and value,
+// leaving out the signature itself.
+func canonicalQuery(query url.Values) string {
+	var pairs []string
+	for key, values := range query {
+		if key == "X-Amz-Signature" {
+			continue
+		}
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// stringToSign combines the signing time, scope and canonical request hash.
+func stringToSign(timestamp, scope, canonical string) string {
+	sum := sha256.Sum256([]byte(canonical))
+	return strings.Join([]string{algorithm, timestamp, scope, hex.EncodeToString(sum[:])}, "\n")
+}
+
+// signingKey derives the key for the credential scope from the secret.
+func signingKey(secret string, cred credential) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), cred.date)
+	key = hmacSHA256(key, cred.region)
+	key = hmacSHA256(key, cred.service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// uriEncode percent-encodes every byte except the unreserved characters,
+// and '/' unless encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -1,22 +1,41 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"triple-s/api"
-	"triple-s/config"
+	"triple-s/auth"
+	"triple-s/server"
 	"triple-s/storage"
-	"triple-s/storage/buckets"
+	"triple-s/storage/sse"
 	"triple-s/utils"
 )
 
 func main() {
+	// Subcommands come before the server flags
+	if len(os.Args) > 1 && os.Args[1] == "presign" {
+		runPresign(os.Args[2:])
+		return
+	}
+
 	// Define command-line flags
 	port := flag.String("port", "8080", "Port number (e.g., 8080)") // Removed leading colon
 	storageDir := flag.String("dir", "./data", "Path to the storage directory")
+	credentials := flag.String("credentials", "", "Path to a CSV file of access keys; enables request signing")
+	adminKey := flag.String("admin-key", "", "Access key allowed to use the admin API; requires --credentials")
+	metaBackend := flag.String("meta-backend", "", "Metadata store: csv, journal, btree or memory (default journal, memory with --backend=memory)")
+	dataBackend := flag.String("backend", storage.DataBackendFS, "Object data store: fs or memory")
+	layout := flag.String("layout", string(storage.LayoutSharded), "Object data layout: sharded or flat")
+	lifecycleInterval := flag.Duration("lifecycle-interval", server.DefaultLifecycleInterval, "How often bucket lifecycle rules run; negative disables them")
+	masterKey := flag.String("master-key", "", "Path to the 32-byte master key file (raw, hex or base64); enables SSE-S3")
+	legacyXML := flag.Bool("legacy-xml", false, "List buckets and objects in the pre-S3 BucketList and ObjectList formats")
 	help := flag.Bool("help", false, "Show help screen")
 
 	// Parse the flags
@@ -28,22 +47,106 @@ func main() {
 		os.Exit(0)
 	}
 
-	// Create a new config instance
-	cfg := config.NewConfig(*port, *storageDir)
+	// Load the access keys; without them every request is accepted
+	var creds *auth.Credentials
+	if *credentials != "" {
+		var err error
+		if creds, err = auth.LoadCredentials(*credentials); err != nil {
+			log.Fatalf("Error loading credentials: %v\n", err)
+		}
+		if *adminKey != "" {
+			if err := creds.SetAdminKey(*adminKey); err != nil {
+				log.Fatalf("Error setting the admin key: %v\n", err)
+			}
+		}
+	} else if *adminKey != "" {
+		log.Fatalf("--admin-key requires --credentials\n")
+	}
+
+	// Load the master key of server-side encryption
+	var key []byte
+	if *masterKey != "" {
+		var err error
+		if key, err = sse.LoadKey(*masterKey); err != nil {
+			log.Fatalf("Error loading master key: %v\n", err)
+		}
+	}
 
-	// Initialize storage and root directory
-	storage.InitStorage()
-	if err := buckets.CreateRootDirectory(); err != nil {
-		log.Fatalf("Error creating root directory: %v\n", err)
+	// Open the storage directory and recover from an earlier crash
+	srv, err := server.New(server.Options{
+		Dir:               *storageDir,
+		Backend:           *dataBackend,
+		MetaBackend:       *metaBackend,
+		Credentials:       creds,
+		Layout:            *layout,
+		LegacyXML:         *legacyXML,
+		LifecycleInterval: *lifecycleInterval,
+		MasterKey:         key,
+	})
+	if err != nil {
+		log.Printf("Error starting server: %v\n", err)
 		showHelpAndExit()
 	}
 
+	// Finish the requests in progress and close the storage on SIGINT or SIGTERM
+	httpServer := &http.Server{Addr: ":" + *port, Handler: srv}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-stop
+		log.Println("Shutting down")
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		httpServer.Shutdown(ctx)
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Error closing storage: %v\n", err)
+		}
+	}()
+
 	// Attempt to start the server
 	log.Printf("Starting server on port %s, storing files in %s\n", *port, *storageDir)
-	if err := api.StartServer(cfg); err != nil {
+	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
 		log.Printf("Error starting server: %v\n", err)
 		showHelpAndExit()
 	}
+	<-stopped
+}
+
+// runPresign prints a presigned URL for one object and exits.
+func runPresign(args []string) {
+	fs := flag.NewFlagSet("presign", flag.ExitOnError)
+	credentials := fs.String("credentials", "", "Path to the CSV file of access keys")
+	accessKey := fs.String("access-key", "", "Access key ID to sign with (default: first in the file)")
+	endpoint := fs.String("endpoint", "http://localhost:8080", "Scheme and host clients will use")
+	method := fs.String("method", http.MethodGet, "HTTP method the URL allows (GET or PUT)")
+	bucketName := fs.String("bucket", "", "Bucket name")
+	objectKey := fs.String("key", "", "Object key")
+	ttl := fs.Duration("ttl", 15*time.Minute, "How long the URL stays valid (max 168h)")
+	fs.Parse(args)
+
+	if *credentials == "" || *bucketName == "" || *objectKey == "" {
+		fmt.Fprintln(os.Stderr, "presign requires --credentials, --bucket and --key")
+		utils.PrintUsage()
+		os.Exit(1)
+	}
+	if *method != http.MethodGet && *method != http.MethodPut {
+		log.Fatalf("Unsupported method %s: expected GET or PUT\n", *method)
+	}
+	creds, err := auth.LoadCredentials(*credentials)
+	if err != nil {
+		log.Fatalf("Error loading credentials: %v\n", err)
+	}
+	if *accessKey == "" {
+		*accessKey = creds.FirstAccessKey
+	}
+
+	url, err := creds.Presign(*method, *endpoint, *bucketName, *objectKey, *accessKey, *ttl)
+	if err != nil {
+		log.Fatalf("Error presigning URL: %v\n", err)
+	}
+	fmt.Println(url)
 }
 
 // showHelpAndExit prints the help screen and exits the program with a non-zero status.
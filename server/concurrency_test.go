@@ -0,0 +1,286 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"triple-s/storage"
+	"triple-s/storage/backend"
+	"triple-s/storage/csvmeta"
+)
+
+// startServer runs a server on a new storage directory behind httptest.
+func startServer(t *testing.T, dir string) (*Server, *httptest.Server) {
+	t.Helper()
+	srv, err := New(Options{Dir: dir, LifecycleInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv)
+	t.Cleanup(func() {
+		ts.Close()
+		srv.Shutdown(context.Background())
+	})
+	return srv, ts
+}
+
+// call sends a request and returns the response with its body read. It may
+// run on any goroutine: a request that fails to get a response is reported
+// and gets an empty one.
+func call(t *testing.T, ts *httptest.Server, method, path string, body []byte, header map[string]string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, bytes.NewReader(body))
+	if err != nil {
+		t.Error(err)
+		return &http.Response{Header: http.Header{}}, nil
+	}
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Error(err)
+		return &http.Response{Header: http.Header{}}, nil
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Error(err)
+	}
+	return resp, data
+}
+
+// mustCall is call for requests that must succeed, on the test's goroutine.
+func mustCall(t *testing.T, ts *httptest.Server, method, path string, body []byte, header map[string]string) (*http.Response, []byte) {
+	t.Helper()
+	resp, data := call(t, ts, method, path, body, header)
+	if resp.StatusCode >= 300 {
+		t.Fatalf("%s %s: %d %s", method, path, resp.StatusCode, data)
+	}
+	return resp, data
+}
+
+// column returns the index of an object row column.
+func column(name string) int {
+	for i, header := range csvmeta.ObjectHeaders {
+		if header == name {
+			return i
+		}
+	}
+	panic("no object column " + name)
+}
+
+// checkBucket verifies that the metadata, the data and the usage of a bucket
+// agree: one latest version per key, stored data for every version matching
+// its row, nothing left in the staging area and a usage that matches a count.
+func checkBucket(t *testing.T, st *storage.Store, bucketName string) {
+	t.Helper()
+	var (
+		versionID    = column("VersionId")
+		isLatest     = column("IsLatest")
+		deleteMarker = column("DeleteMarker")
+		size         = column("Size")
+		etag         = column("ETag")
+		counted      storage.Usage
+	)
+
+	err := st.Meta.Scan(bucketName, "", func(key string, versions [][]string) bool {
+		latest := 0
+		ids := map[string]bool{}
+		for _, row := range versions {
+			if ids[row[versionID]] {
+				t.Errorf("%s: version %s recorded twice", key, row[versionID])
+			}
+			ids[row[versionID]] = true
+			if row[isLatest] == "true" {
+				latest++
+			}
+			if row[deleteMarker] == "true" {
+				continue
+			}
+
+			name := st.Layout.VersionName(bucketName, key, row[versionID])
+			if row[isLatest] == "true" {
+				name = st.Layout.ObjectName(bucketName, key)
+			}
+			content, err := st.Data.Get(name)
+			if err != nil {
+				t.Errorf("%s: data of version %s: %v", key, row[versionID], err)
+				continue
+			}
+			data, _ := io.ReadAll(io.NewSectionReader(content, 0, content.Size()))
+			content.Close()
+			if strconv.Itoa(len(data)) != row[size] {
+				t.Errorf("%s: version %s holds %d bytes, its row says %s", key, row[versionID], len(data), row[size])
+			}
+			if sum := md5.Sum(data); !strings.Contains(row[etag], "-") && hex.EncodeToString(sum[:]) != row[etag] {
+				t.Errorf("%s: data of version %s does not match its ETag", key, row[versionID])
+			}
+			counted.Objects++
+			counted.Bytes += int64(len(data))
+		}
+		if len(versions) > 0 && latest != 1 {
+			t.Errorf("%s: %d latest versions among %d", key, latest, len(versions))
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, usage, _, err := st.BucketQuota(bucketName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage != counted {
+		t.Errorf("usage of %s is %+v, its versions hold %+v", bucketName, usage, counted)
+	}
+
+	st.Data.List(storage.TempDirName+"/", func(name string, _ backend.Info) bool {
+		t.Errorf("left in the staging area: %s", name)
+		return true
+	})
+}
+
+// multipartUpload uploads body as a one-part multipart upload. A second
+// client races it with a new upload of the same part.
+func multipartUpload(t *testing.T, ts *httptest.Server, path string, body []byte) {
+	t.Helper()
+	_, data := call(t, ts, http.MethodPost, path+"?uploads", nil, nil)
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(data, &initiated); err != nil {
+		t.Errorf("initiate upload: %v %s", err, data)
+		return
+	}
+	part := fmt.Sprintf("%s?partNumber=1&uploadId=%s", path, initiated.UploadID)
+	resp, data := call(t, ts, http.MethodPut, part, body, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("part upload: %d %s", resp.StatusCode, data)
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// Racing the completion, the part lands before or finds the upload gone
+		resp, data := call(t, ts, http.MethodPut, part, body, nil)
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+			t.Errorf("part upload racing completion: %d %s", resp.StatusCode, data)
+		}
+	}()
+	complete := fmt.Sprintf("<CompleteMultipartUpload><Part><PartNumber>1</PartNumber><ETag>%s</ETag></Part></CompleteMultipartUpload>", resp.Header.Get("ETag"))
+	resp, data = call(t, ts, http.MethodPost, path+"?uploadId="+initiated.UploadID, []byte(complete), nil)
+	wg.Wait()
+	// The racing part has the same content and so the same ETag
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("complete: %d %s", resp.StatusCode, data)
+	}
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	srv, ts := startServer(t, t.TempDir())
+
+	for _, bucket := range []string{"plain", "versioned"} {
+		mustCall(t, ts, http.MethodPut, "/"+bucket, nil, nil)
+	}
+	mustCall(t, ts, http.MethodPut, "/versioned?versioning", []byte("<VersioningConfiguration><Status>Enabled</Status></VersioningConfiguration>"), nil)
+
+	const workers, rounds = 8, 25
+	keys := []string{"a", "b", "dir/c", "d e"}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(w)))
+			for i := 0; i < rounds; i++ {
+				bucket := []string{"plain", "versioned"}[rng.Intn(2)]
+				path := "/" + bucket + "/" + strings.ReplaceAll(keys[rng.Intn(len(keys))], " ", "%20")
+				body := bytes.Repeat([]byte{byte('a' + w)}, 1+rng.Intn(4096))
+				switch rng.Intn(5) {
+				case 0, 1:
+					call(t, ts, http.MethodPut, path, body, nil)
+				case 2:
+					call(t, ts, http.MethodDelete, path, nil, nil)
+				case 3:
+					// Remove the oldest version, current or not
+					_, data := call(t, ts, http.MethodGet, "/"+bucket+"?versions", nil, nil)
+					var listing struct {
+						Versions []struct {
+							Key       string `xml:"Key"`
+							VersionID string `xml:"VersionId"`
+						} `xml:"Version"`
+					}
+					xml.Unmarshal(data, &listing)
+					if n := len(listing.Versions); n > 0 {
+						v := listing.Versions[n-1]
+						resp, data := call(t, ts, http.MethodDelete, "/"+bucket+"/"+strings.ReplaceAll(v.Key, " ", "%20")+"?versionId="+v.VersionID, nil, nil)
+						if resp.StatusCode >= 500 {
+							t.Errorf("delete version: %d %s", resp.StatusCode, data)
+						}
+					}
+				case 4:
+					multipartUpload(t, ts, path, body)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for _, bucket := range []string{"plain", "versioned"} {
+		checkBucket(t, srv.store, bucket)
+	}
+}
+
+func TestConcurrentCreateOnlyWrites(t *testing.T) {
+	srv, ts := startServer(t, t.TempDir())
+	mustCall(t, ts, http.MethodPut, "/bucket", nil, nil)
+
+	const writers = 16
+	created := make(chan int, writers)
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			resp, data := call(t, ts, http.MethodPut, "/bucket/key", []byte(strconv.Itoa(w)), map[string]string{"If-None-Match": "*"})
+			switch resp.StatusCode {
+			case http.StatusOK:
+				created <- w
+			case http.StatusPreconditionFailed:
+			default:
+				t.Errorf("create-only PUT: %d %s", resp.StatusCode, data)
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(created)
+
+	var winners []int
+	for w := range created {
+		winners = append(winners, w)
+	}
+	if len(winners) != 1 {
+		t.Fatalf("%d create-only PUTs succeeded, want 1", len(winners))
+	}
+	_, data := mustCall(t, ts, http.MethodGet, "/bucket/key", nil, nil)
+	if string(data) != strconv.Itoa(winners[0]) {
+		t.Errorf("object holds %q, the successful PUT wrote %d", data, winners[0])
+	}
+	checkBucket(t, srv.store, "bucket")
+}
@@ -0,0 +1,278 @@
+// Package server runs triple-s as an http.Handler. Every Server owns its
+// storage directory and backends, so several can run in one process, for
+// example behind httptest.NewServer in integration tests.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"triple-s/api"
+	"triple-s/auth"
+	"triple-s/storage"
+	"triple-s/storage/buckets"
+	"triple-s/storage/objects"
+)
+
+// ErrServerClosed is returned by Shutdown once the server was shut down.
+var ErrServerClosed = errors.New("server is shut down")
+
+// Options configures a Server.
+type Options struct {
+	// Dir is the storage directory; it is created if missing. It may be
+	// empty when both the data and the metadata are kept in memory.
+	Dir string
+	// Backend is the data backend: storage.DataBackendFS (the default) or
+	// storage.DataBackendMemory.
+	Backend string
+	// MetaBackend is the metadata backend. It defaults to the journal, or to
+	// memory when Backend is memory.
+	MetaBackend string
+	// Layout places object data within bucket directories: storage.LayoutSharded
+	// (the default) or storage.LayoutFlat. Data stored in the other layout is
+	// moved on startup.
+	Layout string
+	// Credentials are the access keys requests must be signed with. Requests
+	// are not authenticated when it is nil.
+	Credentials *auth.Credentials
+	// LegacyXML lists buckets and objects in the BucketList and ObjectList
+	// formats of older releases instead of the S3 ones.
+	LegacyXML bool
+	// LifecycleInterval is how often the bucket lifecycle rules are applied.
+	// It defaults to DefaultLifecycleInterval; a negative interval disables
+	// them.
+	LifecycleInterval time.Duration
+	// MasterKey seals the data keys of SSE-S3 objects; see sse.LoadKey.
+	// Without it SSE-S3 and bucket default encryption are refused, and
+	// objects stored with them cannot be read.
+	MasterKey []byte
+}
+
+// DefaultLifecycleInterval is how often lifecycle rules run by default.
+const DefaultLifecycleInterval = time.Hour
+
+// Server serves the S3 API for one storage directory.
+type Server struct {
+	handler *api.Handler
+	store   *storage.Store
+	release func() error  // unlocks the storage directory
+	stop    chan struct{} // closed by Shutdown to end background work
+
+	mu       sync.RWMutex
+	inflight sync.WaitGroup
+	closing  bool
+	closed   bool
+}
+
+// New opens the storage directory of opts, finishes the writes a crash cut
+// short and returns a server ready to handle requests. The directory stays
+// locked against other processes until Shutdown.
+func New(opts Options) (*Server, error) {
+	if opts.Backend == "" {
+		opts.Backend = storage.DataBackendFS
+	}
+	if opts.MetaBackend == "" {
+		opts.MetaBackend = storage.MetaBackendJournal
+		if opts.Backend == storage.DataBackendMemory {
+			opts.MetaBackend = storage.MetaBackendMemory
+		}
+	}
+	inMemory := opts.Backend == storage.DataBackendMemory && opts.MetaBackend == storage.MetaBackendMemory
+	if opts.Dir == "" && !inMemory {
+		return nil, errors.New("a storage directory is required unless data and metadata are kept in memory")
+	}
+
+	s := &Server{store: storage.New(opts.Dir), release: func() error { return nil }, stop: make(chan struct{})}
+	s.store.MasterKey = opts.MasterKey
+	if opts.Dir != "" {
+		if err := buckets.CreateRootDirectory(opts.Dir); err != nil {
+			return nil, fmt.Errorf("failed to create storage directory: %w", err)
+		}
+
+		// Keep other processes out of the storage directory while serving it
+		release, err := s.store.LockStorageDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock storage directory: %w", err)
+		}
+		s.release = release
+	}
+
+	if err := s.open(opts); err != nil {
+		s.store.Close()
+		s.release()
+		return nil, err
+	}
+	s.handler = api.NewHandler(s.store, opts.Credentials, opts.LegacyXML)
+
+	interval := opts.LifecycleInterval
+	if interval == 0 {
+		interval = DefaultLifecycleInterval
+	}
+	if interval > 0 {
+		go s.runLifecycle(interval)
+	}
+	return s, nil
+}
+
+// open opens the backends and recovers interrupted writes.
+func (s *Server) open(opts Options) error {
+	if err := s.store.OpenData(opts.Backend); err != nil {
+		return fmt.Errorf("failed to open data store: %w", err)
+	}
+
+	// A new metadata store imports the metadata kept so far
+	if err := s.store.OpenMeta(opts.MetaBackend); err != nil {
+		return fmt.Errorf("failed to load metadata: %w", err)
+	}
+
+	layout := storage.LayoutSharded
+	if opts.Layout != "" {
+		var err error
+		if layout, err = storage.ParseLayout(opts.Layout); err != nil {
+			return err
+		}
+	}
+	stored, err := s.store.StoredLayout()
+	if err != nil {
+		return fmt.Errorf("failed to read storage layout: %w", err)
+	}
+	if stored != "" {
+		s.store.Layout = stored
+	}
+
+	clean, err := s.store.TakeCleanShutdown()
+	if err != nil {
+		return fmt.Errorf("failed to check for a clean shutdown: %w", err)
+	}
+	if stored == "" {
+		// A store without buckets has no usage to drift
+		clean = true
+	}
+
+	// Finish writes cut short by a crash before serving requests
+	if err := objects.RecoverCommits(s.store); err != nil {
+		return fmt.Errorf("failed to recover interrupted writes: %w", err)
+	}
+
+	// Move the data over when the layout changes
+	s.store.Layout = layout
+	switch stored {
+	case layout:
+	case "":
+		err = s.store.SaveLayout(layout)
+	default:
+		err = objects.MigrateLayout(s.store, stored)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to change storage layout: %w", err)
+	}
+
+	// Buckets of older releases are counted once for their quotas, and all
+	// of them after a crash
+	if !clean {
+		fmt.Println("The last shutdown was not clean; counting the usage of every bucket")
+	}
+	if err := objects.CountUsage(s.store, !clean); err != nil {
+		return fmt.Errorf("failed to count bucket usage: %w", err)
+	}
+	return nil
+}
+
+// ServeHTTP handles an S3 request. Requests arriving after Shutdown was
+// called are refused.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	if s.closing {
+		s.mu.RUnlock()
+		api.WriteError(w, r, api.ErrServiceUnavailable)
+		return
+	}
+	s.inflight.Add(1)
+	s.mu.RUnlock()
+	defer s.inflight.Done()
+
+	s.handler.ServeHTTP(w, r)
+}
+
+// runLifecycle applies the lifecycle rules every interval until Shutdown.
+func (s *Server) runLifecycle(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			report, err := s.ApplyLifecycle(now)
+			if err != nil {
+				fmt.Printf("Error applying lifecycle rules: %v\n", err)
+			}
+			if report != (objects.LifecycleReport{}) {
+				fmt.Printf("Lifecycle rules expired %d objects, removed %d delete markers and %d noncurrent versions, and aborted %d uploads\n",
+					report.Expired, report.DeleteMarkers, report.NoncurrentVersions, report.Uploads)
+			}
+		}
+	}
+}
+
+// ApplyLifecycle applies the lifecycle rules of every bucket as of now and
+// reports what they removed. Shutdown waits for it like for a request.
+func (s *Server) ApplyLifecycle(now time.Time) (objects.LifecycleReport, error) {
+	s.mu.RLock()
+	if s.closing {
+		s.mu.RUnlock()
+		return objects.LifecycleReport{}, ErrServerClosed
+	}
+	s.inflight.Add(1)
+	s.mu.RUnlock()
+	defer s.inflight.Done()
+
+	return objects.ApplyLifecycle(s.store, now)
+}
+
+// Shutdown stops accepting requests, waits for the ones in progress and
+// closes the storage. If ctx ends first, Shutdown returns its error and
+// leaves the storage open; it may be called again to keep waiting.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	if !s.closing {
+		close(s.stop)
+	}
+	s.closing = true
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrServerClosed
+	}
+	s.closed = true
+
+	err := s.store.Close()
+	if err == nil {
+		err = s.store.MarkCleanShutdown()
+	}
+	if releaseErr := s.release(); err == nil {
+		err = releaseErr
+	}
+	return err
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"triple-s/storage"
+)
+
+func TestInstancesShareNoState(t *testing.T) {
+	_, first := startServer(t, t.TempDir())
+	_, second := startServer(t, t.TempDir())
+
+	mustCall(t, first, http.MethodPut, "/bucket", nil, nil)
+	mustCall(t, first, http.MethodPut, "/bucket/key", []byte("first"), nil)
+
+	_, data := mustCall(t, second, http.MethodGet, "/", nil, nil)
+	if strings.Contains(string(data), "<Name>bucket</Name>") {
+		t.Errorf("second instance lists the bucket of the first: %s", data)
+	}
+	if resp, data := call(t, second, http.MethodGet, "/bucket/key", nil, nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET on the second instance: %d %s, want 404", resp.StatusCode, data)
+	}
+
+	// The same bucket name is free on the second instance
+	mustCall(t, second, http.MethodPut, "/bucket", nil, nil)
+	mustCall(t, second, http.MethodPut, "/bucket/key", []byte("second"), nil)
+	for ts, want := range map[*httptest.Server]string{first: "first", second: "second"} {
+		if _, data := mustCall(t, ts, http.MethodGet, "/bucket/key", nil, nil); string(data) != want {
+			t.Errorf("object holds %q, want %q", data, want)
+		}
+	}
+}
+
+func TestShutdownReleasesStorageDir(t *testing.T) {
+	dir := t.TempDir()
+	srv, err := New(Options{Dir: dir, LifecycleInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv)
+	mustCall(t, ts, http.MethodPut, "/bucket", nil, nil)
+	mustCall(t, ts, http.MethodPut, "/bucket/key", []byte("kept"), nil)
+
+	if _, err := New(Options{Dir: dir, LifecycleInterval: -1}); !errors.Is(err, storage.ErrStorageLocked) {
+		t.Fatalf("New on a directory in use: got %v, want %v", err, storage.ErrStorageLocked)
+	}
+
+	ts.Close()
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.Shutdown(context.Background()); err != ErrServerClosed {
+		t.Errorf("second Shutdown: got %v, want %v", err, ErrServerClosed)
+	}
+
+	_, ts = startServer(t, dir)
+	if _, data := mustCall(t, ts, http.MethodGet, "/bucket/key", nil, nil); string(data) != "kept" {
+		t.Errorf("object after reopening holds %q, want %q", data, "kept")
+	}
+}
@@ -0,0 +1,43 @@
+// Package backend defines where object data is kept.
+//
+// Content is addressed by slash-separated names relative to the storage
+// root, such as "{bucket}/{key}" or "{bucket}/.versions/{key}/{versionId}".
+// Lookups of a name without content fail with an error matching
+// fs.ErrNotExist.
+package backend
+
+import (
+	"io"
+	"time"
+)
+
+// Info describes stored content.
+type Info struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// Content is an open piece of stored content.
+type Content interface {
+	io.ReaderAt
+	io.Closer
+	Size() int64
+}
+
+// Backend stores object data.
+type Backend interface {
+	// Put stores everything read from r under name, replacing any earlier
+	// content, and returns the number of bytes stored. The content becomes
+	// visible under name only once it is complete and durable.
+	Put(name string, r io.Reader) (int64, error)
+	// Get opens the content stored under name.
+	Get(name string) (Content, error)
+	// Stat describes the content stored under name.
+	Stat(name string) (Info, error)
+	// Delete removes the content stored under name.
+	Delete(name string) error
+	// Rename moves content to a new name, replacing any content there.
+	Rename(from, to string) error
+	// List calls fn for each name starting with prefix until fn returns false.
+	List(prefix string, fn func(name string, info Info) bool) error
+}
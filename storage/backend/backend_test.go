@@ -0,0 +1,154 @@
+package backend_test
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"triple-s/storage/backend"
+	"triple-s/storage/backend/disk"
+	"triple-s/storage/backend/memory"
+)
+
+var errInjected = errors.New("injected failure")
+
+// failingReader returns its data, then an error instead of EOF.
+type failingReader struct{ io.Reader }
+
+func (r failingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF {
+		err = errInjected
+	}
+	return n, err
+}
+
+func read(t *testing.T, b backend.Backend, name string) string {
+	t.Helper()
+	content, err := b.Get(name)
+	if err != nil {
+		t.Fatalf("Get(%s): %v", name, err)
+	}
+	defer content.Close()
+	data, err := io.ReadAll(io.NewSectionReader(content, 0, content.Size()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// list returns the names List visits under prefix, sorted, as the disk
+// backend walks directories before their siblings.
+func list(t *testing.T, b backend.Backend, prefix string) []string {
+	t.Helper()
+	var names []string
+	err := b.List(prefix, func(name string, info backend.Info) bool {
+		names = append(names, name)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// TestBackends runs the same operations against every data backend.
+func TestBackends(t *testing.T) {
+	for name, open := range map[string]func(t *testing.T) backend.Backend{
+		"disk":   func(t *testing.T) backend.Backend { return disk.New(t.TempDir()) },
+		"memory": func(t *testing.T) backend.Backend { return memory.New() },
+	} {
+		t.Run(name, func(t *testing.T) {
+			b := open(t)
+			for _, name := range []string{"bucket/a", "bucket/dir/b", "bucket/dir/sub/c", "bucket-2/d", "other/e"} {
+				if n, err := b.Put(name, strings.NewReader(name)); err != nil || n != int64(len(name)) {
+					t.Fatalf("Put(%s) = %d, %v", name, n, err)
+				}
+			}
+			if got := read(t, b, "bucket/dir/b"); got != "bucket/dir/b" {
+				t.Errorf("Get(bucket/dir/b) = %q", got)
+			}
+			if info, err := b.Stat("bucket/a"); err != nil || info.Size != 8 || info.ModTime.IsZero() {
+				t.Errorf("Stat(bucket/a) = %+v, %v", info, err)
+			}
+
+			// Missing names, including directories, do not exist
+			for _, name := range []string{"missing", "bucket/dir", "bucket/missing/x"} {
+				if _, err := b.Get(name); !errors.Is(err, fs.ErrNotExist) {
+					t.Errorf("Get(%s) = %v, want fs.ErrNotExist", name, err)
+				}
+				if _, err := b.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+					t.Errorf("Stat(%s) = %v, want fs.ErrNotExist", name, err)
+				}
+			}
+			if err := b.Delete("missing"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Delete(missing) = %v, want fs.ErrNotExist", err)
+			}
+			if err := b.Rename("missing", "bucket/x"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Rename(missing) = %v, want fs.ErrNotExist", err)
+			}
+
+			for _, tt := range []struct {
+				prefix string
+				want   []string
+			}{
+				{"bucket/", []string{"bucket/a", "bucket/dir/b", "bucket/dir/sub/c"}},
+				{"bucket", []string{"bucket-2/d", "bucket/a", "bucket/dir/b", "bucket/dir/sub/c"}},
+				{"bucket/dir/", []string{"bucket/dir/b", "bucket/dir/sub/c"}},
+				{"bucket/d", []string{"bucket/dir/b", "bucket/dir/sub/c"}},
+				{"none/", nil},
+			} {
+				if got := list(t, b, tt.prefix); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("List(%q) = %v, want %v", tt.prefix, got, tt.want)
+				}
+			}
+			calls := 0
+			b.List("bucket/", func(name string, info backend.Info) bool {
+				calls++
+				return false
+			})
+			if calls != 1 {
+				t.Errorf("List went on after fn returned false: %d calls", calls)
+			}
+
+			// Put and Rename replace what is there
+			if _, err := b.Put("bucket/a", strings.NewReader("new")); err != nil {
+				t.Fatal(err)
+			}
+			if got := read(t, b, "bucket/a"); got != "new" {
+				t.Errorf("Get after replacing = %q", got)
+			}
+			if err := b.Rename("bucket/dir/sub/c", "bucket/a"); err != nil {
+				t.Fatal(err)
+			}
+			if got := read(t, b, "bucket/a"); got != "bucket/dir/sub/c" {
+				t.Errorf("Get after renaming over = %q", got)
+			}
+			if err := b.Rename("bucket/a", "bucket/new/dir/a"); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.Delete("bucket/dir/b"); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := list(t, b, "bucket/"), []string{"bucket/new/dir/a"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("List after renames and deletes = %v, want %v", got, want)
+			}
+
+			// A failed Put stores nothing
+			if _, err := b.Put("bucket/failed", failingReader{strings.NewReader("partial")}); !errors.Is(err, errInjected) {
+				t.Errorf("Put of a failing reader = %v, want %v", err, errInjected)
+			}
+			if _, err := b.Stat("bucket/failed"); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Stat after a failed Put = %v, want fs.ErrNotExist", err)
+			}
+			if got := list(t, b, ""); !reflect.DeepEqual(got, []string{"bucket-2/d", "bucket/new/dir/a", "other/e"}) {
+				t.Errorf("List of everything = %v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+// Package disk stores object data as files under a root directory.
+package disk
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"triple-s/storage/backend"
+)
+
+// stagingDir is where Put writes content before renaming it into place.
+const stagingDir = ".tmp"
+
+// Store keeps each name as the file of the same relative path under root.
+type Store struct {
+	root string
+}
+
+// New returns a store rooted at dir.
+func New(dir string) *Store {
+	return &Store{root: dir}
+}
+
+func (s *Store) path(name string) string {
+	return filepath.Join(s.root, filepath.FromSlash(name))
+}
+
+type file struct {
+	*os.File
+	size int64
+}
+
+func (f *file) Size() int64 { return f.size }
+
+// Put writes r to a staging file, flushes it to disk and renames it to name.
+func (s *Store) Put(name string, r io.Reader) (int64, error) {
+	var tmp *os.File
+	err := inDir(filepath.Join(s.root, stagingDir), func() (err error) {
+		tmp, err = os.CreateTemp(filepath.Join(s.root, stagingDir), "put-*")
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0o644)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	target := s.path(name)
+	if err := inDir(filepath.Dir(target), func() error { return os.Rename(tmp.Name(), target) }); err != nil {
+		return 0, err
+	}
+	syncDir(filepath.Dir(target))
+	return written, nil
+}
+
+// Get opens the file of name.
+func (s *Store) Get(name string) (backend.Content, error) {
+	f, err := os.Open(s.path(name))
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &file{File: f, size: info.Size()}, nil
+}
+
+// Stat describes the file of name.
+func (s *Store) Stat(name string) (backend.Info, error) {
+	info, err := os.Stat(s.path(name))
+	if err != nil {
+		return backend.Info{}, err
+	}
+	if info.IsDir() {
+		return backend.Info{}, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return backend.Info{Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// Delete removes the file of name and the directories it leaves empty.
+func (s *Store) Delete(name string) error {
+	if err := os.Remove(s.path(name)); err != nil {
+		return err
+	}
+	s.prune(filepath.Dir(s.path(name)))
+	return nil
+}
+
+// Rename moves the file of from to the path of to.
+func (s *Store) Rename(from, to string) error {
+	target := s.path(to)
+	if err := inDir(filepath.Dir(target), func() error { return os.Rename(s.path(from), target) }); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(target))
+	s.prune(filepath.Dir(s.path(from)))
+	return nil
+}
+
+// List walks the directories that can hold names starting with prefix.
+func (s *Store) List(prefix string, fn func(name string, info backend.Info) bool) error {
+	start := s.root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		start = s.path(prefix[:i])
+	}
+
+	err := filepath.WalkDir(start, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(s.root, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			// Skip directories whose names cannot start with prefix.
+			if path != start && !strings.HasPrefix(name+"/", prefix) && !strings.HasPrefix(prefix, name+"/") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // Removed while listing
+		}
+		if !fn(name, backend.Info{Size: info.Size(), ModTime: info.ModTime()}) {
+			return fs.SkipAll
+		}
+		return nil
+	})
+	return err
+}
+
+// inDir creates dir and runs fn, which creates an entry in it. A concurrent
+// prune may remove dir again in between, so fn is retried while it fails
+// because a directory is missing.
+func inDir(dir string, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		err := fn()
+		if !os.IsNotExist(err) || attempt == 3 {
+			return err
+		}
+	}
+}
+
+// prune removes dir and its parents up to the root while they are empty.
+// The staging directory is kept, as nearly every write passes through it.
+func (s *Store) prune(dir string) {
+	staging := filepath.Join(s.root, stagingDir)
+	for dir != s.root && dir != staging && strings.HasPrefix(dir, s.root) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// syncDir flushes a directory so that renames into it survive a crash.
+// It is best effort: not every platform can sync directories.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
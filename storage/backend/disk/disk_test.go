@@ -0,0 +1,50 @@
+package disk
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDeleteAndRenamePruneEmptyDirectories(t *testing.T) {
+	root := t.TempDir()
+	s := New(root)
+	for _, name := range []string{"bucket/a/b/c", "bucket/a/kept", "bucket/x/y/z"} {
+		if _, err := s.Put(name, strings.NewReader(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exists := func(rel string) bool {
+		_, err := os.Stat(filepath.Join(root, rel))
+		return err == nil
+	}
+
+	if err := s.Delete("bucket/a/b/c"); err != nil {
+		t.Fatal(err)
+	}
+	if exists("bucket/a/b") || !exists("bucket/a") {
+		t.Error("Delete did not prune exactly the directories it emptied")
+	}
+	if err := s.Rename("bucket/x/y/z", "bucket/a/z"); err != nil {
+		t.Fatal(err)
+	}
+	if exists("bucket/x") {
+		t.Error("Rename left the directories it emptied")
+	}
+	if err := s.Delete("bucket/a/kept"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("bucket/a/z"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The root and the staging directory are kept
+	if !exists(".") || !exists(stagingDir) || exists("bucket") {
+		t.Error("pruning went past the empty bucket directory or removed the root or staging directory")
+	}
+	entries, err := os.ReadDir(filepath.Join(root, stagingDir))
+	if err != nil || len(entries) != 0 {
+		t.Errorf("staging directory holds %v, %v", entries, err)
+	}
+}
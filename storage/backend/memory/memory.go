@@ -0,0 +1,127 @@
+// Package memory keeps object data in memory. Everything is lost when the
+// process exits, which suits short-lived test servers.
+package memory
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"triple-s/storage/backend"
+)
+
+type entry struct {
+	data    []byte
+	modTime time.Time
+}
+
+// Store keeps the content of each name in a byte slice.
+type Store struct {
+	mu      sync.RWMutex
+	entries map[string]*entry
+}
+
+// New returns an empty store.
+func New() *Store {
+	return &Store{entries: map[string]*entry{}}
+}
+
+func notExist(op, name string) error {
+	return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+type content struct {
+	*bytes.Reader
+}
+
+func (content) Close() error { return nil }
+
+// Put reads r to the end and stores the bytes under name.
+func (s *Store) Put(name string, r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[name] = &entry{data: data, modTime: time.Now()}
+	return int64(len(data)), nil
+}
+
+// Get returns a reader over the bytes of name. Stored bytes are never
+// changed, so the reader stays valid after the name is replaced.
+func (s *Store) Get(name string) (backend.Content, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e, ok := s.entries[name]
+	if !ok {
+		return nil, notExist("open", name)
+	}
+	return content{bytes.NewReader(e.data)}, nil
+}
+
+// Stat describes the bytes of name.
+func (s *Store) Stat(name string) (backend.Info, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e, ok := s.entries[name]
+	if !ok {
+		return backend.Info{}, notExist("stat", name)
+	}
+	return backend.Info{Size: int64(len(e.data)), ModTime: e.modTime}, nil
+}
+
+// Delete drops the bytes of name.
+func (s *Store) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.entries[name]; !ok {
+		return notExist("remove", name)
+	}
+	delete(s.entries, name)
+	return nil
+}
+
+// Rename moves the bytes of from to to.
+func (s *Store) Rename(from, to string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[from]
+	if !ok {
+		return notExist("rename", from)
+	}
+	delete(s.entries, from)
+	s.entries[to] = e
+	return nil
+}
+
+// List calls fn for the names starting with prefix in lexical order.
+func (s *Store) List(prefix string, fn func(name string, info backend.Info) bool) error {
+	s.mu.RLock()
+	var names []string
+	infos := map[string]backend.Info{}
+	for name, e := range s.entries {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+			infos[name] = backend.Info{Size: int64(len(e.data)), ModTime: e.modTime}
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Strings(names)
+	for _, name := range names {
+		if !fn(name, infos[name]) {
+			break
+		}
+	}
+	return nil
+}
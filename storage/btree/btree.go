@@ -0,0 +1,732 @@
+// Package btree is an embedded, single-file key-value store that keeps its
+// keys in a copy-on-write B+tree.
+//
+// Updates never overwrite committed data: the nodes a transaction changes are
+// appended to the file, and a new root is then recorded in one of two
+// checksummed meta slots at the start of the file. A crash at any point leaves
+// the previous root intact. The file is rewritten once it has grown well
+// beyond its size after the last rewrite.
+package btree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const (
+	magic      = 0x74737362 // "tssb"
+	slotSize   = 64
+	headerSize = 2 * slotSize
+
+	// maxKeys is the number of keys a node holds before it is split.
+	maxKeys = 64
+
+	// maxCachedNodes bounds the cache of decoded nodes.
+	maxCachedNodes = 16384
+
+	// The file is compacted once it is compactFactor times its size after the
+	// last compaction, and at least compactMinSize.
+	compactFactor  = 4
+	compactMinSize = 16 << 20
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrCorrupt is returned when the file holds no valid meta slot or a node
+// fails its checksum.
+var ErrCorrupt = errors.New("btree: corrupt file")
+
+// DB is an open B+tree file. It is safe for concurrent use: reads run in
+// parallel, updates one at a time.
+type DB struct {
+	mu   sync.RWMutex
+	path string
+	file *os.File
+	meta meta
+
+	cacheMu sync.Mutex
+	cache   map[int64]*node
+}
+
+// meta describes the committed state of the file.
+type meta struct {
+	seq   uint64
+	root  int64 // offset of the root node; 0 for an empty tree
+	size  int64 // end of the committed data
+	base  int64 // size right after the last compaction
+	count int64 // number of keys
+}
+
+// node is a B+tree node. Branch keys separate the children: keys[i] is the
+// smallest key under kids[i+1].
+type node struct {
+	off   int64 // file offset; 0 until the node is written
+	fresh bool  // created by the running transaction and may be changed in place
+	leaf  bool
+	keys  [][]byte
+	vals  [][]byte // leaves only
+	kids  []ref    // branches only
+}
+
+// ref points to a node on disk, or to a node not written yet.
+type ref struct {
+	off int64
+	n   *node
+}
+
+func (r ref) empty() bool { return r.off == 0 && r.n == nil }
+
+// Open opens the B+tree file at path, creating it when it does not exist.
+func Open(path string) (*DB, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{path: path, file: file, cache: map[int64]*node{}}
+	if err := db.load(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// load reads the newest valid meta slot, or initializes an empty file.
+func (db *DB) load() error {
+	info, err := db.file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		if _, err := db.file.WriteAt(make([]byte, headerSize), 0); err != nil {
+			return err
+		}
+		return db.writeMeta(meta{size: headerSize, base: headerSize})
+	}
+
+	header := make([]byte, headerSize)
+	if _, err := db.file.ReadAt(header, 0); err != nil {
+		return ErrCorrupt
+	}
+	found := false
+	for i := 0; i < 2; i++ {
+		if m, ok := decodeMeta(header[i*slotSize : (i+1)*slotSize]); ok && (!found || m.seq > db.meta.seq) {
+			db.meta, found = m, true
+		}
+	}
+	if !found || db.meta.size > info.Size() {
+		return ErrCorrupt
+	}
+
+	// Drop the nodes of a commit that never recorded its root.
+	if info.Size() > db.meta.size {
+		return db.file.Truncate(db.meta.size)
+	}
+	return nil
+}
+
+func decodeMeta(slot []byte) (meta, bool) {
+	if binary.BigEndian.Uint32(slot[0:4]) != magic || binary.BigEndian.Uint32(slot[44:48]) != crc32.Checksum(slot[:44], crcTable) {
+		return meta{}, false
+	}
+	return meta{
+		seq:   binary.BigEndian.Uint64(slot[4:12]),
+		root:  int64(binary.BigEndian.Uint64(slot[12:20])),
+		size:  int64(binary.BigEndian.Uint64(slot[20:28])),
+		base:  int64(binary.BigEndian.Uint64(slot[28:36])),
+		count: int64(binary.BigEndian.Uint64(slot[36:44])),
+	}, true
+}
+
+// writeMeta records m in the slot after the current one and flushes it.
+func (db *DB) writeMeta(m meta) error {
+	m.seq = db.meta.seq + 1
+
+	slot := make([]byte, slotSize)
+	binary.BigEndian.PutUint32(slot[0:4], magic)
+	binary.BigEndian.PutUint64(slot[4:12], m.seq)
+	binary.BigEndian.PutUint64(slot[12:20], uint64(m.root))
+	binary.BigEndian.PutUint64(slot[20:28], uint64(m.size))
+	binary.BigEndian.PutUint64(slot[28:36], uint64(m.base))
+	binary.BigEndian.PutUint64(slot[36:44], uint64(m.count))
+	binary.BigEndian.PutUint32(slot[44:48], crc32.Checksum(slot[:44], crcTable))
+
+	if _, err := db.file.WriteAt(slot, int64(m.seq%2)*slotSize); err != nil {
+		return err
+	}
+	if err := db.file.Sync(); err != nil {
+		return err
+	}
+	db.meta = m
+	return nil
+}
+
+// Close closes the file. The DB must not be used afterwards.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.file.Close()
+}
+
+// Len returns the number of keys.
+func (db *DB) Len() int64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.meta.count
+}
+
+// Get returns the value stored under key.
+func (db *DB) Get(key []byte) ([]byte, bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.readTx().Get(key)
+}
+
+// Ascend calls fn for each key of at least from, in order, until fn returns
+// false. fn must not modify the key or value or call back into the DB.
+func (db *DB) Ascend(from []byte, fn func(key, value []byte) bool) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.readTx().Ascend(from, fn)
+}
+
+// Update runs fn in a transaction and commits its changes durably when fn
+// returns nil. Nothing is written when fn fails.
+func (db *DB) Update(fn func(tx *Tx) error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tx := db.readTx()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := db.commit(tx); err != nil {
+		return err
+	}
+
+	if db.meta.size >= compactMinSize && db.meta.size > compactFactor*db.meta.base {
+		if err := db.compact(); err != nil {
+			// The update itself is committed; compaction is retried later.
+			fmt.Printf("Error compacting %s: %v\n", db.path, err)
+		}
+	}
+	return nil
+}
+
+func (db *DB) readTx() *Tx {
+	return &Tx{db: db, root: ref{off: db.meta.root}, count: db.meta.count}
+}
+
+// commit appends the nodes changed by tx and records the new root.
+func (db *DB) commit(tx *Tx) error {
+	if tx.root.n == nil && tx.root.off == db.meta.root {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	var written []*node
+	root, err := db.writeNode(tx.root, &buf, &written)
+	if err != nil {
+		return err
+	}
+	if _, err := db.file.WriteAt(buf.Bytes(), db.meta.size); err != nil {
+		return err
+	}
+	if err := db.file.Sync(); err != nil {
+		return err
+	}
+	next := db.meta
+	next.root, next.size, next.count = root, db.meta.size+int64(buf.Len()), tx.count
+	if err := db.writeMeta(next); err != nil {
+		return err
+	}
+
+	db.cacheMu.Lock()
+	if len(db.cache)+len(written) > maxCachedNodes {
+		db.cache = map[int64]*node{}
+	}
+	for _, n := range written {
+		db.cache[n.off] = n
+	}
+	db.cacheMu.Unlock()
+	return nil
+}
+
+// writeNode encodes the unwritten nodes under r into buf, children first,
+// and returns the offset r will have once buf is appended to the file.
+func (db *DB) writeNode(r ref, buf *bytes.Buffer, written *[]*node) (int64, error) {
+	if r.n == nil {
+		return r.off, nil
+	}
+	n := r.n
+	if !n.fresh {
+		return n.off, nil
+	}
+
+	for i, kid := range n.kids {
+		off, err := db.writeNode(kid, buf, written)
+		if err != nil {
+			return 0, err
+		}
+		n.kids[i] = ref{off: off}
+	}
+
+	n.off = db.meta.size + int64(buf.Len())
+	n.fresh = false
+	buf.Write(encodeNode(n))
+	*written = append(*written, n)
+	return n.off, nil
+}
+
+// readNode loads the node at off, from the cache when possible.
+func (db *DB) readNode(off int64) (*node, error) {
+	db.cacheMu.Lock()
+	n, ok := db.cache[off]
+	db.cacheMu.Unlock()
+	if ok {
+		return n, nil
+	}
+
+	var header [8]byte
+	if _, err := db.file.ReadAt(header[:], off); err != nil {
+		return nil, err
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(header[0:4]))
+	if off+int64(len(header)+len(payload)) > db.meta.size {
+		return nil, ErrCorrupt
+	}
+	if _, err := db.file.ReadAt(payload, off+int64(len(header))); err != nil {
+		return nil, err
+	}
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, ErrCorrupt
+	}
+	n, err := decodeNode(payload)
+	if err != nil {
+		return nil, err
+	}
+	n.off = off
+
+	db.cacheMu.Lock()
+	if len(db.cache) >= maxCachedNodes {
+		db.cache = map[int64]*node{}
+	}
+	db.cache[off] = n
+	db.cacheMu.Unlock()
+	return n, nil
+}
+
+// Nodes are framed as a 4-byte payload length and the CRC-32C of the
+// payload. The payload is a kind byte, the key count and the uvarint-length
+// prefixed keys, followed by the values of a leaf or the child offsets of a
+// branch.
+const (
+	kindLeaf   = 1
+	kindBranch = 2
+)
+
+func encodeNode(n *node) []byte {
+	payload := []byte{kindBranch}
+	if n.leaf {
+		payload[0] = kindLeaf
+	}
+	payload = binary.AppendUvarint(payload, uint64(len(n.keys)))
+	for _, key := range n.keys {
+		payload = binary.AppendUvarint(payload, uint64(len(key)))
+		payload = append(payload, key...)
+	}
+	if n.leaf {
+		for _, val := range n.vals {
+			payload = binary.AppendUvarint(payload, uint64(len(val)))
+			payload = append(payload, val...)
+		}
+	} else {
+		for _, kid := range n.kids {
+			payload = binary.AppendUvarint(payload, uint64(kid.off))
+		}
+	}
+
+	frame := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:8], crc32.Checksum(payload, crcTable))
+	return append(frame, payload...)
+}
+
+func decodeNode(payload []byte) (*node, error) {
+	r := bytes.NewReader(payload)
+	kind, err := r.ReadByte()
+	if err != nil || (kind != kindLeaf && kind != kindBranch) {
+		return nil, ErrCorrupt
+	}
+	n := &node{leaf: kind == kindLeaf}
+
+	readBytes := func() ([]byte, error) {
+		size, err := binary.ReadUvarint(r)
+		if err != nil || size > uint64(r.Len()) {
+			return nil, ErrCorrupt
+		}
+		b := make([]byte, size)
+		r.Read(b)
+		return b, nil
+	}
+
+	count, err := binary.ReadUvarint(r)
+	if err != nil || count > uint64(len(payload)) {
+		return nil, ErrCorrupt
+	}
+	for i := uint64(0); i < count; i++ {
+		key, err := readBytes()
+		if err != nil {
+			return nil, err
+		}
+		n.keys = append(n.keys, key)
+	}
+	if n.leaf {
+		for i := uint64(0); i < count; i++ {
+			val, err := readBytes()
+			if err != nil {
+				return nil, err
+			}
+			n.vals = append(n.vals, val)
+		}
+		return n, nil
+	}
+	for i := uint64(0); i <= count; i++ {
+		off, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, ErrCorrupt
+		}
+		n.kids = append(n.kids, ref{off: int64(off)})
+	}
+	return n, nil
+}
+
+// compact rewrites the live keys into a new file and swaps it in with a
+// rename. The caller holds the write lock.
+func (db *DB) compact() error {
+	tmpPath := db.path + ".compact"
+	os.Remove(tmpPath)
+	dst, err := Open(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	// The copy must not trigger a compaction of its own.
+	dst.meta.base = db.meta.size
+
+	// Copy in batches so the new tree is never held in memory as a whole.
+	const batch = 4096
+	var from []byte
+	for {
+		var keys, vals [][]byte
+		err := db.readTx().Ascend(from, func(key, value []byte) bool {
+			if from != nil && bytes.Equal(key, from) {
+				return true
+			}
+			keys, vals = append(keys, key), append(vals, value)
+			return len(keys) < batch
+		})
+		if err == nil && len(keys) > 0 {
+			err = dst.Update(func(tx *Tx) error {
+				for i := range keys {
+					if err := tx.Put(keys[i], vals[i]); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		}
+		if err != nil {
+			dst.Close()
+			return err
+		}
+		if len(keys) < batch {
+			break
+		}
+		from = keys[len(keys)-1]
+	}
+
+	next := dst.meta
+	next.base = next.size
+	if err := dst.writeMeta(next); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, db.path); err != nil {
+		return err
+	}
+	if dir, err := os.Open(filepath.Dir(db.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	file, err := os.OpenFile(db.path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	db.file.Close()
+	db.file = file
+	db.meta = meta{}
+	db.cache = map[int64]*node{}
+	return db.load()
+}
+
+// Tx reads and changes the tree. Changes are visible to the transaction
+// right away and to everyone else once it commits.
+type Tx struct {
+	db    *DB
+	root  ref
+	count int64
+}
+
+// load returns the node r points to.
+func (tx *Tx) load(r ref) (*node, error) {
+	if r.n != nil {
+		return r.n, nil
+	}
+	return tx.db.readNode(r.off)
+}
+
+// mutable returns a node the transaction may change in place: r's node when
+// the transaction created it, a copy otherwise.
+func (tx *Tx) mutable(r ref) (*node, error) {
+	n, err := tx.load(r)
+	if err != nil || n.fresh {
+		return n, err
+	}
+	return &node{
+		fresh: true,
+		leaf:  n.leaf,
+		keys:  append([][]byte(nil), n.keys...),
+		vals:  append([][]byte(nil), n.vals...),
+		kids:  append([]ref(nil), n.kids...),
+	}, nil
+}
+
+// childIndex returns the child of a branch that holds key.
+func childIndex(keys [][]byte, key []byte) int {
+	return sort.Search(len(keys), func(i int) bool { return bytes.Compare(keys[i], key) > 0 })
+}
+
+// leafIndex returns the position of the first key of a leaf not below key.
+func leafIndex(keys [][]byte, key []byte) int {
+	return sort.Search(len(keys), func(i int) bool { return bytes.Compare(keys[i], key) >= 0 })
+}
+
+// Get returns the value stored under key.
+func (tx *Tx) Get(key []byte) ([]byte, bool, error) {
+	r := tx.root
+	for !r.empty() {
+		n, err := tx.load(r)
+		if err != nil {
+			return nil, false, err
+		}
+		if !n.leaf {
+			r = n.kids[childIndex(n.keys, key)]
+			continue
+		}
+		if i := leafIndex(n.keys, key); i < len(n.keys) && bytes.Equal(n.keys[i], key) {
+			return n.vals[i], true, nil
+		}
+		break
+	}
+	return nil, false, nil
+}
+
+// Ascend calls fn for each key of at least from, in order, until fn returns false.
+func (tx *Tx) Ascend(from []byte, fn func(key, value []byte) bool) error {
+	if tx.root.empty() {
+		return nil
+	}
+	_, err := tx.ascend(tx.root, from, fn)
+	return err
+}
+
+func (tx *Tx) ascend(r ref, from []byte, fn func(key, value []byte) bool) (bool, error) {
+	n, err := tx.load(r)
+	if err != nil {
+		return false, err
+	}
+	if n.leaf {
+		for i := leafIndex(n.keys, from); i < len(n.keys); i++ {
+			if !fn(n.keys[i], n.vals[i]) {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+	for i := childIndex(n.keys, from); i < len(n.kids); i++ {
+		if more, err := tx.ascend(n.kids[i], from, fn); !more || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Put stores value under key, replacing any earlier value.
+func (tx *Tx) Put(key, value []byte) error {
+	key, value = append([]byte(nil), key...), append([]byte(nil), value...)
+	if tx.root.empty() {
+		tx.root = ref{n: &node{fresh: true, leaf: true, keys: [][]byte{key}, vals: [][]byte{value}}}
+		tx.count++
+		return nil
+	}
+
+	n, sep, right, err := tx.insert(tx.root, key, value)
+	if err != nil {
+		return err
+	}
+	if right != nil {
+		n = &node{fresh: true, keys: [][]byte{sep}, kids: []ref{{n: n}, {n: right}}}
+	}
+	tx.root = ref{n: n}
+	return nil
+}
+
+// insert adds key to the subtree under r. When the node overflows it is
+// split, and the new right sibling is returned with its separator.
+func (tx *Tx) insert(r ref, key, value []byte) (*node, []byte, *node, error) {
+	n, err := tx.mutable(r)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if n.leaf {
+		i := leafIndex(n.keys, key)
+		if i < len(n.keys) && bytes.Equal(n.keys[i], key) {
+			n.vals[i] = value
+		} else {
+			n.keys = insertAt(n.keys, i, key)
+			n.vals = insertAt(n.vals, i, value)
+			tx.count++
+		}
+	} else {
+		i := childIndex(n.keys, key)
+		child, sep, right, err := tx.insert(n.kids[i], key, value)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		n.kids[i] = ref{n: child}
+		if right != nil {
+			n.keys = insertAt(n.keys, i, sep)
+			n.kids = insertAt(n.kids, i+1, ref{n: right})
+		}
+	}
+
+	if len(n.keys) <= maxKeys {
+		return n, nil, nil, nil
+	}
+	mid := len(n.keys) / 2
+	right := &node{fresh: true, leaf: n.leaf}
+	if n.leaf {
+		right.keys = append([][]byte(nil), n.keys[mid:]...)
+		right.vals = append([][]byte(nil), n.vals[mid:]...)
+		n.keys, n.vals = n.keys[:mid], n.vals[:mid]
+		return n, right.keys[0], right, nil
+	}
+	sep := n.keys[mid]
+	right.keys = append([][]byte(nil), n.keys[mid+1:]...)
+	right.kids = append([]ref(nil), n.kids[mid+1:]...)
+	n.keys, n.kids = n.keys[:mid], n.kids[:mid+1]
+	return n, sep, right, nil
+}
+
+// Delete removes key and reports whether it was present.
+func (tx *Tx) Delete(key []byte) (bool, error) {
+	if tx.root.empty() {
+		return false, nil
+	}
+	n, removed, err := tx.remove(tx.root, key)
+	if err != nil || !removed {
+		return false, err
+	}
+	tx.count--
+
+	switch {
+	case isEmpty(n):
+		tx.root = ref{}
+	case !n.leaf && len(n.kids) == 1:
+		tx.root = n.kids[0]
+	default:
+		tx.root = ref{n: n}
+	}
+	return true, nil
+}
+
+// remove deletes key from the subtree under r. Nodes that become empty are
+// dropped from their parent; underfull nodes are left as they are until the
+// next compaction rebuilds the tree.
+func (tx *Tx) remove(r ref, key []byte) (*node, bool, error) {
+	n, err := tx.load(r)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if n.leaf {
+		i := leafIndex(n.keys, key)
+		if i == len(n.keys) || !bytes.Equal(n.keys[i], key) {
+			return nil, false, nil
+		}
+		if n, err = tx.mutable(r); err != nil {
+			return nil, false, err
+		}
+		n.keys = removeAt(n.keys, i)
+		n.vals = removeAt(n.vals, i)
+		return n, true, nil
+	}
+
+	i := childIndex(n.keys, key)
+	child, removed, err := tx.remove(n.kids[i], key)
+	if err != nil || !removed {
+		return nil, removed, err
+	}
+	if n, err = tx.mutable(r); err != nil {
+		return nil, false, err
+	}
+	if !isEmpty(child) {
+		n.kids[i] = ref{n: child}
+		return n, true, nil
+	}
+
+	n.kids = removeAt(n.kids, i)
+	if len(n.keys) > 0 {
+		n.keys = removeAt(n.keys, i-boolToInt(i > 0))
+	}
+	return n, true, nil
+}
+
+func isEmpty(n *node) bool {
+	if n.leaf {
+		return len(n.keys) == 0
+	}
+	return len(n.kids) == 0
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func insertAt[T any](s []T, i int, v T) []T {
+	var zero T
+	s = append(s, zero)
+	copy(s[i+1:], s[i:])
+	s[i] = v
+	return s
+}
+
+func removeAt[T any](s []T, i int) []T {
+	return append(s[:i], s[i+1:]...)
+}
@@ -0,0 +1,221 @@
+package btree
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openTemp(t *testing.T) (*DB, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.btree")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, path
+}
+
+func reopen(t *testing.T, db *DB, path string) *DB {
+	t.Helper()
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// checkContents compares the keys and values of db, in order, with want.
+func checkContents(t *testing.T, db *DB, want map[string]string) {
+	t.Helper()
+	if db.Len() != int64(len(want)) {
+		t.Errorf("Len = %d, want %d", db.Len(), len(want))
+	}
+	seen, last := 0, ""
+	err := db.Ascend(nil, func(key, value []byte) bool {
+		if seen > 0 && string(key) <= last {
+			t.Errorf("key %q after %q", key, last)
+		}
+		if want[string(key)] != string(value) {
+			t.Errorf("%q = %q, want %q", key, value, want[string(key)])
+		}
+		seen, last = seen+1, string(key)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen != len(want) {
+		t.Errorf("Ascend saw %d keys, want %d", seen, len(want))
+	}
+}
+
+func TestPutDeleteAscend(t *testing.T) {
+	db, path := openTemp(t)
+	want := map[string]string{}
+
+	// Enough keys in random order to split the root a few levels deep
+	rnd := rand.New(rand.NewSource(1))
+	keys := rnd.Perm(20000)
+	for start := 0; start < len(keys); start += 1000 {
+		err := db.Update(func(tx *Tx) error {
+			for _, i := range keys[start : start+1000] {
+				key, value := fmt.Sprintf("key%06d", i), fmt.Sprintf("value%d", i)
+				if err := tx.Put([]byte(key), []byte(value)); err != nil {
+					return err
+				}
+				want[key] = value
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkContents(t, db, want)
+
+	// Remove every other key and replace a few values
+	err := db.Update(func(tx *Tx) error {
+		for i := 0; i < len(keys); i += 2 {
+			key := fmt.Sprintf("key%06d", i)
+			if ok, err := tx.Delete([]byte(key)); err != nil || !ok {
+				return fmt.Errorf("Delete(%s) = %v, %v", key, ok, err)
+			}
+			delete(want, key)
+		}
+		if ok, err := tx.Delete([]byte("missing")); err != nil || ok {
+			return fmt.Errorf("Delete(missing) = %v, %v", ok, err)
+		}
+		for i := 1; i < 100; i += 2 {
+			key := fmt.Sprintf("key%06d", i)
+			if err := tx.Put([]byte(key), []byte("replaced")); err != nil {
+				return err
+			}
+			want[key] = "replaced"
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkContents(t, db, want)
+
+	// Ascend starts at from, which need not be a key
+	var first string
+	db.Ascend([]byte("key010000"), func(key, value []byte) bool {
+		first = string(key)
+		return false
+	})
+	if first != "key010001" {
+		t.Errorf("first key from key010000 = %q, want key010001", first)
+	}
+
+	db = reopen(t, db, path)
+	checkContents(t, db, want)
+	if value, ok, err := db.Get([]byte("key000001")); err != nil || !ok || string(value) != "replaced" {
+		t.Errorf("Get(key000001) = %q, %v, %v", value, ok, err)
+	}
+	if _, ok, err := db.Get([]byte("key000002")); err != nil || ok {
+		t.Errorf("Get of a deleted key = %v, %v", ok, err)
+	}
+}
+
+func TestFailedUpdateWritesNothing(t *testing.T) {
+	db, path := openTemp(t)
+	if err := db.Update(func(tx *Tx) error { return tx.Put([]byte("kept"), []byte("1")) }); err != nil {
+		t.Fatal(err)
+	}
+	failed := errors.New("failed")
+	err := db.Update(func(tx *Tx) error {
+		tx.Put([]byte("dropped"), []byte("2"))
+		tx.Delete([]byte("kept"))
+		return failed
+	})
+	if err != failed {
+		t.Fatalf("Update = %v, want %v", err, failed)
+	}
+	checkContents(t, db, map[string]string{"kept": "1"})
+	checkContents(t, reopen(t, db, path), map[string]string{"kept": "1"})
+}
+
+func TestTornCommitKeepsPreviousRoot(t *testing.T) {
+	db, path := openTemp(t)
+	if err := db.Update(func(tx *Tx) error { return tx.Put([]byte("first"), []byte("1")) }); err != nil {
+		t.Fatal(err)
+	}
+	size := db.meta.size
+	if err := db.Update(func(tx *Tx) error { return tx.Put([]byte("second"), []byte("2")) }); err != nil {
+		t.Fatal(err)
+	}
+
+	// The meta slot of the second commit is torn
+	slot := int64(db.meta.seq%2) * slotSize
+	if _, err := db.file.WriteAt([]byte("torn"), slot+8); err != nil {
+		t.Fatal(err)
+	}
+	db = reopen(t, db, path)
+	checkContents(t, db, map[string]string{"first": "1"})
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != size {
+		t.Errorf("file size after reopening = %d, want %d", info.Size(), size)
+	}
+
+	// Both slots torn is not recoverable
+	db.Close()
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteAt(make([]byte, headerSize), 0)
+	file.Close()
+	if _, err := Open(path); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Open without a valid meta slot = %v, want %v", err, ErrCorrupt)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	db, path := openTemp(t)
+	want := map[string]string{}
+	for i := 0; i < 50; i++ {
+		err := db.Update(func(tx *Tx) error {
+			for j := 0; j < 100; j++ {
+				key := fmt.Sprintf("key%04d", j)
+				if err := tx.Put([]byte(key), []byte(fmt.Sprint(i))); err != nil {
+					return err
+				}
+				want[key] = fmt.Sprint(i)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := db.meta.size
+
+	db.mu.Lock()
+	err := db.compact()
+	db.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.meta.size >= before || db.meta.base != db.meta.size {
+		t.Errorf("size %d and base %d after compacting %d bytes", db.meta.size, db.meta.base, before)
+	}
+	checkContents(t, db, want)
+	if _, err := os.Stat(path + ".compact"); !os.IsNotExist(err) {
+		t.Errorf("compaction left its temporary file: %v", err)
+	}
+	checkContents(t, reopen(t, db, path), want)
+}
@@ -0,0 +1,179 @@
+package btree
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+)
+
+// Store keeps bucket and object metadata rows in a B+tree file. Bucket rows
+// are stored under "b\x00{bucket}", the versions of an object under
+// "o\x00{bucket}\x00{key}", so the objects of a bucket are adjacent and
+// sorted by key.
+type Store struct {
+	db *DB
+}
+
+// OpenStore opens the metadata store at path, creating it when it does not exist.
+func OpenStore(path string) (*Store, error) {
+	db, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+func bucketKey(name string) []byte {
+	return []byte("b\x00" + name)
+}
+
+func objectPrefix(bucketName string) string {
+	return "o\x00" + bucketName + "\x00"
+}
+
+// encodeRows stores rows as CSV.
+func encodeRows(rows [][]string) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeRows(value []byte) ([][]string, error) {
+	reader := csv.NewReader(bytes.NewReader(value))
+	reader.FieldsPerRecord = -1
+	return reader.ReadAll()
+}
+
+// Close closes the underlying file.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Bucket returns the row of a bucket.
+func (s *Store) Bucket(name string) ([]string, bool, error) {
+	value, ok, err := s.db.Get(bucketKey(name))
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	rows, err := decodeRows(value)
+	if err != nil || len(rows) == 0 {
+		return nil, false, ErrCorrupt
+	}
+	return rows[0], true, nil
+}
+
+// Buckets returns the rows of all buckets sorted by name.
+func (s *Store) Buckets() ([][]string, error) {
+	var buckets [][]string
+	var decodeErr error
+	prefix := bucketKey("")
+	err := s.db.Ascend(prefix, func(key, value []byte) bool {
+		if !bytes.HasPrefix(key, prefix) {
+			return false
+		}
+		rows, err := decodeRows(value)
+		if err != nil || len(rows) == 0 {
+			decodeErr = ErrCorrupt
+			return false
+		}
+		buckets = append(buckets, rows[0])
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buckets, decodeErr
+}
+
+// PutBucket creates or replaces the row of the bucket named by row[0].
+func (s *Store) PutBucket(row []string) error {
+	value, err := encodeRows([][]string{row})
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *Tx) error {
+		return tx.Put(bucketKey(row[0]), value)
+	})
+}
+
+// DeleteBucket removes a bucket together with the metadata of its objects.
+func (s *Store) DeleteBucket(name string) error {
+	return s.db.Update(func(tx *Tx) error {
+		if _, err := tx.Delete(bucketKey(name)); err != nil {
+			return err
+		}
+
+		prefix := []byte(objectPrefix(name))
+		var keys [][]byte
+		err := tx.Ascend(prefix, func(key, value []byte) bool {
+			if !bytes.HasPrefix(key, prefix) {
+				return false
+			}
+			keys = append(keys, key)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if _, err := tx.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Versions returns the rows of every version of an object, oldest first.
+func (s *Store) Versions(bucketName, key string) ([][]string, error) {
+	value, ok, err := s.db.Get([]byte(objectPrefix(bucketName) + key))
+	if err != nil || !ok {
+		return nil, err
+	}
+	return decodeRows(value)
+}
+
+// SetVersions replaces the rows of every version of an object. No rows
+// remove the object.
+func (s *Store) SetVersions(bucketName, key string, rows [][]string) error {
+	dbKey := []byte(objectPrefix(bucketName) + key)
+	if len(rows) == 0 {
+		return s.db.Update(func(tx *Tx) error {
+			_, err := tx.Delete(dbKey)
+			return err
+		})
+	}
+
+	value, err := encodeRows(rows)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *Tx) error {
+		return tx.Put(dbKey, value)
+	})
+}
+
+// Scan calls fn for each object of a bucket whose key is at least from, in
+// key order, until fn returns false.
+func (s *Store) Scan(bucketName, from string, fn func(key string, versions [][]string) bool) error {
+	prefix := objectPrefix(bucketName)
+	var decodeErr error
+	err := s.db.Ascend([]byte(prefix+from), func(key, value []byte) bool {
+		if !bytes.HasPrefix(key, []byte(prefix)) {
+			return false
+		}
+		versions, err := decodeRows(value)
+		if err != nil {
+			decodeErr = err
+			return false
+		}
+		return fn(strings.TrimPrefix(string(key), prefix), versions)
+	})
+	if err != nil {
+		return err
+	}
+	return decodeErr
+}
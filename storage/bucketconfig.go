@@ -0,0 +1,173 @@
+package storage
+
+import "strconv"
+
+// Columns of a bucket row, those of csvmeta.BucketHeaders. Rows written by
+// older releases may end after any of them from Versioning on.
+const (
+	bucketColName = iota
+	bucketColCreationTime
+	bucketColLastModified
+	bucketColStatus
+	bucketColVersioning
+	// bucketColLifecycle holds the lifecycle configuration XML.
+	bucketColLifecycle
+	// The quota columns are empty for no limit.
+	bucketColQuotaBytes
+	bucketColQuotaObjects
+	// The usage columns are empty until the bucket was first counted.
+	bucketColUsedBytes
+	bucketColUsedObjects
+	// bucketColEncryption holds the algorithm of the default encryption.
+	bucketColEncryption
+
+	// BucketColumns is the number of columns of a bucket row.
+	BucketColumns
+)
+
+// Quota is the most a bucket may hold. Zero fields do not limit it.
+type Quota struct {
+	MaxBytes   int64
+	MaxObjects int64
+}
+
+// Usage is what a bucket holds: the size and number of its stored object
+// versions, noncurrent ones included. Delete markers count in neither.
+type Usage struct {
+	Bytes   int64
+	Objects int64
+}
+
+// Add returns the sum of two usages.
+func (u Usage) Add(v Usage) Usage {
+	return Usage{Bytes: u.Bytes + v.Bytes, Objects: u.Objects + v.Objects}
+}
+
+// Sub returns the difference of two usages.
+func (u Usage) Sub(v Usage) Usage {
+	return Usage{Bytes: u.Bytes - v.Bytes, Objects: u.Objects - v.Objects}
+}
+
+// Exceeds reports whether growing u by delta takes it over quota. A write
+// that does not grow a dimension is allowed even when the bucket is already
+// over its quota, so lowering a quota never blocks replacing objects.
+func (u Usage) Exceeds(quota Quota, delta Usage) bool {
+	return (quota.MaxBytes > 0 && delta.Bytes > 0 && u.Bytes+delta.Bytes > quota.MaxBytes) ||
+		(quota.MaxObjects > 0 && delta.Objects > 0 && u.Objects+delta.Objects > quota.MaxObjects)
+}
+
+// bucketField returns a column of a bucket row, or an empty string when the
+// row ends before it.
+func bucketField(row []string, col int) string {
+	if len(row) <= col {
+		return ""
+	}
+	return row[col]
+}
+
+// NewBucketRow returns the row of a new, empty bucket created at time created.
+func NewBucketRow(name, created string) []string {
+	row := PadBucketRow([]string{name, created, created, "Available"})
+	row[bucketColUsedBytes], row[bucketColUsedObjects] = "0", "0"
+	return row
+}
+
+// PadBucketRow extends a bucket row of an older release to BucketColumns.
+func PadBucketRow(row []string) []string {
+	for len(row) < BucketColumns {
+		row = append(row, "")
+	}
+	return row
+}
+
+// BucketLifecycle returns the lifecycle configuration XML of a bucket, or an
+// empty string when it has none.
+func (s *Store) BucketLifecycle(name string) (string, error) {
+	row, ok, err := s.Meta.Bucket(name)
+	if err != nil || !ok {
+		return "", err
+	}
+	return bucketField(row, bucketColLifecycle), nil
+}
+
+// SetRowLifecycle records the lifecycle configuration XML in a bucket row
+// padded by PadBucketRow.
+func SetRowLifecycle(row []string, config string) {
+	row[bucketColLifecycle] = config
+}
+
+// BucketEncryption returns the default encryption algorithm of a bucket, or
+// an empty string when objects are stored unencrypted by default.
+func (s *Store) BucketEncryption(name string) (string, error) {
+	row, ok, err := s.Meta.Bucket(name)
+	if err != nil || !ok {
+		return "", err
+	}
+	return bucketField(row, bucketColEncryption), nil
+}
+
+// SetRowEncryption records the default encryption algorithm in a bucket row
+// padded by PadBucketRow.
+func SetRowEncryption(row []string, algorithm string) {
+	row[bucketColEncryption] = algorithm
+}
+
+// BucketQuota returns the quota of a bucket and its usage. counted is false
+// for buckets of older releases whose usage was never counted.
+func (s *Store) BucketQuota(name string) (quota Quota, usage Usage, counted bool, err error) {
+	row, ok, err := s.Meta.Bucket(name)
+	if err != nil || !ok {
+		return Quota{}, Usage{}, false, err
+	}
+	row = PadBucketRow(row)
+	quota.MaxBytes, _ = strconv.ParseInt(row[bucketColQuotaBytes], 10, 64)
+	quota.MaxObjects, _ = strconv.ParseInt(row[bucketColQuotaObjects], 10, 64)
+	usage.Bytes, _ = strconv.ParseInt(row[bucketColUsedBytes], 10, 64)
+	usage.Objects, _ = strconv.ParseInt(row[bucketColUsedObjects], 10, 64)
+	return quota, usage, row[bucketColUsedBytes] != "", nil
+}
+
+// SetRowQuota records quota in a bucket row padded by PadBucketRow.
+func SetRowQuota(row []string, quota Quota) {
+	row[bucketColQuotaBytes] = formatLimit(quota.MaxBytes)
+	row[bucketColQuotaObjects] = formatLimit(quota.MaxObjects)
+}
+
+func formatLimit(n int64) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// SetBucketUsage records the usage of a bucket, replacing what was counted.
+func (s *Store) SetBucketUsage(name string, usage Usage) error {
+	return s.updateUsage(name, func(Usage) Usage { return usage })
+}
+
+// AddBucketUsage adds delta to the usage of a bucket. Object writes call it
+// with the change they made, so the usage never needs a scan of the bucket.
+func (s *Store) AddBucketUsage(name string, delta Usage) error {
+	if delta == (Usage{}) {
+		return nil
+	}
+	return s.updateUsage(name, delta.Add)
+}
+
+func (s *Store) updateUsage(name string, update func(Usage) Usage) error {
+	unlock := s.LockBucketFile()
+	defer unlock()
+
+	row, ok, err := s.Meta.Bucket(name)
+	if err != nil || !ok {
+		return err
+	}
+	row = PadBucketRow(row)
+	var usage Usage
+	usage.Bytes, _ = strconv.ParseInt(row[bucketColUsedBytes], 10, 64)
+	usage.Objects, _ = strconv.ParseInt(row[bucketColUsedObjects], 10, 64)
+	usage = update(usage)
+	row[bucketColUsedBytes] = strconv.FormatInt(usage.Bytes, 10)
+	row[bucketColUsedObjects] = strconv.FormatInt(usage.Objects, 10)
+	return s.Meta.PutBucket(row)
+}
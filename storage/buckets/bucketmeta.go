@@ -1,53 +1,27 @@
 package buckets
 
 import (
-	"encoding/csv"
-	"fmt"
-	"os"
 	"time"
 
 	"triple-s/storage"
 )
 
-func CreateBucketMeta(name string) error {
-	// Open the CSV file for appending
-	file, err := os.OpenFile(storage.BucketFile, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o644)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
+func CreateBucketMeta(st *storage.Store, name string) error {
+	unlock := st.LockBucketFile()
+	defer unlock()
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-
-	// Get the current time for creation and modification
-	currentTime := time.Now().Format(time.RFC3339)
-	status := "Available"
-
-	// Write the bucket name and timestamps to the CSV
-	if err = writer.Write([]string{name, currentTime, currentTime, status}); err != nil {
-		return err
-	}
-
-	return nil
+	// Record the bucket name and timestamps
+	return st.Meta.PutBucket(storage.NewBucketRow(name, time.Now().Format(time.RFC3339)))
 }
 
-func ListBuckets() ([]Bucket, error) {
-	// Открыть CSV файл для чтения
-	file, err := os.Open(storage.BucketFile)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+func ListBuckets(st *storage.Store) ([]Bucket, error) {
+	records, err := st.Meta.Buckets()
 	if err != nil {
 		return nil, err
 	}
 
 	var buckets []Bucket
-	for _, record := range records[1:] {
+	for _, record := range records {
 		creationTime, _ := time.Parse(time.RFC3339, record[1])
 		lastModifiedTime, _ := time.Parse(time.RFC3339, record[2])
 		buckets = append(buckets, Bucket{
@@ -60,40 +34,126 @@ func ListBuckets() ([]Bucket, error) {
 	return buckets, nil
 }
 
-func DeleteBucketMeta(name string) error {
-	file, err := os.Open(storage.BucketFile)
+func DeleteBucketMeta(st *storage.Store, name string) error {
+	unlock := st.LockBucketFile()
+	defer unlock()
+
+	return st.Meta.DeleteBucket(name)
+}
+
+// SetBucketVersioning records the versioning state of a bucket.
+func SetBucketVersioning(st *storage.Store, name, status string) error {
+	unlock := st.LockBucketFile()
+	defer unlock()
+
+	record, ok, err := st.Meta.Bucket(name)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	if !ok || record[3] == "Deleted" {
+		return storage.ErrNoSuchBucket
+	}
+	record = storage.PadBucketRow(record)
+	record[2] = time.Now().Format(time.RFC3339)
+	storage.SetRowVersioning(record, status)
+	return st.Meta.PutBucket(record)
+}
+
+// SetBucketLifecycle records the lifecycle configuration XML of a bucket. An
+// empty configuration removes it.
+func SetBucketLifecycle(st *storage.Store, name, config string) error {
+	unlock := st.LockBucketFile()
+	defer unlock()
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	record, ok, err := st.Meta.Bucket(name)
 	if err != nil {
 		return err
 	}
+	if !ok || record[3] == "Deleted" {
+		return storage.ErrNoSuchBucket
+	}
+	record = storage.PadBucketRow(record)
+	record[2] = time.Now().Format(time.RFC3339)
+	storage.SetRowLifecycle(record, config)
+	return st.Meta.PutBucket(record)
+}
 
-	newFile, err := os.Create(storage.BucketFile)
+// SetBucketQuota records the quota of a bucket. A zero quota removes it.
+func SetBucketQuota(st *storage.Store, name string, quota storage.Quota) error {
+	unlock := st.LockBucketFile()
+	defer unlock()
+
+	record, ok, err := st.Meta.Bucket(name)
 	if err != nil {
 		return err
 	}
-	defer newFile.Close()
+	if !ok || record[3] == "Deleted" {
+		return storage.ErrNoSuchBucket
+	}
+	record = storage.PadBucketRow(record)
+	record[2] = time.Now().Format(time.RFC3339)
+	storage.SetRowQuota(record, quota)
+	return st.Meta.PutBucket(record)
+}
+
+// GetBucketQuota returns the quota and usage of a bucket.
+func GetBucketQuota(st *storage.Store, name string) (*BucketQuota, error) {
+	exists, err := st.BucketExists(name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, storage.ErrNoSuchBucket
+	}
+	quota, usage, _, err := st.BucketQuota(name)
+	if err != nil {
+		return nil, err
+	}
+	return &BucketQuota{
+		Bucket:       name,
+		MaxSizeBytes: quota.MaxBytes,
+		MaxObjects:   quota.MaxObjects,
+		UsedBytes:    usage.Bytes,
+		UsedObjects:  usage.Objects,
+	}, nil
+}
 
-	writer := csv.NewWriter(newFile)
-	defer writer.Flush()
+// ListBucketQuotas returns the quota and usage of every bucket.
+func ListBucketQuotas(st *storage.Store) (*ListBucketQuotasResult, error) {
+	records, err := st.Meta.Buckets()
+	if err != nil {
+		return nil, err
+	}
 
+	result := &ListBucketQuotasResult{}
 	for _, record := range records {
-		// Skip writing the record if it matches the bucket to be deleted
-		if record[0] == name {
+		if record[3] == "Deleted" {
 			continue
 		}
-
-		// Write the remaining records to the new file
-		err := writer.Write(record)
+		quota, err := GetBucketQuota(st, record[0])
 		if err != nil {
-			return fmt.Errorf("failed to write record: %w", err)
+			return nil, err
 		}
+		result.Buckets = append(result.Buckets, *quota)
 	}
+	return result, nil
+}
 
-	return nil
+// SetBucketEncryption records the default encryption algorithm of a bucket.
+// An empty algorithm removes it.
+func SetBucketEncryption(st *storage.Store, name, algorithm string) error {
+	unlock := st.LockBucketFile()
+	defer unlock()
+
+	record, ok, err := st.Meta.Bucket(name)
+	if err != nil {
+		return err
+	}
+	if !ok || record[3] == "Deleted" {
+		return storage.ErrNoSuchBucket
+	}
+	record = storage.PadBucketRow(record)
+	record[2] = time.Now().Format(time.RFC3339)
+	storage.SetRowEncryption(record, algorithm)
+	return st.Meta.PutBucket(record)
 }
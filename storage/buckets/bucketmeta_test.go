@@ -0,0 +1,65 @@
+package buckets
+
+import (
+	"testing"
+
+	"triple-s/storage"
+)
+
+// newOldBucket returns a store holding a bucket row of the four columns the
+// first releases wrote.
+func newOldBucket(t *testing.T) *storage.Store {
+	t.Helper()
+	st := storage.New("")
+	if err := st.OpenMeta(storage.MetaBackendMemory); err != nil {
+		t.Fatal(err)
+	}
+	created := "2024-01-02T03:04:05Z"
+	if err := st.Meta.PutBucket([]string{"old", created, created, "Available"}); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func TestSetBucketVersioningOnOldRow(t *testing.T) {
+	st := newOldBucket(t)
+	if err := SetBucketVersioning(st, "old", storage.VersioningEnabled); err != nil {
+		t.Fatal(err)
+	}
+	status, err := st.BucketVersioning("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != storage.VersioningEnabled {
+		t.Errorf("versioning = %q, want %q", status, storage.VersioningEnabled)
+	}
+	row, _, err := st.Meta.Bucket("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(row) != storage.BucketColumns {
+		t.Errorf("row has %d columns, want %d", len(row), storage.BucketColumns)
+	}
+}
+
+func TestSetBucketConfigOnOldRow(t *testing.T) {
+	st := newOldBucket(t)
+	if err := SetBucketLifecycle(st, "old", "<LifecycleConfiguration/>"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetBucketQuota(st, "old", storage.Quota{MaxBytes: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetBucketEncryption(st, "old", "AES256"); err != nil {
+		t.Fatal(err)
+	}
+	if config, _ := st.BucketLifecycle("old"); config != "<LifecycleConfiguration/>" {
+		t.Errorf("lifecycle = %q", config)
+	}
+	if quota, _, _, _ := st.BucketQuota("old"); quota.MaxBytes != 10 {
+		t.Errorf("quota = %+v", quota)
+	}
+	if algorithm, _ := st.BucketEncryption("old"); algorithm != "AES256" {
+		t.Errorf("encryption = %q", algorithm)
+	}
+}
@@ -1,18 +1,18 @@
 package buckets
 
 import (
-	"encoding/csv"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 
 	"triple-s/storage"
+	"triple-s/storage/backend"
 )
 
-// CreateRootDirectory creates the {data} directory and the buckets.csv file only if they don't exist
-func CreateRootDirectory() error {
-	rootDir := filepath.Join(storage.StorageDir)
-
+// CreateRootDirectory creates the {data} directory if it doesn't exist
+func CreateRootDirectory(rootDir string) error {
 	// Check if the {data} directory exists
 	dirInfo, err := os.Stat(rootDir)
 	if os.IsNotExist(err) {
@@ -26,57 +26,24 @@ func CreateRootDirectory() error {
 		return fmt.Errorf("%s exists but is not a directory", rootDir)
 	}
 
-	// Check if the buckets.csv file exists
-	objectsFile := filepath.Join(rootDir, "buckets.csv")
-	if _, err := os.Stat(objectsFile); os.IsNotExist(err) {
-		// Create the buckets.csv file
-		file, err := os.Create(objectsFile)
-		if err != nil {
-			return err
-		}
-		defer file.Close()
-
-		// Write the header row to the CSV file
-		writer := csv.NewWriter(file)
-		defer writer.Flush()
-		headers := []string{"BucketName", "CreationTime", "LastModifiedTime", "Status"}
-		if err := writer.Write(headers); err != nil {
-			return err
-		}
-	}
-
 	return nil
 }
 
-// Create the bucket directory
-func CreateBucketDirectory(bucketName string) error {
-	// storageDir := config.GetStorageDir()
-	bucketDir := filepath.Join(storage.StorageDir, bucketName)
-
-	// Create the bucket directory
-	err := os.MkdirAll(bucketDir, 0o755)
-	if err != nil {
-		return err
-	}
-
-	// Create the objects.csv file
-	objectsFile := filepath.Join(bucketDir, "objects.csv")
-	file, err := os.Create(objectsFile)
+// Create the bucket. Its data is stored as objects are written to it.
+func CreateBucketDirectory(st *storage.Store, bucketName string) error {
+	// Hold the bucket's lock so two requests cannot both create it
+	unlock := st.LockBucket(bucketName)
+	defer unlock()
+	exists, err := st.BucketExists(bucketName)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-
-	// Write the header row to the CSV file
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
-	headers := []string{"BucketName", "ObjectKey", "ContentType", "Size", "LastModifiedTime"}
-	if err := writer.Write(headers); err != nil {
-		return err
+	if exists {
+		return storage.ErrBucketExists
 	}
 
 	// Store object metadata
-	err = CreateBucketMeta(bucketName)
+	err = CreateBucketMeta(st, bucketName)
 	if err != nil {
 		return err
 	}
@@ -84,36 +51,52 @@ func CreateBucketDirectory(bucketName string) error {
 	return nil
 }
 
-// DeleteBucketDirectory removes the specified bucket directory if it contains only 'objects.csv'.
-func DeleteBucketDirectory(bucketName string) error {
+// DeleteBucketDirectory removes the specified bucket if it holds no objects,
+// along with the multipart uploads still in progress.
+func DeleteBucketDirectory(st *storage.Store, bucketName string) error {
+	// No object can be written while the bucket is checked and removed
+	unlock := st.LockBucket(bucketName)
+	defer unlock()
+
 	// Check if the bucket exists
-	exists, err := storage.BucketExists(bucketName)
+	exists, err := st.BucketExists(bucketName)
 	if err != nil {
 		return err
 	}
 	if !exists {
-		return nil
+		return storage.ErrNoSuchBucket
+	}
+
+	// Check if the bucket is empty
+	if st.IsBucketEmpty(bucketName) {
+		err = DeleteBucketMeta(st, bucketName)
+		if err != nil {
+			return err
+		}
+		return removeBucketData(st, bucketName)
 	}
 
-	bucketDir := filepath.Join(storage.StorageDir, bucketName)
+	// If the bucket still holds objects, return an error
+	return storage.ErrBucketNotEmpty
+}
 
-	// Check if the bucket directory exists
-	_, err = os.Stat(bucketDir)
-	if os.IsNotExist(err) {
-		return nil
-	} else if err != nil {
+// removeBucketData deletes what is left of a bucket's data once its metadata is gone.
+func removeBucketData(st *storage.Store, bucketName string) error {
+	var names []string
+	err := st.Data.List(bucketName+"/", func(name string, _ backend.Info) bool {
+		names = append(names, name)
+		return true
+	})
+	if err != nil {
 		return err
 	}
-
-	// Check if the bucket is empty (only contains 'objects.csv')
-	if storage.IsBucketEmpty(bucketName) {
-		err = DeleteBucketMeta(bucketName)
-		if err != nil {
+	for _, name := range names {
+		if err := st.Data.Delete(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
 			return err
 		}
-		return os.RemoveAll(bucketDir)
 	}
 
-	// If the directory has more than 'objects.csv', return an error
-	return os.ErrExist
+	// Bucket directories of earlier releases stay behind when they were empty.
+	os.Remove(filepath.Join(st.Dir, bucketName))
+	return nil
 }
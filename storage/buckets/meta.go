@@ -12,7 +12,75 @@ type Bucket struct {
 	Status           string    `xml:"Status"`
 }
 
+// BucketList is the bucket listing served in the legacy XML format.
 type BucketList struct {
 	XMLName xml.Name `xml:"BucketList"`
 	Buckets []Bucket `xml:"Bucket"`
 }
+
+// ListAllMyBucketsResult is the ListBuckets response body.
+type ListAllMyBucketsResult struct {
+	XMLName xml.Name      `xml:"ListAllMyBucketsResult"`
+	Xmlns   string        `xml:"xmlns,attr"`
+	Owner   Owner         `xml:"Owner"`
+	Buckets []BucketEntry `xml:"Buckets>Bucket"`
+}
+
+// Owner identifies the owner of the buckets.
+type Owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+// BucketEntry describes one bucket in a ListAllMyBucketsResult.
+type BucketEntry struct {
+	Name         string    `xml:"Name"`
+	CreationDate time.Time `xml:"CreationDate"`
+}
+
+// DefaultOwner owns every bucket, as the server has a single tenant.
+var DefaultOwner = Owner{ID: "triple-s", DisplayName: "triple-s"}
+
+// VersioningConfiguration is the body of the ?versioning subresource.
+type VersioningConfiguration struct {
+	XMLName xml.Name `xml:"VersioningConfiguration"`
+	Status  string   `xml:"Status,omitempty"`
+}
+
+// BucketQuota is the document of the admin quota endpoint: the quota of a
+// bucket, zero where it sets no limit, and what the bucket holds. Only the
+// Max fields are read from requests.
+type BucketQuota struct {
+	XMLName      xml.Name `xml:"BucketQuota"`
+	Bucket       string   `xml:"Bucket,omitempty"`
+	MaxSizeBytes int64    `xml:"MaxSizeBytes"`
+	MaxObjects   int64    `xml:"MaxObjects"`
+	UsedBytes    int64    `xml:"UsedBytes"`
+	UsedObjects  int64    `xml:"UsedObjects"`
+}
+
+// ListBucketQuotasResult lists the quota and usage of every bucket.
+type ListBucketQuotasResult struct {
+	XMLName xml.Name      `xml:"ListBucketQuotasResult"`
+	Buckets []BucketQuota `xml:"BucketQuota"`
+}
+
+// ServerSideEncryptionConfiguration is the body of the ?encryption
+// subresource: the encryption applied to objects stored without asking for one.
+type ServerSideEncryptionConfiguration struct {
+	XMLName xml.Name               `xml:"ServerSideEncryptionConfiguration"`
+	Xmlns   string                 `xml:"xmlns,attr,omitempty"`
+	Rules   []ServerSideEncryption `xml:"Rule"`
+}
+
+// ServerSideEncryption is one rule of a ServerSideEncryptionConfiguration.
+type ServerSideEncryption struct {
+	ApplyServerSideEncryptionByDefault *EncryptionByDefault `xml:"ApplyServerSideEncryptionByDefault"`
+	BucketKeyEnabled                   bool                 `xml:"BucketKeyEnabled"`
+}
+
+// EncryptionByDefault names the default encryption algorithm.
+type EncryptionByDefault struct {
+	SSEAlgorithm   string `xml:"SSEAlgorithm"`
+	KMSMasterKeyID string `xml:"KMSMasterKeyID,omitempty"`
+}
@@ -0,0 +1,298 @@
+// Package csvmeta keeps bucket and object metadata in CSV files: buckets.csv
+// in the storage root and an objects.csv in each bucket directory. Every
+// lookup reads the file it needs and every change rewrites it, which keeps
+// the files easy to inspect but makes each request O(n) in the bucket size.
+package csvmeta
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// BucketHeaders is the header row of buckets.csv.
+var BucketHeaders = []string{"BucketName", "CreationTime", "LastModifiedTime", "Status", "Versioning", "Lifecycle", "QuotaBytes", "QuotaObjects", "UsedBytes", "UsedObjects", "Encryption"}
+
+// ObjectHeaders is the header row of objects.csv.
+var ObjectHeaders = []string{"BucketName", "ObjectKey", "ContentType", "Size", "LastModifiedTime", "VersionId", "IsLatest", "DeleteMarker", "ETag", "Metadata"}
+
+// objectDefaults fills the columns missing from rows written by older
+// releases: such rows are the current null version of their key.
+var objectDefaults = []string{"", "", "", "", "", "null", "true", "false", "", ""}
+
+// Store reads and writes the CSV metadata files under a storage directory.
+type Store struct {
+	dir string
+	mu  sync.Mutex // serializes rewrites
+}
+
+// Open returns the store for dir, creating buckets.csv when it is missing.
+func Open(dir string) (*Store, error) {
+	s := &Store{dir: dir}
+	if _, err := os.Stat(s.bucketsPath()); os.IsNotExist(err) {
+		if err := writeCSV(s.bucketsPath(), BucketHeaders, nil); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Exists reports whether dir holds CSV metadata.
+func Exists(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, "buckets.csv"))
+	return err == nil
+}
+
+func (s *Store) bucketsPath() string {
+	return filepath.Join(s.dir, "buckets.csv")
+}
+
+func (s *Store) objectsPath(bucketName string) string {
+	return filepath.Join(s.dir, bucketName, "objects.csv")
+}
+
+// Close releases nothing; the files are closed after every call.
+func (s *Store) Close() error {
+	return nil
+}
+
+// Bucket returns the row of a bucket.
+func (s *Store) Bucket(name string) ([]string, bool, error) {
+	records, err := s.readBuckets()
+	if err != nil {
+		return nil, false, err
+	}
+	for _, record := range records {
+		if record[0] == name {
+			return record, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// Buckets returns the rows of all buckets sorted by name.
+func (s *Store) Buckets() ([][]string, error) {
+	records, err := s.readBuckets()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i][0] < records[j][0] })
+	return records, nil
+}
+
+// PutBucket creates or replaces the row of the bucket named by row[0].
+func (s *Store) PutBucket(row []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.readBuckets()
+	if err != nil {
+		return err
+	}
+	replaced := false
+	for i, record := range records {
+		if record[0] == row[0] {
+			records[i], replaced = row, true
+		}
+	}
+	if !replaced {
+		records = append(records, row)
+	}
+	return writeCSV(s.bucketsPath(), BucketHeaders, records)
+}
+
+// DeleteBucket removes a bucket together with its objects.csv.
+func (s *Store) DeleteBucket(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.readBuckets()
+	if err != nil {
+		return err
+	}
+	kept := records[:0]
+	for _, record := range records {
+		if record[0] != name {
+			kept = append(kept, record)
+		}
+	}
+	if err := writeCSV(s.bucketsPath(), BucketHeaders, kept); err != nil {
+		return err
+	}
+	if err := os.Remove(s.objectsPath(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Versions returns the rows of every version of an object, oldest first.
+func (s *Store) Versions(bucketName, key string) ([][]string, error) {
+	records, err := s.readObjects(bucketName)
+	if err != nil {
+		return nil, err
+	}
+	var versions [][]string
+	for _, record := range records {
+		if record[1] == key {
+			versions = append(versions, record)
+		}
+	}
+	return versions, nil
+}
+
+// SetVersions replaces the rows of every version of an object, where its
+// first row was. No rows remove the object.
+func (s *Store) SetVersions(bucketName, key string, rows [][]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.readObjects(bucketName)
+	if err != nil {
+		return err
+	}
+	updated := make([][]string, 0, len(records)+len(rows))
+	placed := false
+	for _, record := range records {
+		if record[1] != key {
+			updated = append(updated, record)
+			continue
+		}
+		if !placed {
+			updated = append(updated, rows...)
+			placed = true
+		}
+	}
+	if !placed {
+		updated = append(updated, rows...)
+	}
+	return writeCSV(s.objectsPath(bucketName), ObjectHeaders, updated)
+}
+
+// Scan calls fn for each object of a bucket whose key is at least from, in
+// key order, until fn returns false.
+func (s *Store) Scan(bucketName, from string, fn func(key string, versions [][]string) bool) error {
+	records, err := s.readObjects(bucketName)
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	versions := map[string][][]string{}
+	for _, record := range records {
+		key := record[1]
+		if key < from {
+			continue
+		}
+		if _, ok := versions[key]; !ok {
+			keys = append(keys, key)
+		}
+		versions[key] = append(versions[key], record)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !fn(key, versions[key]) {
+			break
+		}
+	}
+	return nil
+}
+
+// readBuckets returns the rows of buckets.csv, padded to the current columns.
+func (s *Store) readBuckets() ([][]string, error) {
+	records, err := readCSV(s.bucketsPath())
+	if err != nil {
+		return nil, err
+	}
+	for i, record := range records {
+		for len(record) < len(BucketHeaders) {
+			record = append(record, "")
+		}
+		records[i] = record
+	}
+	return records, nil
+}
+
+// readObjects returns the rows of a bucket's objects.csv, padded to the
+// current columns. A bucket without the file has no objects.
+func (s *Store) readObjects(bucketName string) ([][]string, error) {
+	records, err := readCSV(s.objectsPath(bucketName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, record := range records {
+		for len(record) < len(ObjectHeaders) {
+			record = append(record, objectDefaults[len(record)])
+		}
+		records[i] = record
+	}
+	return records, nil
+}
+
+// readCSV returns the rows of a CSV file without its header.
+func readCSV(path string) ([][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return records[1:], nil
+}
+
+// writeCSV replaces the file at path with header and records. The new
+// content is written to a hidden temp file next to it and renamed into
+// place, so readers never see it half written.
+func writeCSV(path string, header []string, records [][]string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp, header, records); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func write(w io.Writer, header []string, records [][]string) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	if err := writer.WriteAll(records); err != nil {
+		return fmt.Errorf("failed to write records: %w", err)
+	}
+	return nil
+}
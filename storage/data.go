@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"fmt"
+
+	"triple-s/storage/backend/disk"
+	"triple-s/storage/backend/memory"
+)
+
+// Data backends selectable with --backend.
+const (
+	DataBackendFS     = "fs"
+	DataBackendMemory = "memory"
+)
+
+// OpenData opens the data backend of the given kind. The fs backend keeps
+// the data under the storage directory; the memory backend loses it on exit.
+func (s *Store) OpenData(kind string) error {
+	switch kind {
+	case DataBackendFS:
+		s.Data = disk.New(s.Dir)
+	case DataBackendMemory:
+		s.Data = memory.New()
+	default:
+		return fmt.Errorf("unknown data backend %q", kind)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package storage
+
+import "net/http"
+
+// Error is a failure carrying its S3 error code and the HTTP status it is
+// reported with.
+type Error struct {
+	Code       string
+	Message    string
+	StatusCode int
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+var (
+	ErrNoSuchBucket      = &Error{"NoSuchBucket", "The specified bucket does not exist", http.StatusNotFound}
+	ErrBucketExists      = &Error{"BucketAlreadyOwnedByYou", "Your previous request to create the named bucket succeeded and you already own it", http.StatusConflict}
+	ErrBucketNotEmpty    = &Error{"BucketNotEmpty", "The bucket you tried to delete is not empty", http.StatusConflict}
+	ErrInvalidBucketName = &Error{"InvalidBucketName", "The specified bucket is not valid", http.StatusBadRequest}
+	ErrInternalError     = &Error{"InternalError", "We encountered an internal error. Please try again.", http.StatusInternalServerError}
+)
@@ -0,0 +1,299 @@
+// Package index keeps the bucket and object metadata in memory, sorted by
+// name, and makes every change durable in an append-only journal.
+//
+// Rows are the same string slices the CSV metadata files used: a bucket row
+// starts with the bucket name, and the versions of an object are kept in the
+// order they were written. Stored rows are never modified in place; a change
+// replaces them, so rows handed out by Scan stay valid after it returns.
+package index
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Compaction rewrites the journal once more entries were appended since the
+// last rewrite than there are live ones, and at least compactMinEntries; or
+// once more bytes were appended than the rewrite produced, and at least
+// compactMinBytes, as each entry stores every version of an object.
+const (
+	compactMinEntries = 1000
+	compactMinBytes   = 16 << 20
+)
+
+// Index is the in-memory view of the metadata, backed by a journal file.
+type Index struct {
+	mu      sync.RWMutex
+	path    string   // empty for an index kept only in memory
+	journal *os.File // nil while the index is being seeded
+
+	buckets map[string][]string
+	names   []string // sorted bucket names
+	tables  map[string]*table
+
+	live     int   // number of bucket and object entries
+	appended int   // journal entries written since the last compaction
+	written  int64 // journal bytes written since the last compaction
+	snapshot int64 // size of the journal after the last compaction
+
+	// failed is set when a torn journal entry could not be cut off. Nothing
+	// more is appended, as replay would drop it along with the torn entry.
+	failed error
+}
+
+// table holds the objects of one bucket.
+type table struct {
+	keys     []string // sorted
+	versions map[string][][]string
+}
+
+// Open loads the journal at path. When it does not exist yet, seed is called
+// with an empty index to fill it, for example from older metadata files, and
+// the result is written as the first journal.
+func Open(path string, seed func(x *Index) error) (*Index, error) {
+	x := &Index{
+		path:    path,
+		buckets: map[string][]string{},
+		tables:  map[string]*table{},
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		if seed != nil {
+			if err := seed(x); err != nil {
+				return nil, err
+			}
+		}
+		if err := x.compact(); err != nil {
+			return nil, err
+		}
+		return x, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := x.replay(file); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to replay %s: %w", path, err)
+	}
+	x.journal = file
+	return x, nil
+}
+
+// New returns an empty index kept only in memory, without a journal.
+func New() *Index {
+	return &Index{
+		buckets: map[string][]string{},
+		tables:  map[string]*table{},
+	}
+}
+
+// Close closes the journal. The index must not be used afterwards.
+func (x *Index) Close() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.journal == nil {
+		return nil
+	}
+	err := x.journal.Close()
+	x.journal = nil
+	return err
+}
+
+// Bucket returns the row of a bucket.
+func (x *Index) Bucket(name string) ([]string, bool, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	row, ok := x.buckets[name]
+	return copyRow(row), ok, nil
+}
+
+// Buckets returns the rows of all buckets sorted by name.
+func (x *Index) Buckets() ([][]string, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	rows := make([][]string, 0, len(x.names))
+	for _, name := range x.names {
+		rows = append(rows, copyRow(x.buckets[name]))
+	}
+	return rows, nil
+}
+
+// PutBucket creates or replaces the row of the bucket named by row[0].
+func (x *Index) PutBucket(row []string) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	entry := [][]string{append([]string{opPutBucket}, row...)}
+	if err := x.append(entry); err != nil {
+		return err
+	}
+	x.putBucket(copyRow(row))
+	return x.maybeCompact()
+}
+
+// DeleteBucket removes a bucket together with the metadata of its objects.
+func (x *Index) DeleteBucket(name string) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if err := x.append([][]string{{opDeleteBucket, name}}); err != nil {
+		return err
+	}
+	x.deleteBucket(name)
+	return x.maybeCompact()
+}
+
+// Versions returns the rows of every version of an object, oldest first.
+func (x *Index) Versions(bucketName, key string) ([][]string, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	t := x.tables[bucketName]
+	if t == nil {
+		return nil, nil
+	}
+	versions := t.versions[key]
+	rows := make([][]string, 0, len(versions))
+	for _, row := range versions {
+		rows = append(rows, copyRow(row))
+	}
+	return rows, nil
+}
+
+// SetVersions replaces the rows of every version of an object. No rows
+// remove the object.
+func (x *Index) SetVersions(bucketName, key string, rows [][]string) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	entry := append([][]string{{opSetVersions, bucketName, key}}, rows...)
+	if err := x.append(entry); err != nil {
+		return err
+	}
+
+	stored := make([][]string, 0, len(rows))
+	for _, row := range rows {
+		stored = append(stored, copyRow(row))
+	}
+	x.setVersions(bucketName, key, stored)
+	return x.maybeCompact()
+}
+
+// Scan calls fn for each object of a bucket whose key is at least from, in
+// key order, until fn returns false. fn must not modify the rows or call back
+// into the index.
+func (x *Index) Scan(bucketName, from string, fn func(key string, versions [][]string) bool) error {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	t := x.tables[bucketName]
+	if t == nil {
+		return nil
+	}
+	for i := sort.SearchStrings(t.keys, from); i < len(t.keys); i++ {
+		if !fn(t.keys[i], t.versions[t.keys[i]]) {
+			break
+		}
+	}
+	return nil
+}
+
+// Compact rewrites the journal with one entry per bucket and object.
+func (x *Index) Compact() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.compact()
+}
+
+// maybeCompact compacts the journal when it has grown enough. The change that
+// triggered it is already durable, so a failed compaction is only logged and
+// retried after the next change.
+func (x *Index) maybeCompact() error {
+	if x.path == "" {
+		return nil
+	}
+	if (x.appended >= compactMinEntries && x.appended > x.live) || (x.written >= compactMinBytes && x.written > x.snapshot) {
+		if err := x.compact(); err != nil {
+			fmt.Printf("Error compacting metadata journal: %v\n", err)
+		}
+	}
+	return nil
+}
+
+func (x *Index) putBucket(row []string) {
+	name := row[0]
+	if _, ok := x.buckets[name]; !ok {
+		x.names = insertSorted(x.names, name)
+		x.live++
+	}
+	x.buckets[name] = row
+}
+
+func (x *Index) deleteBucket(name string) {
+	if _, ok := x.buckets[name]; !ok {
+		return
+	}
+	delete(x.buckets, name)
+	x.names = removeSorted(x.names, name)
+	x.live--
+
+	if t := x.tables[name]; t != nil {
+		x.live -= len(t.keys)
+		delete(x.tables, name)
+	}
+}
+
+func (x *Index) setVersions(bucketName, key string, rows [][]string) {
+	t := x.tables[bucketName]
+	if t == nil {
+		if len(rows) == 0 {
+			return
+		}
+		t = &table{versions: map[string][][]string{}}
+		x.tables[bucketName] = t
+	}
+
+	_, exists := t.versions[key]
+	switch {
+	case len(rows) == 0 && exists:
+		delete(t.versions, key)
+		t.keys = removeSorted(t.keys, key)
+		x.live--
+	case len(rows) > 0 && !exists:
+		t.versions[key] = rows
+		t.keys = insertSorted(t.keys, key)
+		x.live++
+	case len(rows) > 0:
+		t.versions[key] = rows
+	}
+}
+
+func copyRow(row []string) []string {
+	if row == nil {
+		return nil
+	}
+	return append([]string(nil), row...)
+}
+
+func insertSorted(list []string, s string) []string {
+	i := sort.SearchStrings(list, s)
+	list = append(list, "")
+	copy(list[i+1:], list[i:])
+	list[i] = s
+	return list
+}
+
+func removeSorted(list []string, s string) []string {
+	i := sort.SearchStrings(list, s)
+	if i < len(list) && list[i] == s {
+		list = append(list[:i], list[i+1:]...)
+	}
+	return list
+}
@@ -0,0 +1,249 @@
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Journal entries are framed as a 4-byte big-endian payload length, the
+// CRC-32C of the payload and the payload itself. The payload is CSV: the
+// first record names the operation and its target, any further records are
+// the rows it stores.
+const (
+	opPutBucket    = "bucket"
+	opDeleteBucket = "delete-bucket"
+	opSetVersions  = "object"
+)
+
+// maxEntrySize bounds the payload length read from the journal, so a damaged
+// length field is not mistaken for a huge entry.
+const maxEntrySize = 64 << 20
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var errCorruptEntry = errors.New("corrupt journal entry")
+
+// encodeEntry frames the records of one journal entry.
+func encodeEntry(records [][]string) ([]byte, error) {
+	var payload bytes.Buffer
+	writer := csv.NewWriter(&payload)
+	if err := writer.WriteAll(records); err != nil {
+		return nil, err
+	}
+
+	entry := make([]byte, 8, 8+payload.Len())
+	binary.BigEndian.PutUint32(entry[0:4], uint32(payload.Len()))
+	binary.BigEndian.PutUint32(entry[4:8], crc32.Checksum(payload.Bytes(), crcTable))
+	return append(entry, payload.Bytes()...), nil
+}
+
+// readEntry reads the next journal entry. It returns io.EOF at the clean end
+// of the journal and errCorruptEntry for a torn or damaged entry.
+func readEntry(reader *bufio.Reader) ([][]string, int, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(reader, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, 0, errCorruptEntry
+		}
+		return nil, 0, err
+	}
+
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size > maxEntrySize {
+		return nil, 0, errCorruptEntry
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, 0, errCorruptEntry
+		}
+		return nil, 0, err
+	}
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, 0, errCorruptEntry
+	}
+
+	csvReader := csv.NewReader(bytes.NewReader(payload))
+	csvReader.FieldsPerRecord = -1
+	records, err := csvReader.ReadAll()
+	if err != nil || len(records) == 0 {
+		return nil, 0, errCorruptEntry
+	}
+	return records, len(header) + int(size), nil
+}
+
+// apply replays one journal entry into the in-memory index.
+func (x *Index) apply(records [][]string) error {
+	op := records[0]
+	switch {
+	case op[0] == opPutBucket && len(op) > 1:
+		x.putBucket(op[1:])
+	case op[0] == opDeleteBucket && len(op) == 2:
+		x.deleteBucket(op[1])
+	case op[0] == opSetVersions && len(op) == 3:
+		x.setVersions(op[1], op[2], records[1:])
+	default:
+		return errCorruptEntry
+	}
+	return nil
+}
+
+// replay loads the journal. An entry cut short by a crash ends the journal:
+// it and anything after it are cut off so new entries follow the last good one.
+func (x *Index) replay(file *os.File) error {
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		records, n, err := readEntry(reader)
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			err = x.apply(records)
+		}
+		if errors.Is(err, errCorruptEntry) {
+			fmt.Printf("Discarding damaged metadata journal entries after byte %d\n", offset)
+			if err := file.Truncate(offset); err != nil {
+				return err
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		offset += int64(n)
+		x.appended++
+		x.written += int64(n)
+	}
+
+	_, err := file.Seek(offset, io.SeekStart)
+	return err
+}
+
+// append writes one entry to the journal and flushes it to disk. It does
+// nothing while the index is being seeded.
+func (x *Index) append(records [][]string) error {
+	if x.journal == nil {
+		return nil
+	}
+	if x.failed != nil {
+		return x.failed
+	}
+
+	entry, err := encodeEntry(records)
+	if err != nil {
+		return err
+	}
+	offset := x.snapshot + x.written
+	if _, err := x.journal.Write(entry); err != nil {
+		return x.undoAppend(offset, fmt.Errorf("failed to write metadata journal: %w", err))
+	}
+	if err := x.journal.Sync(); err != nil {
+		return x.undoAppend(offset, fmt.Errorf("failed to sync metadata journal: %w", err))
+	}
+	x.appended++
+	x.written += int64(len(entry))
+	return nil
+}
+
+// undoAppend cuts the journal back to offset after an append failed with err,
+// so a torn entry does not end the journal before later entries on replay.
+// When the journal cannot be cut, it is rewritten from the index instead, and
+// failing that the index refuses further changes.
+func (x *Index) undoAppend(offset int64, err error) error {
+	undoErr := x.journal.Truncate(offset)
+	if undoErr == nil {
+		_, undoErr = x.journal.Seek(offset, io.SeekStart)
+	}
+	if undoErr != nil {
+		undoErr = x.compact()
+	}
+	if undoErr != nil {
+		fmt.Printf("Error cutting off a failed metadata journal entry: %v\n", undoErr)
+		x.failed = fmt.Errorf("metadata journal is damaged, restart the server to recover: %w", err)
+		return x.failed
+	}
+	return err
+}
+
+// compact writes the current state as a new journal and swaps it in with a
+// rename, so a crash leaves either the old journal or the new one.
+func (x *Index) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(x.path), filepath.Base(x.path)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	writer := bufio.NewWriter(tmp)
+	var size int64
+	write := func(records [][]string) error {
+		entry, err := encodeEntry(records)
+		if err != nil {
+			return err
+		}
+		size += int64(len(entry))
+		_, err = writer.Write(entry)
+		return err
+	}
+
+	for _, name := range x.names {
+		if err := write([][]string{append([]string{opPutBucket}, x.buckets[name]...)}); err != nil {
+			tmp.Close()
+			return err
+		}
+		t := x.tables[name]
+		if t == nil {
+			continue
+		}
+		for _, key := range t.keys {
+			if err := write(append([][]string{{opSetVersions, name, key}}, t.versions[key]...)); err != nil {
+				tmp.Close()
+				return err
+			}
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), x.path); err != nil {
+		return err
+	}
+	if dir, err := os.Open(filepath.Dir(x.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	journal, err := os.OpenFile(x.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	if x.journal != nil {
+		x.journal.Close()
+	}
+	x.journal = journal
+	x.appended, x.written, x.snapshot = 0, 0, size
+	x.failed = nil
+	return nil
+}
@@ -0,0 +1,91 @@
+package index
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func bucketNames(t *testing.T, x *Index) []string {
+	t.Helper()
+	rows, err := x.Buckets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, row := range rows {
+		names = append(names, row[0])
+	}
+	return names
+}
+
+func reopen(t *testing.T, x *Index, path string) *Index {
+	t.Helper()
+	if err := x.Close(); err != nil {
+		t.Fatal(err)
+	}
+	x, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { x.Close() })
+	return x
+}
+
+func TestTornAppendIsCutOff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metadata.journal")
+	x, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := x.PutBucket([]string{"first"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Half an entry reaches the file before the write fails
+	entry, err := encodeEntry([][]string{{opPutBucket, "torn"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := x.snapshot + x.written
+	if _, err := x.journal.Write(entry[:len(entry)/2]); err != nil {
+		t.Fatal(err)
+	}
+	injected := errors.New("injected failure")
+	if err := x.undoAppend(offset, injected); err != injected {
+		t.Fatalf("undoAppend = %v, want the append error", err)
+	}
+
+	if err := x.PutBucket([]string{"second"}); err != nil {
+		t.Fatal(err)
+	}
+	x = reopen(t, x, path)
+	if got := bucketNames(t, x); len(got) != 2 || got[0] != "first" || got[1] != "second" {
+		t.Errorf("buckets after replay = %v, want [first second]", got)
+	}
+}
+
+func TestFailedAppendRewritesJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metadata.journal")
+	x, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := x.PutBucket([]string{"first"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Neither the write nor cutting it off works on a closed file
+	x.journal.Close()
+	if err := x.PutBucket([]string{"lost"}); err == nil {
+		t.Fatal("PutBucket on a closed journal succeeded")
+	}
+	if err := x.PutBucket([]string{"second"}); err != nil {
+		t.Fatalf("PutBucket after the journal was rewritten: %v", err)
+	}
+
+	x = reopen(t, x, path)
+	if got := bucketNames(t, x); len(got) != 2 || got[0] != "first" || got[1] != "second" {
+		t.Errorf("buckets after replay = %v, want [first second]", got)
+	}
+}
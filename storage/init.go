@@ -2,22 +2,59 @@ package storage
 
 import (
 	"encoding/xml"
+	"sync"
 
-	"triple-s/config"
+	"triple-s/storage/backend"
 )
 
-var (
-	StorageDir string
-	BucketFile string
-)
+// XMLNamespace is the namespace of the S3 response documents.
+const XMLNamespace = "http://s3.amazonaws.com/doc/2006-03-01/"
 
 type ErrorResponse struct {
-	XMLName xml.Name `xml:"Error"`
-	Message string   `xml:"Message"`
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource,omitempty"`
+	RequestID string   `xml:"RequestId,omitempty"`
+}
+
+// Store is one storage directory: the backends serving its metadata and
+// object data, and the locks that order the updates made through them.
+type Store struct {
+	Dir  string
+	Meta MetadataStore   // opened by OpenMeta
+	Data backend.Backend // opened by OpenData
+	// Layout places object data within buckets; the server settles it with
+	// the layout of the stored data before serving requests.
+	Layout Layout
+	// MasterKey seals the data keys of objects encrypted with SSE-S3; they
+	// cannot be stored or read without it.
+	MasterKey []byte
+
+	bucketLocksMu sync.Mutex
+	bucketLocks   map[string]*sync.RWMutex
+
+	uploadLocksMu sync.Mutex
+	uploadLocks   map[string]*uploadLock
+
+	// pendingMu guards pending, the intents of failed object commits by the
+	// bucket and key they write.
+	pendingMu sync.Mutex
+	pending   map[string]string
+
+	// bucketFileMu serializes the updates of bucket records.
+	bucketFileMu sync.Mutex
+}
+
+// New returns the store of the storage directory dir.
+func New(dir string) *Store {
+	return &Store{Dir: dir, Layout: LayoutSharded, bucketLocks: map[string]*sync.RWMutex{}, uploadLocks: map[string]*uploadLock{}, pending: map[string]string{}}
 }
 
-// Initialize function to set up storageDir and bucketFile
-func InitStorage() {
-	StorageDir = config.GetStorageDir()
-	BucketFile = StorageDir + "/buckets.csv"
+// Close closes the metadata store.
+func (s *Store) Close() error {
+	if s.Meta == nil {
+		return nil
+	}
+	return s.Meta.Close()
 }
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+)
+
+// Object keys are stored under names that are safe on any filesystem:
+//
+//   - Lowercase letters, digits, '-', '_' and '.' are kept; every other byte,
+//     '/' and uppercase letters included, becomes '%' and two uppercase hex
+//     digits. Keys differing only in case never share a name, and no key
+//     reaches outside its bucket or into another object's directory.
+//   - A '.' starting a path element is escaped too, so no name is "." or ".."
+//     or collides with the hidden directories of a bucket, and neither are the
+//     names of other files kept in bucket directories.
+//   - Names longer than maxNameElement bytes are split into directories every
+//     maxNameElement-1 bytes, each ending in '~', which no escaped name holds.
+//
+// Keys the earlier versions accepted are stored under their own name.
+const maxNameElement = 255
+
+// reservedNames are files kept in bucket directories besides object data.
+var reservedNames = map[string]bool{"objects.csv": true}
+
+// ErrInvalidKeyName is returned by DecodeKey for a name EncodeKey cannot make.
+var ErrInvalidKeyName = errors.New("invalid encoded key name")
+
+const upperHex = "0123456789ABCDEF"
+
+// EncodeKey returns the data name of an object key, relative to its bucket.
+func EncodeKey(key string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' || c == '_' || (c == '.' && i > 0) {
+			escaped.WriteByte(c)
+		} else {
+			escaped.WriteByte('%')
+			escaped.WriteByte(upperHex[c>>4])
+			escaped.WriteByte(upperHex[c&15])
+		}
+	}
+	name := escaped.String()
+	if reservedNames[name] {
+		name = strings.ReplaceAll(name, ".", "%2E")
+	}
+	if len(name) <= maxNameElement {
+		return name
+	}
+
+	// Split between escapes, and keep a '.' from starting an element
+	var split strings.Builder
+	for len(name) > maxNameElement {
+		cut := maxNameElement - 1
+		if name[cut-1] == '%' {
+			cut--
+		} else if name[cut-2] == '%' {
+			cut -= 2
+		}
+		split.WriteString(name[:cut])
+		split.WriteString("~/")
+		name = name[cut:]
+		if name[0] == '.' {
+			name = "%2E" + name[1:]
+		}
+	}
+	split.WriteString(name)
+	return split.String()
+}
+
+// DecodeKey returns the object key stored under a name made by EncodeKey.
+func DecodeKey(name string) (string, error) {
+	name = strings.ReplaceAll(name, "~/", "")
+	var key strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] != '%' {
+			key.WriteByte(name[i])
+			continue
+		}
+		if i+2 >= len(name) {
+			return "", ErrInvalidKeyName
+		}
+		hi, lo := strings.IndexByte(upperHex, name[i+1]), strings.IndexByte(upperHex, name[i+2])
+		if hi < 0 || lo < 0 {
+			return "", ErrInvalidKeyName
+		}
+		key.WriteByte(byte(hi<<4 | lo))
+		i += 2
+	}
+	return key.String(), nil
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+var testKeys = []string{
+	"key",
+	"releases/v1.2/App.tar.gz",
+	"Key", "KEY", "kEy",
+	".", "..", "../escape", "a/../../b", ".hidden", "dir/.hidden",
+	".uploads", ".versions", ".shards", "objects.csv", "Objects.csv",
+	"a b+c%20&d=e?f#g",
+	"été/日本語/🙂",
+	"trailing/", "/leading", "//",
+	"~", "a~/b", "%2F",
+	"\x00\x01\x7f",
+	strings.Repeat("a", 1024),
+	strings.Repeat("A", 1024),
+	strings.Repeat("é", 512),
+	strings.Repeat("a", 253) + ".b",
+	strings.Repeat("a", 254) + ".b",
+	strings.Repeat("a", 252) + "/" + strings.Repeat("b", 300),
+}
+
+func TestEncodeKeyRoundTrip(t *testing.T) {
+	for _, key := range testKeys {
+		name := EncodeKey(key)
+		if got, err := DecodeKey(name); err != nil || got != key {
+			t.Errorf("DecodeKey(EncodeKey(%q)) = %q, %v", key, got, err)
+		}
+	}
+}
+
+// TestEncodeKeySafeNames checks that every element of an encoded name is
+// short, cannot leave the bucket, and cannot be a hidden or reserved name.
+func TestEncodeKeySafeNames(t *testing.T) {
+	names := map[string]string{}
+	for _, key := range testKeys {
+		name := EncodeKey(key)
+		elements := strings.Split(name, "/")
+		for i, element := range elements {
+			if element == "" || len(element) > maxNameElement || element[0] == '.' || reservedNames[element] {
+				t.Errorf("EncodeKey(%q) has element %q", key, element)
+			}
+			if i < len(elements)-1 && !strings.HasSuffix(element, "~") {
+				t.Errorf("EncodeKey(%q) splits without '~': %q", key, name)
+			}
+			for _, c := range element {
+				if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.ContainsRune("-_.%~ABCDEF", c) {
+					continue
+				}
+				t.Errorf("EncodeKey(%q) holds %q", key, c)
+			}
+		}
+
+		// Names must differ even on a case-insensitive filesystem
+		folded := strings.ToLower(name)
+		if other, ok := names[folded]; ok {
+			t.Errorf("EncodeKey(%q) and EncodeKey(%q) differ only in case: %q", key, other, name)
+		}
+		names[folded] = key
+	}
+}
+
+func TestEncodeKeyKeepsOldKeys(t *testing.T) {
+	// Keys the earlier releases accepted keep their names on disk
+	for _, key := range []string{"key", "a", "report-2024_05.csv", "v1.2.3"} {
+		if got := EncodeKey(key); got != key {
+			t.Errorf("EncodeKey(%q) = %q", key, got)
+		}
+	}
+}
+
+func TestDecodeKeyInvalid(t *testing.T) {
+	for _, name := range []string{"%", "%4", "a%4", "%zz", "%2f", "%G0"} {
+		if _, err := DecodeKey(name); err != ErrInvalidKeyName {
+			t.Errorf("DecodeKey(%q) = %v, want %v", name, err, ErrInvalidKeyName)
+		}
+	}
+}
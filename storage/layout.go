@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// Layout decides where the data of an object goes within its bucket.
+type Layout string
+
+// Layouts selectable with --layout. The flat layout keeps every object
+// directly in its bucket; the sharded one spreads them over 65536
+// directories named after the hash of their key, so no directory grows with
+// the bucket.
+const (
+	LayoutFlat    Layout = "flat"
+	LayoutSharded Layout = "sharded"
+)
+
+// layoutName is the data name recording the layout of the stored objects.
+// Bucket names cannot start with a dot, so it never clashes with a bucket.
+const layoutName = ".layout"
+
+// ParseLayout returns the layout named s.
+func ParseLayout(s string) (Layout, error) {
+	switch layout := Layout(s); layout {
+	case LayoutFlat, LayoutSharded:
+		return layout, nil
+	}
+	return "", fmt.Errorf("unknown storage layout %q", s)
+}
+
+// shardsDir is the directory inside a bucket, and inside its VersionsDir,
+// holding the shards of the sharded layout. EncodeKey escapes a leading dot,
+// so no key of the flat layout is stored under the same name as a shard.
+const shardsDir = ".shards"
+
+// shard returns the directories holding key in the sharded layout.
+func shard(key string) string {
+	sum := md5.Sum([]byte(key))
+	h := hex.EncodeToString(sum[:2])
+	return shardsDir + "/" + h[:2] + "/" + h[2:] + "/"
+}
+
+// ObjectName returns the data name of the current version of an object.
+func (l Layout) ObjectName(bucketName, key string) string {
+	if l == LayoutSharded {
+		return bucketName + "/" + shard(key) + EncodeKey(key)
+	}
+	return bucketName + "/" + EncodeKey(key)
+}
+
+// VersionName returns the data name of a noncurrent version of an object.
+func (l Layout) VersionName(bucketName, key, versionID string) string {
+	if l == LayoutSharded {
+		return bucketName + "/" + VersionsDir + "/" + shard(key) + EncodeKey(key) + "/" + versionID
+	}
+	return bucketName + "/" + VersionsDir + "/" + EncodeKey(key) + "/" + versionID
+}
+
+// StoredLayout returns the layout the stored objects use. Storage written
+// before layouts were recorded is flat; a store without buckets reports an
+// empty layout, as it may take any.
+func (s *Store) StoredLayout() (Layout, error) {
+	content, err := s.Data.Get(layoutName)
+	if errors.Is(err, fs.ErrNotExist) {
+		records, err := s.Meta.Buckets()
+		if err != nil || len(records) == 0 {
+			return "", err
+		}
+		return LayoutFlat, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+
+	name, err := io.ReadAll(io.NewSectionReader(content, 0, content.Size()))
+	if err != nil {
+		return "", err
+	}
+	return ParseLayout(strings.TrimSpace(string(name)))
+}
+
+// SaveLayout records the layout the stored objects use.
+func (s *Store) SaveLayout(layout Layout) error {
+	_, err := s.Data.Put(layoutName, bytes.NewReader([]byte(string(layout)+"\n")))
+	return err
+}
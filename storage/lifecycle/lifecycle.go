@@ -0,0 +1,330 @@
+// Package lifecycle parses bucket lifecycle configurations and decides which
+// rules apply to an object and when their actions are due.
+package lifecycle
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"time"
+
+	"triple-s/storage"
+)
+
+// Rule states.
+const (
+	StatusEnabled  = "Enabled"
+	StatusDisabled = "Disabled"
+)
+
+// MaxRules is the largest number of rules in one configuration.
+const MaxRules = 1000
+
+var (
+	ErrNoSuchLifecycleConfiguration = &storage.Error{Code: "NoSuchLifecycleConfiguration", Message: "The lifecycle configuration does not exist.", StatusCode: http.StatusNotFound}
+	ErrMalformedXML                 = &storage.Error{Code: "MalformedXML", Message: "The XML you provided was not well-formed or did not validate against our published schema.", StatusCode: http.StatusBadRequest}
+)
+
+// Configuration is the body of the ?lifecycle subresource.
+type Configuration struct {
+	XMLName xml.Name `xml:"LifecycleConfiguration"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	Rules   []Rule   `xml:"Rule"`
+}
+
+// Rule selects objects with its filter and lists what happens to them.
+type Rule struct {
+	ID     string  `xml:"ID,omitempty"`
+	Prefix *string `xml:"Prefix"` // superseded by Filter, still accepted
+	Filter *Filter `xml:"Filter"`
+	Status string  `xml:"Status"`
+
+	Expiration                     *Expiration                     `xml:"Expiration"`
+	NoncurrentVersionExpiration    *NoncurrentVersionExpiration    `xml:"NoncurrentVersionExpiration"`
+	AbortIncompleteMultipartUpload *AbortIncompleteMultipartUpload `xml:"AbortIncompleteMultipartUpload"`
+}
+
+// Filter holds one condition, or several within And.
+type Filter struct {
+	Prefix                *string `xml:"Prefix"`
+	Tag                   *Tag    `xml:"Tag"`
+	ObjectSizeGreaterThan *int64  `xml:"ObjectSizeGreaterThan"`
+	ObjectSizeLessThan    *int64  `xml:"ObjectSizeLessThan"`
+	And                   *And    `xml:"And"`
+}
+
+// And combines the conditions of a filter; all of them must hold.
+type And struct {
+	Prefix                *string `xml:"Prefix"`
+	Tags                  []Tag   `xml:"Tag"`
+	ObjectSizeGreaterThan *int64  `xml:"ObjectSizeGreaterThan"`
+	ObjectSizeLessThan    *int64  `xml:"ObjectSizeLessThan"`
+}
+
+// Tag is an object tag a filter requires.
+type Tag struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+// Expiration removes current versions a number of days after they were
+// written or on a date. With ExpiredObjectDeleteMarker it removes delete
+// markers that no longer hide any version.
+type Expiration struct {
+	Days                      int        `xml:"Days,omitempty"`
+	Date                      *time.Time `xml:"Date"`
+	ExpiredObjectDeleteMarker bool       `xml:"ExpiredObjectDeleteMarker,omitempty"`
+}
+
+// NoncurrentVersionExpiration removes versions a number of days after a
+// newer one replaced them, keeping the newest NewerNoncurrentVersions.
+type NoncurrentVersionExpiration struct {
+	NoncurrentDays          int  `xml:"NoncurrentDays"`
+	NewerNoncurrentVersions *int `xml:"NewerNoncurrentVersions"`
+}
+
+// NewerVersions returns the number of newest noncurrent versions kept.
+func (n *NoncurrentVersionExpiration) NewerVersions() int {
+	if n.NewerNoncurrentVersions == nil {
+		return 0
+	}
+	return *n.NewerNoncurrentVersions
+}
+
+// AbortIncompleteMultipartUpload aborts uploads left unfinished for a
+// number of days.
+type AbortIncompleteMultipartUpload struct {
+	DaysAfterInitiation int `xml:"DaysAfterInitiation"`
+}
+
+// Object is what filters look at in an object version.
+type Object struct {
+	Key  string
+	Size int64
+	Tags map[string]string
+}
+
+// Parse reads and validates a lifecycle configuration.
+func Parse(data []byte) (*Configuration, error) {
+	var config Configuration
+	if err := xml.Unmarshal(data, &config); err != nil {
+		return nil, ErrMalformedXML
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func invalid(message string) error {
+	return &storage.Error{Code: "InvalidArgument", Message: message, StatusCode: http.StatusBadRequest}
+}
+
+func (c *Configuration) validate() error {
+	if len(c.Rules) == 0 || len(c.Rules) > MaxRules {
+		return ErrMalformedXML
+	}
+	ids := map[string]bool{}
+	for _, rule := range c.Rules {
+		if len(rule.ID) > 255 {
+			return invalid("ID length should not exceed allowed limit of 255")
+		}
+		if rule.ID != "" && ids[rule.ID] {
+			return invalid("Rule ID must be unique. Found same ID for more than one rule")
+		}
+		ids[rule.ID] = true
+
+		if rule.Status != StatusEnabled && rule.Status != StatusDisabled {
+			return ErrMalformedXML
+		}
+		if rule.Prefix != nil && rule.Filter != nil {
+			return ErrMalformedXML
+		}
+		if rule.Expiration == nil && rule.NoncurrentVersionExpiration == nil && rule.AbortIncompleteMultipartUpload == nil {
+			return invalid("At least one action needs to be specified in a rule")
+		}
+		if err := rule.Filter.validate(); err != nil {
+			return err
+		}
+
+		if e := rule.Expiration; e != nil {
+			set := 0
+			if e.Days != 0 {
+				set++
+			}
+			if e.Date != nil {
+				set++
+			}
+			if e.ExpiredObjectDeleteMarker {
+				set++
+			}
+			if set != 1 {
+				return ErrMalformedXML
+			}
+			if e.Days < 0 {
+				return invalid("'Days' for Expiration action must be a positive integer")
+			}
+			if e.Date != nil && !e.Date.Equal(e.Date.UTC().Truncate(24*time.Hour)) {
+				return invalid("'Date' must be at midnight GMT")
+			}
+			if e.ExpiredObjectDeleteMarker && len(rule.tags()) > 0 {
+				return invalid("ExpiredObjectDeleteMarker cannot be specified with tags")
+			}
+		}
+		if n := rule.NoncurrentVersionExpiration; n != nil {
+			if n.NoncurrentDays <= 0 {
+				return invalid("'NoncurrentDays' for NoncurrentVersionExpiration action must be a positive integer")
+			}
+			if newer := n.NewerNoncurrentVersions; newer != nil && (*newer < 1 || *newer > 100) {
+				return invalid("'NewerNoncurrentVersions' must be between 1 and 100")
+			}
+		}
+		if a := rule.AbortIncompleteMultipartUpload; a != nil {
+			if a.DaysAfterInitiation <= 0 {
+				return invalid("'DaysAfterInitiation' for AbortIncompleteMultipartUpload action must be a positive integer")
+			}
+			if len(rule.tags()) > 0 || rule.minSize() != nil || rule.maxSize() != nil {
+				return invalid("AbortIncompleteMultipartUpload cannot be specified with tags or object size")
+			}
+		}
+	}
+	return nil
+}
+
+func (f *Filter) validate() error {
+	if f == nil {
+		return nil
+	}
+	set := 0
+	for _, present := range []bool{f.Prefix != nil, f.Tag != nil, f.ObjectSizeGreaterThan != nil, f.ObjectSizeLessThan != nil, f.And != nil} {
+		if present {
+			set++
+		}
+	}
+	if set > 1 {
+		return ErrMalformedXML
+	}
+	if f.And != nil {
+		keys := map[string]bool{}
+		for _, tag := range f.And.Tags {
+			if keys[tag.Key] {
+				return invalid("Duplicate Tag Keys are not allowed.")
+			}
+			keys[tag.Key] = true
+		}
+	}
+	if greater, less := f.minSize(), f.maxSize(); greater != nil && less != nil && *greater >= *less {
+		return invalid("ObjectSizeGreaterThan must be less than ObjectSizeLessThan")
+	}
+	return nil
+}
+
+// Enabled reports whether the rule is applied.
+func (r *Rule) Enabled() bool {
+	return r.Status == StatusEnabled
+}
+
+// MatchesPrefix reports whether the rule's prefix admits key. Uploads and
+// delete markers have no tags or size, so only the prefix applies to them.
+func (r *Rule) MatchesPrefix(key string) bool {
+	return strings.HasPrefix(key, r.prefix())
+}
+
+// Matches reports whether the rule's filter selects an object version.
+func (r *Rule) Matches(object Object) bool {
+	if !r.MatchesPrefix(object.Key) {
+		return false
+	}
+	for _, tag := range r.tags() {
+		if value, ok := object.Tags[tag.Key]; !ok || value != tag.Value {
+			return false
+		}
+	}
+	if greater := r.minSize(); greater != nil && object.Size <= *greater {
+		return false
+	}
+	if less := r.maxSize(); less != nil && object.Size >= *less {
+		return false
+	}
+	return true
+}
+
+// HasObjectFilter reports whether the rule filters by tags or size, which
+// delete markers never match.
+func (r *Rule) HasObjectFilter() bool {
+	return len(r.tags()) > 0 || r.minSize() != nil || r.maxSize() != nil
+}
+
+func (r *Rule) prefix() string {
+	switch {
+	case r.Prefix != nil:
+		return *r.Prefix
+	case r.Filter == nil:
+		return ""
+	case r.Filter.Prefix != nil:
+		return *r.Filter.Prefix
+	case r.Filter.And != nil && r.Filter.And.Prefix != nil:
+		return *r.Filter.And.Prefix
+	}
+	return ""
+}
+
+func (r *Rule) tags() []Tag {
+	switch {
+	case r.Filter == nil:
+		return nil
+	case r.Filter.Tag != nil:
+		return []Tag{*r.Filter.Tag}
+	case r.Filter.And != nil:
+		return r.Filter.And.Tags
+	}
+	return nil
+}
+
+func (r *Rule) minSize() *int64 { return r.Filter.minSize() }
+func (r *Rule) maxSize() *int64 { return r.Filter.maxSize() }
+
+func (f *Filter) minSize() *int64 {
+	switch {
+	case f == nil:
+		return nil
+	case f.And != nil:
+		return f.And.ObjectSizeGreaterThan
+	}
+	return f.ObjectSizeGreaterThan
+}
+
+func (f *Filter) maxSize() *int64 {
+	switch {
+	case f == nil:
+		return nil
+	case f.And != nil:
+		return f.And.ObjectSizeLessThan
+	}
+	return f.ObjectSizeLessThan
+}
+
+// Due reports whether days have passed since since, counted as S3 does: the
+// action runs at the first midnight UTC after since plus days.
+func Due(since time.Time, days int, now time.Time) bool {
+	at := since.UTC().Add(time.Duration(days) * 24 * time.Hour)
+	if day := at.Truncate(24 * time.Hour); !day.Equal(at) {
+		at = day.Add(24 * time.Hour)
+	}
+	return !now.Before(at)
+}
+
+// ExpiresCurrent reports whether the rule's Expiration removes a current
+// version written at lastModified.
+func (r *Rule) ExpiresCurrent(lastModified, now time.Time) bool {
+	e := r.Expiration
+	switch {
+	case e == nil:
+		return false
+	case e.Date != nil:
+		return !now.Before(*e.Date)
+	case e.Days > 0:
+		return Due(lastModified, e.Days, now)
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package lifecycle
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"triple-s/storage"
+)
+
+func TestParse(t *testing.T) {
+	rule := func(body string) string {
+		return "<LifecycleConfiguration><Rule>" + body + "</Rule></LifecycleConfiguration>"
+	}
+	tests := []struct {
+		name   string
+		config string
+		valid  bool
+	}{
+		{"days", rule("<Status>Enabled</Status><Expiration><Days>30</Days></Expiration>"), true},
+		{"date", rule("<Status>Enabled</Status><Expiration><Date>2030-01-01T00:00:00Z</Date></Expiration>"), true},
+		{"old prefix", rule("<Prefix>logs/</Prefix><Status>Disabled</Status><Expiration><Days>1</Days></Expiration>"), true},
+		{"noncurrent", rule("<Filter><Prefix>a</Prefix></Filter><Status>Enabled</Status><NoncurrentVersionExpiration><NoncurrentDays>7</NoncurrentDays><NewerNoncurrentVersions>3</NewerNoncurrentVersions></NoncurrentVersionExpiration>"), true},
+		{"uploads", rule("<Filter></Filter><Status>Enabled</Status><AbortIncompleteMultipartUpload><DaysAfterInitiation>2</DaysAfterInitiation></AbortIncompleteMultipartUpload>"), true},
+		{"and", rule("<Filter><And><Prefix>a</Prefix><Tag><Key>k</Key><Value>v</Value></Tag><ObjectSizeGreaterThan>10</ObjectSizeGreaterThan><ObjectSizeLessThan>20</ObjectSizeLessThan></And></Filter><Status>Enabled</Status><Expiration><Days>1</Days></Expiration>"), true},
+		{"delete markers", rule("<Status>Enabled</Status><Expiration><ExpiredObjectDeleteMarker>true</ExpiredObjectDeleteMarker></Expiration>"), true},
+
+		{"not xml", "<LifecycleConfiguration>", false},
+		{"no rules", "<LifecycleConfiguration></LifecycleConfiguration>", false},
+		{"no action", rule("<Status>Enabled</Status>"), false},
+		{"bad status", rule("<Status>On</Status><Expiration><Days>1</Days></Expiration>"), false},
+		{"prefix and filter", rule("<Prefix>a</Prefix><Filter><Prefix>a</Prefix></Filter><Status>Enabled</Status><Expiration><Days>1</Days></Expiration>"), false},
+		{"two filter conditions", rule("<Filter><Prefix>a</Prefix><Tag><Key>k</Key><Value>v</Value></Tag></Filter><Status>Enabled</Status><Expiration><Days>1</Days></Expiration>"), false},
+		{"days and date", rule("<Status>Enabled</Status><Expiration><Days>1</Days><Date>2030-01-01T00:00:00Z</Date></Expiration>"), false},
+		{"negative days", rule("<Status>Enabled</Status><Expiration><Days>-1</Days></Expiration>"), false},
+		{"date not at midnight", rule("<Status>Enabled</Status><Expiration><Date>2030-01-01T12:00:00Z</Date></Expiration>"), false},
+		{"no noncurrent days", rule("<Status>Enabled</Status><NoncurrentVersionExpiration><NoncurrentDays>0</NoncurrentDays></NoncurrentVersionExpiration>"), false},
+		{"too many newer versions", rule("<Status>Enabled</Status><NoncurrentVersionExpiration><NoncurrentDays>1</NoncurrentDays><NewerNoncurrentVersions>101</NewerNoncurrentVersions></NoncurrentVersionExpiration>"), false},
+		{"uploads by tag", rule("<Filter><Tag><Key>k</Key><Value>v</Value></Tag></Filter><Status>Enabled</Status><AbortIncompleteMultipartUpload><DaysAfterInitiation>1</DaysAfterInitiation></AbortIncompleteMultipartUpload>"), false},
+		{"empty size range", rule("<Filter><And><ObjectSizeGreaterThan>20</ObjectSizeGreaterThan><ObjectSizeLessThan>20</ObjectSizeLessThan></And></Filter><Status>Enabled</Status><Expiration><Days>1</Days></Expiration>"), false},
+		{"duplicate tags", rule("<Filter><And><Tag><Key>k</Key><Value>1</Value></Tag><Tag><Key>k</Key><Value>2</Value></Tag></And></Filter><Status>Enabled</Status><Expiration><Days>1</Days></Expiration>"), false},
+		{"duplicate IDs", "<LifecycleConfiguration>" +
+			"<Rule><ID>x</ID><Status>Enabled</Status><Expiration><Days>1</Days></Expiration></Rule>" +
+			"<Rule><ID>x</ID><Status>Enabled</Status><Expiration><Days>2</Days></Expiration></Rule>" +
+			"</LifecycleConfiguration>", false},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.config))
+		if tt.valid && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		var s3err *storage.Error
+		if !tt.valid && (!errors.As(err, &s3err) || s3err.StatusCode != 400) {
+			t.Errorf("%s: got %v, want a 400 error", tt.name, err)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	prefix := func(p string) *string { return &p }
+	size := func(n int64) *int64 { return &n }
+	tagged := Object{Key: "logs/a", Size: 15, Tags: map[string]string{"env": "ci", "team": "x"}}
+	tests := []struct {
+		name   string
+		rule   Rule
+		object Object
+		want   bool
+	}{
+		{"no filter", Rule{}, tagged, true},
+		{"old prefix", Rule{Prefix: prefix("logs/")}, tagged, true},
+		{"other prefix", Rule{Filter: &Filter{Prefix: prefix("data/")}}, tagged, false},
+		{"tag", Rule{Filter: &Filter{Tag: &Tag{"env", "ci"}}}, tagged, true},
+		{"other tag value", Rule{Filter: &Filter{Tag: &Tag{"env", "prod"}}}, tagged, false},
+		{"missing tag", Rule{Filter: &Filter{Tag: &Tag{"owner", ""}}}, tagged, false},
+		{"greater than", Rule{Filter: &Filter{ObjectSizeGreaterThan: size(14)}}, tagged, true},
+		{"not greater than", Rule{Filter: &Filter{ObjectSizeGreaterThan: size(15)}}, tagged, false},
+		{"not less than", Rule{Filter: &Filter{ObjectSizeLessThan: size(15)}}, tagged, false},
+		{"and", Rule{Filter: &Filter{And: &And{Prefix: prefix("logs/"), Tags: []Tag{{"env", "ci"}, {"team", "x"}}, ObjectSizeLessThan: size(16)}}}, tagged, true},
+		{"and with one tag off", Rule{Filter: &Filter{And: &And{Tags: []Tag{{"env", "ci"}, {"team", "y"}}}}}, tagged, false},
+		{"and with prefix off", Rule{Filter: &Filter{And: &And{Prefix: prefix("x"), Tags: []Tag{{"env", "ci"}}}}}, tagged, false},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.Matches(tt.object); got != tt.want {
+			t.Errorf("%s: Matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDue(t *testing.T) {
+	written := time.Date(2024, 5, 1, 15, 30, 0, 0, time.UTC)
+	tests := []struct {
+		days int
+		now  time.Time
+		want bool
+	}{
+		// Due at the first midnight after written plus days: 2024-05-03T00:00Z
+		{1, time.Date(2024, 5, 2, 23, 59, 59, 0, time.UTC), false},
+		{1, time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC), true},
+		{30, time.Date(2024, 5, 31, 12, 0, 0, 0, time.UTC), false},
+		{30, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), true},
+		// Times in other zones count in UTC
+		{1, time.Date(2024, 5, 3, 1, 0, 0, 0, time.FixedZone("CEST", 2*3600)), false},
+	}
+	for _, tt := range tests {
+		if got := Due(written, tt.days, tt.now); got != tt.want {
+			t.Errorf("Due(%v, %d, %v) = %v, want %v", written, tt.days, tt.now, got, tt.want)
+		}
+	}
+	midnight := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	if !Due(midnight, 1, midnight.Add(24*time.Hour)) {
+		t.Error("a version written at midnight is not due a day later")
+	}
+}
+
+func TestExpiresCurrent(t *testing.T) {
+	written := time.Date(2024, 5, 1, 15, 30, 0, 0, time.UTC)
+	date := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		expiration *Expiration
+		now        time.Time
+		want       bool
+	}{
+		{"no expiration", nil, date, false},
+		{"days not yet", &Expiration{Days: 2}, written.Add(24 * time.Hour), false},
+		{"days", &Expiration{Days: 2}, written.Add(3 * 24 * time.Hour), true},
+		{"before date", &Expiration{Date: &date}, date.Add(-time.Second), false},
+		{"on date", &Expiration{Date: &date}, date, true},
+		{"delete markers only", &Expiration{ExpiredObjectDeleteMarker: true}, date, false},
+	}
+	for _, tt := range tests {
+		rule := Rule{Status: StatusEnabled, Expiration: tt.expiration}
+		if got := rule.ExpiresCurrent(written, tt.now); got != tt.want {
+			t.Errorf("%s: ExpiresCurrent = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// LockFileName is the file in the storage root that a running server holds
+// locked, so two processes never serve the same directory.
+const LockFileName = ".lock"
+
+// CleanShutdownName is the file in the storage root marking that the last
+// server to use the directory shut down cleanly.
+const CleanShutdownName = ".clean-shutdown"
+
+// ErrStorageLocked is returned by LockStorageDir when another process already
+// uses the storage directory.
+var ErrStorageLocked = errors.New("storage directory is in use by another process")
+
+// bucketLock returns the lock guarding the object metadata of a bucket.
+func (s *Store) bucketLock(name string) *sync.RWMutex {
+	s.bucketLocksMu.Lock()
+	defer s.bucketLocksMu.Unlock()
+
+	lock, ok := s.bucketLocks[name]
+	if !ok {
+		lock = &sync.RWMutex{}
+		s.bucketLocks[name] = lock
+	}
+	return lock
+}
+
+// LockBucket takes the bucket's lock for a metadata update and returns the
+// function that releases it. Updates of one bucket run one at a time.
+func (s *Store) LockBucket(name string) (unlock func()) {
+	lock := s.bucketLock(name)
+	lock.Lock()
+	return lock.Unlock
+}
+
+// RLockBucket takes the bucket's lock for reading, which keeps the versions a
+// reader has looked up in place until it releases the lock.
+func (s *Store) RLockBucket(name string) (unlock func()) {
+	lock := s.bucketLock(name)
+	lock.RLock()
+	return lock.RUnlock
+}
+
+// uploadLock guards one multipart upload. It is dropped once nobody holds or
+// waits for it, as upload IDs are never reused.
+type uploadLock struct {
+	sync.Mutex
+	users int
+}
+
+// LockUpload takes the lock of a multipart upload and returns the function
+// that releases it. Parts, completion and abort of one upload run one at a
+// time.
+func (s *Store) LockUpload(bucketName, uploadID string) (unlock func()) {
+	name := bucketName + "/" + uploadID
+	s.uploadLocksMu.Lock()
+	lock, ok := s.uploadLocks[name]
+	if !ok {
+		lock = &uploadLock{}
+		s.uploadLocks[name] = lock
+	}
+	lock.users++
+	s.uploadLocksMu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		s.uploadLocksMu.Lock()
+		if lock.users--; lock.users == 0 {
+			delete(s.uploadLocks, name)
+		}
+		s.uploadLocksMu.Unlock()
+	}
+}
+
+// LockBucketFile serializes the updates of bucket records.
+func (s *Store) LockBucketFile() (unlock func()) {
+	s.bucketFileMu.Lock()
+	return s.bucketFileMu.Unlock
+}
+
+// LockStorageDir locks the storage directory for this process. The lock is
+// released by the returned function or when the process exits.
+func (s *Store) LockStorageDir() (release func() error, err error) {
+	return lockFile(filepath.Join(s.Dir, LockFileName))
+}
+
+// TakeCleanShutdown reports whether the last server to use the storage
+// directory shut down cleanly, and removes the mark so that a crash of this
+// one is noticed in turn. A store without a directory always starts clean.
+func (s *Store) TakeCleanShutdown() (bool, error) {
+	if s.Dir == "" {
+		return true, nil
+	}
+	err := os.Remove(filepath.Join(s.Dir, CleanShutdownName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// MarkCleanShutdown records that the server shut down cleanly. It is called
+// once the metadata store is closed.
+func (s *Store) MarkCleanShutdown() error {
+	if s.Dir == "" {
+		return nil
+	}
+	return os.WriteFile(filepath.Join(s.Dir, CleanShutdownName), nil, 0o644)
+}
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package storage
+
+import (
+	"os"
+)
+
+// lockFile creates path exclusively and removes it on release. Without flock
+// a crashed server leaves the file behind, and it has to be removed by hand.
+func lockFile(path string) (func() error, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if os.IsExist(err) {
+		return nil, ErrStorageLocked
+	}
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+	return func() error { return os.Remove(path) }, nil
+}
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"triple-s/storage/btree"
+	"triple-s/storage/csvmeta"
+	"triple-s/storage/index"
+)
+
+// Metadata backends selectable with --meta-backend.
+const (
+	MetaBackendCSV     = "csv"
+	MetaBackendJournal = "journal"
+	MetaBackendBTree   = "btree"
+	// MetaBackendMemory keeps the metadata in memory only, to go with the
+	// memory data backend.
+	MetaBackendMemory = "memory"
+)
+
+// Files of the journal and B-tree backends in the storage root.
+const (
+	JournalName = "metadata.journal"
+	BTreeName   = "metadata.btree"
+)
+
+// MetadataStore holds the bucket and object metadata.
+//
+// Bucket rows hold the columns of csvmeta.BucketHeaders, though rows written
+// by older releases may end early. Object rows hold the columns of
+// csvmeta.ObjectHeaders, one row per version, oldest first. Stores return
+// rows the caller may modify, except the rows passed to a Scan callback.
+type MetadataStore interface {
+	// Bucket returns the row of a bucket and whether it exists.
+	Bucket(name string) ([]string, bool, error)
+	// Buckets returns the rows of all buckets sorted by name.
+	Buckets() ([][]string, error)
+	// PutBucket creates or replaces the row of the bucket named by row[0].
+	PutBucket(row []string) error
+	// DeleteBucket removes a bucket together with the metadata of its objects.
+	DeleteBucket(name string) error
+
+	// Versions returns the rows of every version of an object.
+	Versions(bucketName, key string) ([][]string, error)
+	// SetVersions replaces the rows of every version of an object; no rows
+	// remove the object.
+	SetVersions(bucketName, key string, rows [][]string) error
+	// Scan calls fn for each object of a bucket whose key is at least from,
+	// in key order, until fn returns false. fn must not call back into the store.
+	Scan(bucketName, from string, fn func(key string, versions [][]string) bool) error
+
+	Close() error
+}
+
+// OpenMeta opens the metadata store of the given backend. A journal or
+// B-tree store is created on first use and filled from the metadata the
+// server kept before: the journal when there is one, the CSV files otherwise.
+func (s *Store) OpenMeta(backend string) error {
+	var err error
+	switch backend {
+	case MetaBackendCSV:
+		s.Meta, err = csvmeta.Open(s.Dir)
+	case MetaBackendJournal:
+		s.Meta, err = index.Open(filepath.Join(s.Dir, JournalName), func(x *index.Index) error {
+			return s.importMeta(x, backend)
+		})
+	case MetaBackendBTree:
+		s.Meta, err = s.openBTree()
+	case MetaBackendMemory:
+		s.Meta = index.New()
+	default:
+		return fmt.Errorf("unknown metadata backend %q", backend)
+	}
+	return err
+}
+
+// openBTree opens the B-tree store. A new store is built under a temporary
+// name and renamed into place once the import is complete, so an import cut
+// short is started over on the next start.
+func (s *Store) openBTree() (MetadataStore, error) {
+	path := filepath.Join(s.Dir, BTreeName)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		tmpPath := path + ".import"
+		os.Remove(tmpPath)
+		store, err := btree.OpenStore(tmpPath)
+		if err != nil {
+			return nil, err
+		}
+		err = s.importMeta(store, MetaBackendBTree)
+		if closeErr := store.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(tmpPath, path)
+		}
+		if err != nil {
+			os.Remove(tmpPath)
+			return nil, err
+		}
+	}
+	return btree.OpenStore(path)
+}
+
+// importMeta fills a new store of the given backend from the metadata of
+// earlier runs, if there is any.
+func (s *Store) importMeta(dst MetadataStore, backend string) error {
+	var src MetadataStore
+	var err error
+	switch {
+	case backend != MetaBackendJournal && fileExists(filepath.Join(s.Dir, JournalName)):
+		src, err = index.Open(filepath.Join(s.Dir, JournalName), nil)
+	case csvmeta.Exists(s.Dir):
+		src, err = csvmeta.Open(s.Dir)
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	buckets, err := src.Buckets()
+	if err != nil {
+		return err
+	}
+	imported := 0
+	for _, bucket := range buckets {
+		if bucket[3] == "Deleted" {
+			continue
+		}
+		if err := dst.PutBucket(bucket); err != nil {
+			return err
+		}
+
+		var putErr error
+		err := src.Scan(bucket[0], "", func(key string, versions [][]string) bool {
+			putErr = dst.SetVersions(bucket[0], key, versions)
+			return putErr == nil
+		})
+		if err == nil {
+			err = putErr
+		}
+		if err != nil {
+			return err
+		}
+		imported++
+	}
+
+	if imported > 0 {
+		fmt.Printf("Imported the metadata of %d buckets into the %s store\n", imported, backend)
+	}
+	return nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+var metaBackends = []string{MetaBackendCSV, MetaBackendJournal, MetaBackendBTree, MetaBackendMemory}
+
+func openMeta(t *testing.T, dir, backend string) *Store {
+	t.Helper()
+	st := New(dir)
+	if err := st.OpenMeta(backend); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Meta.Close() })
+	return st
+}
+
+func bucketRow(name string) []string {
+	return []string{name, "2024-05-01T12:00:00Z", "2024-05-01T12:00:00Z", "Active", "", "", "", "", "0", "0", ""}
+}
+
+func objectRow(bucketName, key, versionID string) []string {
+	return []string{bucketName, key, "text/plain", "4", "2024-05-01T12:00:00Z", versionID, "true", "false", "etag", ""}
+}
+
+// scanKeys returns the keys Scan visits from from, stopping after limit keys.
+func scanKeys(t *testing.T, meta MetadataStore, bucketName, from string, limit int) []string {
+	t.Helper()
+	var keys []string
+	err := meta.Scan(bucketName, from, func(key string, versions [][]string) bool {
+		keys = append(keys, key)
+		return len(keys) < limit
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+// TestMetadataStores runs the same operations against every backend.
+func TestMetadataStores(t *testing.T) {
+	for _, backend := range metaBackends {
+		t.Run(backend, func(t *testing.T) {
+			dir := t.TempDir()
+			meta := openMeta(t, dir, backend).Meta
+
+			if _, ok, err := meta.Bucket("missing"); err != nil || ok {
+				t.Errorf("Bucket of a missing bucket = %v, %v", ok, err)
+			}
+			for _, name := range []string{"zebra", "alpha", "beta"} {
+				if err := meta.PutBucket(bucketRow(name)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			changed := bucketRow("beta")
+			changed[4] = "Enabled"
+			if err := meta.PutBucket(changed); err != nil {
+				t.Fatal(err)
+			}
+			if row, ok, err := meta.Bucket("beta"); err != nil || !ok || !reflect.DeepEqual(row, changed) {
+				t.Errorf("Bucket(beta) = %v, %v, %v, want %v", row, ok, err, changed)
+			}
+			buckets, err := meta.Buckets()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, row := range buckets {
+				names = append(names, row[0])
+			}
+			if !reflect.DeepEqual(names, []string{"alpha", "beta", "zebra"}) {
+				t.Errorf("Buckets = %v, want [alpha beta zebra]", names)
+			}
+
+			// Objects of neighbouring buckets stay apart
+			for _, key := range []string{"c", "a", "b/x", "b", "d"} {
+				if err := meta.SetVersions("beta", key, [][]string{objectRow("beta", key, "1")}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := meta.SetVersions("alpha", "other", [][]string{objectRow("alpha", "other", "null")}); err != nil {
+				t.Fatal(err)
+			}
+			versions := [][]string{objectRow("beta", "b", "1"), objectRow("beta", "b", "2")}
+			versions[0][6] = "false"
+			if err := meta.SetVersions("beta", "b", versions); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := meta.Versions("beta", "b"); err != nil || !reflect.DeepEqual(got, versions) {
+				t.Errorf("Versions(beta, b) = %v, %v, want %v", got, err, versions)
+			}
+			if got, err := meta.Versions("beta", "missing"); err != nil || len(got) != 0 {
+				t.Errorf("Versions of a missing key = %v, %v", got, err)
+			}
+			if err := meta.SetVersions("beta", "d", nil); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, tt := range []struct {
+				from  string
+				limit int
+				want  []string
+			}{
+				{"", 10, []string{"a", "b", "b/x", "c"}},
+				{"b", 10, []string{"b", "b/x", "c"}},
+				{"b0", 10, []string{"c"}},
+				{"", 2, []string{"a", "b"}},
+				{"z", 10, nil},
+			} {
+				if got := scanKeys(t, meta, "beta", tt.from, tt.limit); !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("Scan from %q, limit %d = %v, want %v", tt.from, tt.limit, got, tt.want)
+				}
+			}
+			if got := scanKeys(t, meta, "missing", "", 10); len(got) != 0 {
+				t.Errorf("Scan of a missing bucket = %v", got)
+			}
+
+			if err := meta.DeleteBucket("alpha"); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok, _ := meta.Bucket("alpha"); ok {
+				t.Error("deleted bucket still exists")
+			}
+			if got := scanKeys(t, meta, "alpha", "", 10); len(got) != 0 {
+				t.Errorf("objects of a deleted bucket = %v", got)
+			}
+
+			if backend == MetaBackendMemory {
+				return
+			}
+			meta.Close()
+			meta = openMeta(t, dir, backend).Meta
+			if buckets, err := meta.Buckets(); err != nil || len(buckets) != 2 {
+				t.Errorf("Buckets after reopening = %v, %v", buckets, err)
+			}
+			if got, err := meta.Versions("beta", "b"); err != nil || !reflect.DeepEqual(got, versions) {
+				t.Errorf("Versions(beta, b) after reopening = %v, %v", got, err)
+			}
+			if got := scanKeys(t, meta, "beta", "", 10); !reflect.DeepEqual(got, []string{"a", "b", "b/x", "c"}) {
+				t.Errorf("Scan after reopening = %v", got)
+			}
+		})
+	}
+}
+
+// TestMetadataImport checks that the journal and B-tree stores are filled
+// from the CSV files of an earlier run, and the B-tree store from a journal.
+func TestMetadataImport(t *testing.T) {
+	for _, chain := range [][]string{
+		{MetaBackendCSV, MetaBackendJournal},
+		{MetaBackendCSV, MetaBackendBTree},
+		{MetaBackendCSV, MetaBackendJournal, MetaBackendBTree},
+	} {
+		t.Run(fmt.Sprint(chain), func(t *testing.T) {
+			dir := t.TempDir()
+			meta := openMeta(t, dir, MetaBackendCSV).Meta
+			for _, name := range []string{"kept", "gone"} {
+				if err := meta.PutBucket(bucketRow(name)); err != nil {
+					t.Fatal(err)
+				}
+				if err := meta.SetVersions(name, "key", [][]string{objectRow(name, "key", "null")}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Buckets marked deleted by older releases are left behind
+			deleted := bucketRow("gone")
+			deleted[3] = "Deleted"
+			if err := meta.PutBucket(deleted); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, backend := range chain[1:] {
+				meta.Close()
+				meta = openMeta(t, dir, backend).Meta
+			}
+			buckets, err := meta.Buckets()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(buckets) != 1 || buckets[0][0] != "kept" {
+				t.Errorf("imported buckets = %v, want [kept]", buckets)
+			}
+			if got, err := meta.Versions("kept", "key"); err != nil || !reflect.DeepEqual(got, [][]string{objectRow("kept", "key", "null")}) {
+				t.Errorf("imported versions = %v, %v", got, err)
+			}
+		})
+	}
+}
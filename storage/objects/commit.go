@@ -0,0 +1,311 @@
+package objects
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"triple-s/storage"
+	"triple-s/storage/backend"
+)
+
+// commit lists the steps that install a new version of an object, or remove
+// one for good. It is written to the staging area before any step runs, so a
+// write interrupted by a crash is finished at the next startup instead of
+// leaving the object and its metadata out of step.
+type commit struct {
+	Bucket    string
+	Key       string
+	VersionID string
+	// TempName is the staged data of the new version; empty for delete markers.
+	TempName string
+	// Archive is the version ID of the current data to move to the versions directory.
+	Archive string
+	// Drop is the version ID of a noncurrent version whose data the new version replaces.
+	Drop string
+	// Replace is set when the new version takes the place of the current one.
+	Replace bool
+	// Record is the metadata row of the new version, or of the removed one.
+	Record []string
+	// Remove is set when the commit removes the version Record describes
+	// instead of adding it.
+	Remove bool
+	// Promote is the version ID of the noncurrent version whose data becomes
+	// current when the removed version was the latest.
+	Promote string
+
+	// pending is set when the commit failed part way and its intent was kept
+	// for the next write of the object, or the next startup, to finish; the
+	// staged data must then stay too.
+	pending bool
+}
+
+// commitFields is the number of fields of a commit intent before its record.
+const commitFields = 7
+
+// discardStaged deletes the staged data of a write, unless its commit failed
+// part way and still needs it. c is nil when the write failed before its
+// commit was planned.
+func discardStaged(st *storage.Store, tempName string, c *commit) {
+	if c != nil && c.pending {
+		return
+	}
+	st.Data.Delete(tempName)
+}
+
+// planVersion picks the version ID of a new write to objectKey and works out
+// what happens to the data of the versions it displaces. It also returns the
+// bucket's versioning state. The write preconditions of r are checked against
+// the current version; r may be nil for writes without any.
+func planVersion(st *storage.Store, bucketName, objectKey string, r *http.Request) (*commit, string, error) {
+	if err := requireBucket(st, bucketName); err != nil {
+		return nil, "", err
+	}
+	if err := finishPending(st, bucketName, objectKey); err != nil {
+		return nil, "", err
+	}
+	status, err := st.BucketVersioning(bucketName)
+	if err != nil {
+		return nil, "", err
+	}
+
+	c := &commit{Bucket: bucketName, Key: objectKey, VersionID: storage.NullVersionID}
+	if status == storage.VersioningEnabled {
+		if c.VersionID, err = newVersionID(); err != nil {
+			return nil, "", err
+		}
+	}
+
+	versions, err := readVersions(st, bucketName, objectKey)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := checkWritePreconditions(r, versions); err != nil {
+		return nil, "", err
+	}
+	for _, record := range versions {
+		if record[colDeleteMarker] == "true" {
+			continue
+		}
+		switch {
+		case record[colIsLatest] == "true" && record[colVersionID] != c.VersionID:
+			c.Archive = record[colVersionID]
+		case record[colIsLatest] == "true":
+			c.Replace = true
+		case record[colVersionID] == c.VersionID:
+			c.Drop = c.VersionID
+		}
+	}
+	return c, status, nil
+}
+
+// runCommit records the commit in the staging area and applies it. When a
+// step fails, the intent stays behind: the next write of the object finishes
+// it before its own, and so does the next startup if none comes first.
+func runCommit(st *storage.Store, c *commit) error {
+	fields := append([]string{c.Bucket, c.Key, c.VersionID, c.TempName, c.Archive, c.Drop, strconv.FormatBool(c.Replace)}, c.Record...)
+	fields = append(fields, strconv.FormatBool(c.Remove), c.Promote)
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write(fields)
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	// Intents are named in the order they were written, for recovery to
+	// replay them in that order
+	intent := storage.TempName(fmt.Sprintf("%019d-", time.Now().UnixNano())) + ".commit"
+	if _, err := st.Data.Put(intent, &buf); err != nil {
+		return fmt.Errorf("failed to record commit: %w", err)
+	}
+
+	if err := applyCommit(st, c); err != nil {
+		c.pending = true
+		st.SetPendingCommit(c.Bucket, c.Key, intent)
+		return err
+	}
+	// The commit is done, but a leftover intent must not be applied over
+	// later writes: the next one removes it first
+	if err := st.Data.Delete(intent); err != nil {
+		fmt.Printf("Failed to remove commit intent %s: %v\n", intent, err)
+		st.SetPendingCommit(c.Bucket, c.Key, intent)
+	}
+	return nil
+}
+
+// finishPending finishes the failed commit of an object, if any, before a
+// new write of it is planned. Until it succeeds, every write of the object
+// fails. The caller holds the bucket's lock.
+func finishPending(st *storage.Store, bucketName, objectKey string) error {
+	intent := st.PendingCommit(bucketName, objectKey)
+	if intent == "" {
+		return nil
+	}
+	c, err := readCommit(st, intent)
+	if err == nil {
+		err = applyCommit(st, c)
+		if err == nil {
+			err = st.Data.Delete(intent)
+		}
+	}
+	// A recovery that ran since has finished the commit and removed the intent
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to finish an earlier write of %s/%s: %w", bucketName, objectKey, err)
+	}
+	st.ClearPendingCommit(bucketName, objectKey)
+	return nil
+}
+
+// applyCommit runs the steps of a commit. Every step can be repeated, so a
+// commit that was cut short is safe to apply again.
+func applyCommit(st *storage.Store, c *commit) error {
+	if c.Remove {
+		return applyRemoval(st, c)
+	}
+	current := objectName(st, c.Bucket, c.Key)
+
+	// The staged data is gone once it was renamed into place, and with it the
+	// need to touch the data again.
+	staged := c.TempName == ""
+	if !staged {
+		_, err := st.Data.Stat(c.TempName)
+		staged = err == nil
+	}
+
+	if staged {
+		if c.Archive != "" {
+			target := versionName(st, c.Bucket, c.Key, c.Archive)
+			if _, err := st.Data.Stat(target); errors.Is(err, fs.ErrNotExist) {
+				if err := st.Data.Rename(current, target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+					return err
+				}
+			}
+		}
+		if c.Drop != "" {
+			if err := st.Data.Delete(versionName(st, c.Bucket, c.Key, c.Drop)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+
+		if c.TempName != "" {
+			if err := st.Data.Rename(c.TempName, current); err != nil {
+				return err
+			}
+		} else if c.Replace {
+			// A delete marker takes the place of the current null version.
+			if err := st.Data.Delete(current); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+
+	return addVersionRecord(st, c.Bucket, c.Key, c.Record)
+}
+
+// applyRemoval runs the steps of a commit removing a version.
+func applyRemoval(st *storage.Store, c *commit) error {
+	if c.Promote != "" {
+		// The promoted data is still in the versions directory until it was
+		// renamed into place, which the removed version's data must make room for.
+		promoted := versionName(st, c.Bucket, c.Key, c.Promote)
+		if _, err := st.Data.Stat(promoted); err == nil {
+			if err := st.Data.Delete(objectName(st, c.Bucket, c.Key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			if err := st.Data.Rename(promoted, objectName(st, c.Bucket, c.Key)); err != nil {
+				return err
+			}
+		}
+	} else if c.Record[colDeleteMarker] != "true" {
+		if err := st.Data.Delete(dataName(st.Layout, c.Record)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return removeVersionRecord(st, c.Bucket, c.Key, c.VersionID)
+}
+
+// readCommit loads a commit intent from the staging area.
+func readCommit(st *storage.Store, name string) (*commit, error) {
+	content, err := st.Data.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	reader := csv.NewReader(io.NewSectionReader(content, 0, content.Size()))
+	reader.FieldsPerRecord = -1
+	fields, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	end := commitFields + colMetadata + 1
+	if len(fields) < end {
+		return nil, errors.New("truncated commit record")
+	}
+
+	c := &commit{
+		Bucket:    fields[0],
+		Key:       fields[1],
+		VersionID: fields[2],
+		TempName:  fields[3],
+		Archive:   fields[4],
+		Drop:      fields[5],
+		Replace:   fields[6] == "true",
+		Record:    fields[commitFields:end],
+	}
+	// Intents of older releases end with the record
+	if len(fields) >= end+2 {
+		c.Remove = fields[end] == "true"
+		c.Promote = fields[end+1]
+	}
+	return c, nil
+}
+
+// RecoverCommits finishes the object writes that were interrupted by a crash
+// and then clears the staging area. It runs once at startup.
+func RecoverCommits(st *storage.Store) error {
+	var intents []string
+	err := st.Data.List(storage.TempDirName+"/", func(name string, _ backend.Info) bool {
+		if strings.HasSuffix(name, ".commit") {
+			intents = append(intents, name)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(intents)
+
+	recovered := map[string]bool{}
+	for _, intent := range intents {
+		c, err := readCommit(st, intent)
+		if err != nil {
+			fmt.Printf("Skipping unreadable commit %s: %v\n", intent, err)
+			continue
+		}
+		if err := applyCommit(st, c); err != nil {
+			return fmt.Errorf("failed to recover write of %s/%s: %w", c.Bucket, c.Key, err)
+		}
+		recovered[c.Bucket] = true
+		fmt.Printf("Recovered interrupted write of %s/%s\n", c.Bucket, c.Key)
+	}
+
+	// The crash may have come between the metadata and the usage update
+	for bucketName := range recovered {
+		if err := RecountUsage(st, bucketName); err != nil {
+			return fmt.Errorf("failed to count the usage of %s: %w", bucketName, err)
+		}
+	}
+
+	return st.CleanTemp()
+}
@@ -0,0 +1,222 @@
+package objects
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"triple-s/storage"
+	"triple-s/storage/backend"
+	"triple-s/storage/buckets"
+)
+
+// failingBackend fails the first Rename to a given name, as a crash or a full
+// disk would in the middle of a commit.
+type failingBackend struct {
+	backend.Backend
+	failRenameTo string
+}
+
+var errInjected = errors.New("injected failure")
+
+func (b *failingBackend) Rename(from, to string) error {
+	if to == b.failRenameTo {
+		b.failRenameTo = ""
+		return errInjected
+	}
+	return b.Backend.Rename(from, to)
+}
+
+func newTestStore(t *testing.T) *storage.Store {
+	t.Helper()
+	st := storage.New(t.TempDir())
+	if err := st.OpenData(storage.DataBackendFS); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.OpenMeta(storage.MetaBackendJournal); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	if err := st.Meta.PutBucket(storage.NewBucketRow("bucket", time.Now().Format(time.RFC3339))); err != nil {
+		t.Fatal(err)
+	}
+	if err := buckets.SetBucketVersioning(st, "bucket", storage.VersioningEnabled); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func putObject(t *testing.T, st *storage.Store, key, body string) (string, error) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPut, "/bucket/"+key, strings.NewReader(body))
+	err := CreateObject(st, "bucket", key, w, r)
+	return w.Header().Get("x-amz-version-id"), err
+}
+
+func readObject(t *testing.T, st *storage.Store, key, versionID string) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/bucket/"+key, nil)
+	if err := GetObject(st, "bucket", key, versionID, w, r); err != nil {
+		t.Fatalf("GET %s %s: %v", key, versionID, err)
+	}
+	body, _ := io.ReadAll(w.Body)
+	return string(body)
+}
+
+func TestFailedCommitIsFinishedOnRecovery(t *testing.T) {
+	st := newTestStore(t)
+	first, err := putObject(t, st, "key", "one")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The current data is archived, then moving the new data in fails
+	data := st.Data
+	st.Data = &failingBackend{Backend: data, failRenameTo: objectName(st, "bucket", "key")}
+	if _, err := putObject(t, st, "key", "two"); !errors.Is(err, errInjected) {
+		t.Fatalf("PUT with failing rename: got %v", err)
+	}
+	st.Data = data
+
+	if err := RecoverCommits(st); err != nil {
+		t.Fatal(err)
+	}
+	if got := readObject(t, st, "key", ""); got != "two" {
+		t.Errorf("current version after recovery = %q, want %q", got, "two")
+	}
+	if got := readObject(t, st, "key", first); got != "one" {
+		t.Errorf("first version after recovery = %q, want %q", got, "one")
+	}
+	_, usage, _, err := st.BucketQuota("bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (storage.Usage{Bytes: 6, Objects: 2}); usage != want {
+		t.Errorf("usage after recovery = %+v, want %+v", usage, want)
+	}
+}
+
+func TestFailedVersionRemovalIsFinishedOnRecovery(t *testing.T) {
+	st := newTestStore(t)
+	if _, err := putObject(t, st, "key", "one"); err != nil {
+		t.Fatal(err)
+	}
+	second, err := putObject(t, st, "key", "two")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Removing the latest version fails as the previous one is promoted
+	data := st.Data
+	st.Data = &failingBackend{Backend: data, failRenameTo: objectName(st, "bucket", "key")}
+	if _, err := DeleteObject(st, "bucket", "key", second, nil); !errors.Is(err, errInjected) {
+		t.Fatalf("DELETE with failing rename: got %v", err)
+	}
+	st.Data = data
+
+	if err := RecoverCommits(st); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := readVersions(st, "bucket", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 || versions[0][colIsLatest] != "true" {
+		t.Fatalf("versions after recovery = %v, want the first version as the latest", versions)
+	}
+	if got := readObject(t, st, "key", ""); got != "one" {
+		t.Errorf("current version after recovery = %q, want %q", got, "one")
+	}
+}
+
+func TestWriteAfterFailedCommitIsKeptOnRecovery(t *testing.T) {
+	st := newTestStore(t)
+	first, err := putObject(t, st, "key", "one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := st.Data
+	st.Data = &failingBackend{Backend: data, failRenameTo: objectName(st, "bucket", "key")}
+	if _, err := putObject(t, st, "key", "two"); !errors.Is(err, errInjected) {
+		t.Fatalf("PUT with failing rename: got %v", err)
+	}
+	st.Data = data
+
+	// The next write finishes the failed one before its own
+	third, err := putObject(t, st, "key", "three")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RecoverCommits(st); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := readVersions(st, "bucket", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 3 || versions[2][colVersionID] != third || versions[2][colIsLatest] != "true" {
+		t.Fatalf("versions after recovery = %v, want three with the last write as the latest", versions)
+	}
+	if got := readObject(t, st, "key", ""); got != "three" {
+		t.Errorf("current version after recovery = %q, want %q", got, "three")
+	}
+	if got := readObject(t, st, "key", versions[1][colVersionID]); got != "two" {
+		t.Errorf("failed write after recovery = %q, want %q", got, "two")
+	}
+	if got := readObject(t, st, "key", first); got != "one" {
+		t.Errorf("first version after recovery = %q, want %q", got, "one")
+	}
+	_, usage, _, err := st.BucketQuota("bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (storage.Usage{Bytes: 11, Objects: 3}); usage != want {
+		t.Errorf("usage after recovery = %+v, want %+v", usage, want)
+	}
+}
+
+func TestDeleteAfterFailedCommitIsKeptOnRecovery(t *testing.T) {
+	st := newTestStore(t)
+	if _, err := putObject(t, st, "key", "one"); err != nil {
+		t.Fatal(err)
+	}
+	data := st.Data
+	st.Data = &failingBackend{Backend: data, failRenameTo: objectName(st, "bucket", "key")}
+	if _, err := putObject(t, st, "key", "two"); !errors.Is(err, errInjected) {
+		t.Fatalf("PUT with failing rename: got %v", err)
+	}
+	st.Data = data
+
+	versions, err := readVersions(st, "bucket", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 {
+		t.Fatalf("versions after the failed write = %v, want only the first", versions)
+	}
+	if _, err := DeleteObject(st, "bucket", "key", versions[0][colVersionID], nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := RecoverCommits(st); err != nil {
+		t.Fatal(err)
+	}
+
+	// The failed write was finished before the delete, and is not replayed
+	versions, err = readVersions(st, "bucket", "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 || versions[0][colIsLatest] != "true" {
+		t.Fatalf("versions after recovery = %v, want the second write as the latest", versions)
+	}
+	if got := readObject(t, st, "key", ""); got != "two" {
+		t.Errorf("current version after recovery = %q, want %q", got, "two")
+	}
+}
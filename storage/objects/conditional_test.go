@@ -0,0 +1,138 @@
+package objects
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckPreconditions(t *testing.T) {
+	const etag = "abc"
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	before := modified.Add(-time.Hour).Format(http.TimeFormat)
+	after := modified.Add(time.Hour).Format(http.TimeFormat)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		exists  bool
+		read    error // result for a read
+		write   error // result for a write
+	}{
+		{"none", nil, true, nil, nil},
+		{"if-match", map[string]string{"If-Match": `"abc"`}, true, nil, nil},
+		{"if-match list", map[string]string{"If-Match": `"x", "abc"`}, true, nil, nil},
+		{"if-match other", map[string]string{"If-Match": `"x"`}, true, ErrPreconditionFailed, ErrPreconditionFailed},
+		{"if-match any", map[string]string{"If-Match": "*"}, true, nil, nil},
+		{"if-match missing", map[string]string{"If-Match": "*"}, false, ErrPreconditionFailed, ErrPreconditionFailed},
+		{"if-none-match", map[string]string{"If-None-Match": `"abc"`}, true, ErrNotModified, ErrPreconditionFailed},
+		{"if-none-match weak", map[string]string{"If-None-Match": `W/"abc"`}, true, ErrNotModified, ErrPreconditionFailed},
+		{"if-none-match other", map[string]string{"If-None-Match": `"x"`}, true, nil, nil},
+		{"create only", map[string]string{"If-None-Match": "*"}, true, ErrNotModified, ErrPreconditionFailed},
+		{"create only missing", map[string]string{"If-None-Match": "*"}, false, nil, nil},
+		{"modified since", map[string]string{"If-Modified-Since": before}, true, nil, nil},
+		{"not modified since", map[string]string{"If-Modified-Since": after}, true, ErrNotModified, nil},
+		{"unmodified since", map[string]string{"If-Unmodified-Since": after}, true, nil, nil},
+		{"modified after", map[string]string{"If-Unmodified-Since": before}, true, ErrPreconditionFailed, ErrPreconditionFailed},
+		{"bad date", map[string]string{"If-Unmodified-Since": "yesterday"}, true, nil, nil},
+
+		// If-Match wins over If-Unmodified-Since, If-None-Match over If-Modified-Since
+		{"if-match and modified", map[string]string{"If-Match": `"abc"`, "If-Unmodified-Since": before}, true, nil, nil},
+		{"if-none-match and not modified", map[string]string{"If-None-Match": `"x"`, "If-Modified-Since": after}, true, nil, nil},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/bucket/key", nil)
+		for name, value := range tt.headers {
+			r.Header.Set(name, value)
+		}
+		if err := checkPreconditions(r, etag, modified, tt.exists, true); err != tt.read {
+			t.Errorf("%s: read got %v, want %v", tt.name, err, tt.read)
+		}
+		if err := checkPreconditions(r, etag, modified, tt.exists, false); err != tt.write {
+			t.Errorf("%s: write got %v, want %v", tt.name, err, tt.write)
+		}
+	}
+}
+
+func TestConditionalWrites(t *testing.T) {
+	st := newTestStore(t)
+	put := func(body string, headers map[string]string) error {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPut, "/bucket/key", strings.NewReader(body))
+		for name, value := range headers {
+			r.Header.Set(name, value)
+		}
+		return CreateObject(st, "bucket", "key", w, r)
+	}
+	etagOf := func() string {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodHead, "/bucket/key", nil)
+		if err := GetObject(st, "bucket", "key", "", w, r); err != nil {
+			t.Fatal(err)
+		}
+		return w.Header().Get("ETag")
+	}
+
+	if err := put("one", map[string]string{"If-Match": "*"}); err != ErrPreconditionFailed {
+		t.Errorf("If-Match on a missing key: got %v, want %v", err, ErrPreconditionFailed)
+	}
+	if err := put("one", map[string]string{"If-None-Match": "*"}); err != nil {
+		t.Fatalf("create-only PUT of a new key: %v", err)
+	}
+	if err := put("two", map[string]string{"If-None-Match": "*"}); err != ErrPreconditionFailed {
+		t.Errorf("create-only PUT of an existing key: got %v, want %v", err, ErrPreconditionFailed)
+	}
+	first := etagOf()
+	if err := put("two", map[string]string{"If-Match": first}); err != nil {
+		t.Fatalf("PUT matching the current ETag: %v", err)
+	}
+	if err := put("three", map[string]string{"If-Match": first}); err != ErrPreconditionFailed {
+		t.Errorf("PUT matching a replaced ETag: got %v, want %v", err, ErrPreconditionFailed)
+	}
+	if got := readObject(t, st, "key", ""); got != "two" {
+		t.Errorf("object holds %q, want %q", got, "two")
+	}
+
+	deleteIf := func(etag string) error {
+		r := httptest.NewRequest(http.MethodDelete, "/bucket/key", nil)
+		r.Header.Set("If-Match", etag)
+		_, err := DeleteObject(st, "bucket", "key", "", r)
+		return err
+	}
+	if err := deleteIf(first); err != ErrPreconditionFailed {
+		t.Errorf("DELETE matching a replaced ETag: got %v, want %v", err, ErrPreconditionFailed)
+	}
+	if err := deleteIf(etagOf()); err != nil {
+		t.Errorf("DELETE matching the current ETag: %v", err)
+	}
+}
+
+func TestConditionalRead(t *testing.T) {
+	st := newTestStore(t)
+	if _, err := putObject(t, st, "key", "data"); err != nil {
+		t.Fatal(err)
+	}
+	get := func(name, value string) (*httptest.ResponseRecorder, error) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/bucket/key", nil)
+		r.Header.Set(name, value)
+		return w, GetObject(st, "bucket", "key", "", w, r)
+	}
+
+	w, err := get("If-None-Match", "*")
+	if err != ErrNotModified {
+		t.Fatalf("If-None-Match: got %v, want %v", err, ErrNotModified)
+	}
+	// A 304 still carries the validators
+	if w.Header().Get("ETag") == "" || w.Header().Get("Last-Modified") == "" {
+		t.Errorf("304 headers = %v, want ETag and Last-Modified", w.Header())
+	}
+	if _, err := get("If-Match", `"other"`); err != ErrPreconditionFailed {
+		t.Errorf("If-Match: got %v, want %v", err, ErrPreconditionFailed)
+	}
+	if w, err := get("If-Modified-Since", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)); err != nil || w.Body.String() != "data" {
+		t.Errorf("If-Modified-Since an hour ago: %v %q", err, w.Body.String())
+	}
+}
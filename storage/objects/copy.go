@@ -0,0 +1,186 @@
+package objects
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"triple-s/storage"
+)
+
+var (
+	ErrInvalidCopySource        = &storage.Error{Code: "InvalidArgument", Message: "Copy Source must mention the source bucket and key: sourcebucket/sourcekey", StatusCode: http.StatusBadRequest}
+	ErrInvalidMetadataDirective = &storage.Error{Code: "InvalidArgument", Message: "Unknown metadata directive.", StatusCode: http.StatusBadRequest}
+	ErrCopyToItself             = &storage.Error{Code: "InvalidRequest", Message: "This copy request is illegal because it is trying to copy an object to itself without changing the object's metadata, storage class, website redirect location or encryption attributes.", StatusCode: http.StatusBadRequest}
+)
+
+// parseCopySource splits an x-amz-copy-source header into bucket, key and version ID.
+func parseCopySource(header string) (string, string, string, error) {
+	source, query, _ := strings.Cut(header, "?")
+	source, err := url.PathUnescape(strings.TrimPrefix(source, "/"))
+	if err != nil {
+		return "", "", "", ErrInvalidCopySource
+	}
+	bucketName, objectKey, found := strings.Cut(source, "/")
+	if !found || bucketName == "" || objectKey == "" {
+		return "", "", "", ErrInvalidCopySource
+	}
+
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return "", "", "", ErrInvalidCopySource
+	}
+	return bucketName, objectKey, values.Get("versionId"), nil
+}
+
+// checkCopyPreconditions evaluates the x-amz-copy-source-if-* headers against
+// the source object. Every failure is reported as ErrPreconditionFailed.
+func checkCopyPreconditions(r *http.Request, etag string, lastModified time.Time) error {
+	header := http.Header{}
+	for _, name := range []string{"If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"} {
+		if value := r.Header.Get("X-Amz-Copy-Source-" + name); value != "" {
+			header.Set(name, value)
+		}
+	}
+	if err := checkPreconditions(&http.Request{Header: header}, etag, lastModified, true, true); err != nil {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// CopyObject creates bucketName/objectKey from the object named in the
+// x-amz-copy-source header without sending the data through the client.
+// x-amz-metadata-directive decides whether the metadata is copied from the
+// source (COPY, the default) or taken from the request (REPLACE).
+func CopyObject(st *storage.Store, bucketName, objectKey string, w http.ResponseWriter, r *http.Request) error {
+	srcBucket, srcKey, srcVersionID, err := parseCopySource(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		return err
+	}
+
+	directive := r.Header.Get("X-Amz-Metadata-Directive")
+	if directive == "" {
+		directive = "COPY"
+	}
+	if directive != "COPY" && directive != "REPLACE" {
+		return ErrInvalidMetadataDirective
+	}
+	reencrypt := r.Header.Get(sseHeader) != "" || r.Header.Get(sseCustomerAlgorithm) != ""
+	if srcBucket == bucketName && srcKey == objectKey && srcVersionID == "" && directive == "COPY" && !reencrypt {
+		return ErrCopyToItself
+	}
+	if err := precheckWrite(st, bucketName, objectKey, r); err != nil {
+		return err
+	}
+
+	// The source is opened before the destination's current version is moved
+	// aside, which matters when both are the same object.
+	source, srcContent, err := openVersion(st, srcBucket, srcKey, srcVersionID)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNoSuchKey
+	}
+	if err != nil {
+		return err
+	}
+	if srcContent != nil {
+		defer srcContent.Close()
+	}
+	switch {
+	case source == nil && srcVersionID != "":
+		return ErrNoSuchVersion
+	case source == nil:
+		return ErrNoSuchKey
+	case source[colDeleteMarker] == "true" && srcVersionID != "":
+		return ErrDeleteMarker
+	case source[colDeleteMarker] == "true":
+		return ErrNoSuchKey
+	}
+
+	lastModified, _ := time.Parse(time.RFC3339, source[colLastModified])
+	if err := checkCopyPreconditions(r, source[colETag], lastModified); err != nil {
+		return err
+	}
+
+	// The copy is decrypted with the source's key and encrypted on its own terms
+	srcData, err := decryptContent(st, source, srcContent, r.Header, copySourcePrefix)
+	if err != nil {
+		return err
+	}
+	enc, err := newEncryption(st, bucketName, r.Header)
+	if err != nil {
+		return err
+	}
+
+	maxSize, err := maxObjectSize(st, bucketName)
+	if err != nil {
+		return err
+	}
+	if maxSize > 0 && srcData.Size() > maxSize {
+		return ErrQuotaExceeded
+	}
+
+	tempName := storage.TempName("copy-")
+	var c *commit
+	defer func() { discardStaged(st, tempName, c) }()
+
+	hash := md5.New()
+	data, err := enc.encrypt(io.TeeReader(io.NewSectionReader(srcData, 0, srcData.Size()), hash))
+	if err != nil {
+		return err
+	}
+	stored, err := st.Data.Put(tempName, data)
+	if err != nil {
+		return fmt.Errorf("failed to copy object: %w", err)
+	}
+	size, err := enc.plainSize(stored)
+	if err != nil {
+		return err
+	}
+	etag := hex.EncodeToString(hash.Sum(nil))
+
+	contentType, metadata := source[colContentType], withoutEncryption(source[colMetadata])
+	if directive == "REPLACE" {
+		contentType = r.Header.Get("Content-Type")
+		if metadata, err = extractMetadata(r.Header); err != nil {
+			return err
+		}
+	}
+
+	unlock := st.LockBucket(bucketName)
+	defer unlock()
+	c, versioning, err := planVersion(st, bucketName, objectKey, r)
+	if err != nil {
+		return err
+	}
+	if err := checkQuota(st, c, size); err != nil {
+		return err
+	}
+	c.TempName = tempName
+	c.Record = newRecord(bucketName, objectKey, c.VersionID, contentType, strconv.FormatInt(size, 10), etag, enc.addTo(metadata))
+	if err := runCommit(st, c); err != nil {
+		return fmt.Errorf("failed to commit object: %w", err)
+	}
+
+	if versioning != "" {
+		w.Header().Set("x-amz-version-id", c.VersionID)
+	}
+	if srcVersioning, _ := st.BucketVersioning(srcBucket); srcVersioning != "" {
+		w.Header().Set("x-amz-copy-source-version-id", source[colVersionID])
+	}
+	setEncryptionHeaders(w, c.Record[colMetadata])
+	lastModified, _ = time.Parse(time.RFC3339, c.Record[colLastModified])
+	response := CopyObjectResult{ETag: quoteETag(etag), LastModified: lastModified.UTC()}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(response)
+	return nil
+}
@@ -0,0 +1,142 @@
+package objects
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCopySource(t *testing.T) {
+	tests := []struct {
+		header, bucket, key, versionID string
+		err                            error
+	}{
+		{"bucket/key", "bucket", "key", "", nil},
+		{"/bucket/dir/key", "bucket", "dir/key", "", nil},
+		{"bucket/a%20b%2Bc", "bucket", "a b+c", "", nil},
+		{"bucket/key?versionId=v1", "bucket", "key", "v1", nil},
+		{"bucket", "", "", "", ErrInvalidCopySource},
+		{"bucket/", "", "", "", ErrInvalidCopySource},
+		{"/key", "", "", "", ErrInvalidCopySource},
+		{"bucket/%zz", "", "", "", ErrInvalidCopySource},
+	}
+	for _, tt := range tests {
+		bucket, key, versionID, err := parseCopySource(tt.header)
+		if bucket != tt.bucket || key != tt.key || versionID != tt.versionID || err != tt.err {
+			t.Errorf("parseCopySource(%q) = %q, %q, %q, %v", tt.header, bucket, key, versionID, err)
+		}
+	}
+}
+
+func TestCopyObject(t *testing.T) {
+	st := newTestStore(t)
+	put := func(key, body string, header map[string]string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPut, "/bucket/"+key, strings.NewReader(body))
+		for name, value := range header {
+			r.Header.Set(name, value)
+		}
+		if err := CreateObject(st, "bucket", key, w, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	copyTo := func(key string, header map[string]string) (*httptest.ResponseRecorder, error) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPut, "/bucket/"+key, nil)
+		for name, value := range header {
+			r.Header.Set(name, value)
+		}
+		return w, CopyObject(st, "bucket", key, w, r)
+	}
+	head := func(key string) http.Header {
+		t.Helper()
+		w := httptest.NewRecorder()
+		if err := GetObject(st, "bucket", key, "", w, httptest.NewRequest(http.MethodHead, "/bucket/"+key, nil)); err != nil {
+			t.Fatal(err)
+		}
+		return w.Header()
+	}
+
+	put("src", "original", map[string]string{"Content-Type": "text/plain", "X-Amz-Meta-Color": "blue"})
+	first := head("src").Get("x-amz-version-id")
+	put("src", "changed", map[string]string{"Content-Type": "text/plain", "X-Amz-Meta-Color": "red"})
+
+	// COPY keeps the metadata of the source
+	w, err := copyTo("copy", map[string]string{"X-Amz-Copy-Source": "bucket/src"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result CopyObjectResult
+	if err := xml.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	copied := head("copy")
+	if result.ETag != copied.Get("ETag") || result.ETag != head("src").Get("ETag") {
+		t.Errorf("copy ETag %s, stored %s, source %s", result.ETag, copied.Get("ETag"), head("src").Get("ETag"))
+	}
+	if got := result.LastModified.Format(http.TimeFormat); got != copied.Get("Last-Modified") {
+		t.Errorf("copy result LastModified %s, stored %s", got, copied.Get("Last-Modified"))
+	}
+	if copied.Get("Content-Type") != "text/plain" || copied.Get("X-Amz-Meta-Color") != "red" {
+		t.Errorf("COPY directive gave %v", copied)
+	}
+	if w.Header().Get("x-amz-copy-source-version-id") == "" {
+		t.Error("copy from a versioned bucket has no x-amz-copy-source-version-id")
+	}
+
+	// REPLACE takes the metadata of the request
+	if _, err := copyTo("replaced", map[string]string{
+		"X-Amz-Copy-Source":        "bucket/src",
+		"X-Amz-Metadata-Directive": "REPLACE",
+		"Content-Type":             "application/json",
+		"X-Amz-Meta-Shape":         "square",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	replaced := head("replaced")
+	if replaced.Get("Content-Type") != "application/json" || replaced.Get("X-Amz-Meta-Shape") != "square" || replaced.Get("X-Amz-Meta-Color") != "" {
+		t.Errorf("REPLACE directive gave %v", replaced)
+	}
+
+	// An older version of the source
+	if _, err := copyTo("old", map[string]string{"X-Amz-Copy-Source": "bucket/src?versionId=" + first}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readObject(t, st, "old", ""); got != "original" {
+		t.Errorf("copy of the first version holds %q", got)
+	}
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   error
+	}{
+		{"to itself", map[string]string{"X-Amz-Copy-Source": "bucket/copy"}, ErrCopyToItself},
+		{"missing source", map[string]string{"X-Amz-Copy-Source": "bucket/missing"}, ErrNoSuchKey},
+		{"missing version", map[string]string{"X-Amz-Copy-Source": "bucket/src?versionId=nope"}, ErrNoSuchVersion},
+		{"bad directive", map[string]string{"X-Amz-Copy-Source": "bucket/src", "X-Amz-Metadata-Directive": "MERGE"}, ErrInvalidMetadataDirective},
+		{"source if-match", map[string]string{"X-Amz-Copy-Source": "bucket/src", "X-Amz-Copy-Source-If-Match": `"other"`}, ErrPreconditionFailed},
+		{"source if-none-match", map[string]string{"X-Amz-Copy-Source": "bucket/src", "X-Amz-Copy-Source-If-None-Match": head("src").Get("ETag")}, ErrPreconditionFailed},
+		{"source modified since", map[string]string{"X-Amz-Copy-Source": "bucket/src", "X-Amz-Copy-Source-If-Modified-Since": time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)}, ErrPreconditionFailed},
+	}
+	for _, tt := range tests {
+		if _, err := copyTo("copy", tt.header); err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// Copying onto itself with new metadata is allowed
+	if _, err := copyTo("copy", map[string]string{"X-Amz-Copy-Source": "bucket/copy", "X-Amz-Metadata-Directive": "REPLACE", "X-Amz-Meta-Color": "green"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := head("copy").Get("X-Amz-Meta-Color"); got != "green" {
+		t.Errorf("metadata after copying onto itself = %q", got)
+	}
+	if got := readObject(t, st, "copy", ""); got != "changed" {
+		t.Errorf("data after copying onto itself = %q", got)
+	}
+}
@@ -0,0 +1,36 @@
+package objects
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"net/http"
+
+	"triple-s/storage"
+)
+
+var (
+	ErrInvalidDigest = &storage.Error{Code: "InvalidDigest", Message: "The Content-MD5 you specified is not valid.", StatusCode: http.StatusBadRequest}
+	ErrBadDigest     = &storage.Error{Code: "BadDigest", Message: "The Content-MD5 you specified did not match what we received.", StatusCode: http.StatusBadRequest}
+)
+
+// parseContentMD5 decodes a Content-MD5 header. It returns nil when the header is absent.
+func parseContentMD5(header string) ([]byte, error) {
+	if header == "" {
+		return nil, nil
+	}
+	digest, err := base64.StdEncoding.DecodeString(header)
+	if err != nil || len(digest) != md5.Size {
+		return nil, ErrInvalidDigest
+	}
+	return digest, nil
+}
+
+// verifyDigest compares the MD5 of the received bytes with the expected
+// Content-MD5. A nil expected digest always matches.
+func verifyDigest(expected, actual []byte) error {
+	if expected != nil && !bytes.Equal(expected, actual) {
+		return ErrBadDigest
+	}
+	return nil
+}
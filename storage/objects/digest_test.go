@@ -0,0 +1,97 @@
+package objects
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseContentMD5(t *testing.T) {
+	sum := md5.Sum([]byte("data"))
+	tests := []struct {
+		header string
+		want   error
+	}{
+		{"", nil},
+		{base64.StdEncoding.EncodeToString(sum[:]), nil},
+		{hex.EncodeToString(sum[:]), ErrInvalidDigest},
+		{base64.StdEncoding.EncodeToString(sum[:8]), ErrInvalidDigest},
+		{"not base64!", ErrInvalidDigest},
+	}
+	for _, tt := range tests {
+		if _, err := parseContentMD5(tt.header); err != tt.want {
+			t.Errorf("parseContentMD5(%q): got %v, want %v", tt.header, err, tt.want)
+		}
+	}
+}
+
+// failingReader returns its data, then an error instead of EOF.
+type failingReader struct{ io.Reader }
+
+func (r failingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF {
+		err = errInjected
+	}
+	return n, err
+}
+
+func TestCreateObjectDigest(t *testing.T) {
+	st := newTestStore(t)
+	put := func(body io.Reader, contentLength int64, contentMD5 string) (*httptest.ResponseRecorder, error) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPut, "/bucket/key", body)
+		r.ContentLength = contentLength
+		if contentMD5 != "" {
+			r.Header.Set("Content-MD5", contentMD5)
+		}
+		return w, CreateObject(st, "bucket", "key", w, r)
+	}
+	md5Of := func(body string) string {
+		sum := md5.Sum([]byte(body))
+		return base64.StdEncoding.EncodeToString(sum[:])
+	}
+
+	w, err := put(strings.NewReader("stored"), 6, md5Of("stored"))
+	if err != nil {
+		t.Fatalf("PUT with a matching Content-MD5: %v", err)
+	}
+	sum := md5.Sum([]byte("stored"))
+	if got, want := w.Header().Get("ETag"), `"`+hex.EncodeToString(sum[:])+`"`; got != want {
+		t.Errorf("ETag = %s, want %s", got, want)
+	}
+
+	// Rejected uploads leave the object as it was
+	if _, err := put(strings.NewReader("other"), 5, md5Of("different")); err != ErrBadDigest {
+		t.Errorf("PUT with a wrong Content-MD5: got %v, want %v", err, ErrBadDigest)
+	}
+	if _, err := put(strings.NewReader("other"), 5, "bad"); err != ErrInvalidDigest {
+		t.Errorf("PUT with a malformed Content-MD5: got %v, want %v", err, ErrInvalidDigest)
+	}
+	if _, err := put(failingReader{strings.NewReader("trunc")}, 10, ""); !errors.Is(err, errInjected) {
+		t.Errorf("PUT with a failing body: got %v, want %v", err, errInjected)
+	}
+	if got := readObject(t, st, "key", ""); got != "stored" {
+		t.Errorf("object after rejected uploads holds %q, want %q", got, "stored")
+	}
+
+	// The size is what was received, with or without a Content-Length
+	for _, contentLength := range []int64{-1, 100} {
+		if _, err := put(strings.NewReader("chunked"), contentLength, ""); err != nil {
+			t.Fatalf("PUT with Content-Length %d: %v", contentLength, err)
+		}
+		result, err := ListObjectsV2(st, "bucket", ListParams{MaxKeys: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := result.Contents[0].Size; got != 7 {
+			t.Errorf("PUT with Content-Length %d: stored size %d, want 7", contentLength, got)
+		}
+	}
+}
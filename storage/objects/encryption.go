@@ -0,0 +1,257 @@
+package objects
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"triple-s/storage"
+	"triple-s/storage/backend"
+	"triple-s/storage/sse"
+)
+
+// SSEAlgorithm is the only server-side encryption algorithm supported.
+const SSEAlgorithm = "AES256"
+
+// Server-side encryption headers. Versions are stored with the ones that
+// describe them, which GET and HEAD send back like the other metadata.
+const (
+	sseHeader            = "X-Amz-Server-Side-Encryption"
+	sseCustomerAlgorithm = "X-Amz-Server-Side-Encryption-Customer-Algorithm"
+	sseCustomerKey       = "X-Amz-Server-Side-Encryption-Customer-Key"
+	sseCustomerKeyMD5    = "X-Amz-Server-Side-Encryption-Customer-Key-Md5"
+	// copySourcePrefix starts the SSE-C headers of the source of a copy.
+	copySourcePrefix = "X-Amz-Copy-Source-"
+)
+
+// Metadata the server keeps for itself under internalPrefix is never sent
+// back: the sealed data key of an encrypted version, and the plaintext sizes
+// of the encrypted parts its data is made of.
+const (
+	internalPrefix = "X-Triple-S-"
+	sealedKeyKey   = internalPrefix + "Sealed-Key"
+	partSizesKey   = internalPrefix + "Part-Sizes"
+)
+
+var (
+	ErrInvalidEncryptionAlgorithm = &storage.Error{Code: "InvalidEncryptionAlgorithmError", Message: "The encryption request you specified is not valid. The valid value is AES256.", StatusCode: http.StatusBadRequest}
+	ErrConflictingEncryption      = &storage.Error{Code: "InvalidArgument", Message: "Server Side Encryption with Customer provided key is incompatible with the encryption method specified.", StatusCode: http.StatusBadRequest}
+	ErrInvalidCustomerKey         = &storage.Error{Code: "InvalidArgument", Message: "The secret key was invalid for the specified algorithm.", StatusCode: http.StatusBadRequest}
+	ErrCustomerKeyMD5Mismatch     = &storage.Error{Code: "InvalidArgument", Message: "The calculated MD5 hash of the key did not match the hash that was provided.", StatusCode: http.StatusBadRequest}
+	ErrCustomerKeyRequired        = &storage.Error{Code: "InvalidRequest", Message: "The object was stored using a form of Server Side Encryption. The correct parameters must be provided to retrieve the object.", StatusCode: http.StatusBadRequest}
+	ErrCustomerKeyNotApplicable   = &storage.Error{Code: "InvalidRequest", Message: "The encryption parameters are not applicable to this object.", StatusCode: http.StatusBadRequest}
+	ErrCustomerKeyMismatch        = &storage.Error{Code: "AccessDenied", Message: "The provided customer key does not match the key the object was encrypted with.", StatusCode: http.StatusForbidden}
+	ErrNoMasterKey                = &storage.Error{Code: "NotImplemented", Message: "Server-side encryption with server-managed keys is not configured.", StatusCode: http.StatusNotImplemented}
+)
+
+// encryption is how a new version is encrypted: with a fresh data key,
+// sealed by the master key (SSE-S3) or by the customer's key (SSE-C).
+type encryption struct {
+	customer bool
+	keyMD5   string // of the customer key, base64
+	dataKey  []byte
+	sealed   string
+}
+
+// newEncryption returns the encryption of a new version of an object in
+// bucketName: SSE-C when the request carries a customer key, SSE-S3 when it
+// asks for it or the bucket encrypts by default. It returns nil when the
+// version is stored unencrypted.
+func newEncryption(st *storage.Store, bucketName string, header http.Header) (*encryption, error) {
+	customerKey, keyMD5, err := parseCustomerKey(header, "")
+	if err != nil {
+		return nil, err
+	}
+	algorithm := header.Get(sseHeader)
+	if customerKey != nil && algorithm != "" {
+		return nil, ErrConflictingEncryption
+	}
+	if customerKey == nil && algorithm == "" {
+		if algorithm, err = st.BucketEncryption(bucketName); err != nil || algorithm == "" {
+			return nil, err
+		}
+	}
+	if customerKey == nil && algorithm != SSEAlgorithm {
+		return nil, ErrInvalidEncryptionAlgorithm
+	}
+
+	kek := customerKey
+	if kek == nil {
+		if st.MasterKey == nil {
+			return nil, ErrNoMasterKey
+		}
+		kek = st.MasterKey
+	}
+	dataKey, err := sse.NewDataKey()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := sse.Seal(kek, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &encryption{customer: customerKey != nil, keyMD5: keyMD5, dataKey: dataKey, sealed: sealed}, nil
+}
+
+// parseCustomerKey returns the SSE-C key of a request and its MD5, or a nil
+// key when the request carries none. prefix selects the headers of the
+// source of a copy.
+func parseCustomerKey(header http.Header, prefix string) ([]byte, string, error) {
+	algorithm := header.Get(prefix + sseCustomerAlgorithm)
+	encoded := header.Get(prefix + sseCustomerKey)
+	keyMD5 := header.Get(prefix + sseCustomerKeyMD5)
+	if algorithm == "" && encoded == "" && keyMD5 == "" {
+		return nil, "", nil
+	}
+	if algorithm != SSEAlgorithm {
+		return nil, "", ErrInvalidEncryptionAlgorithm
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != sse.KeySize {
+		return nil, "", ErrInvalidCustomerKey
+	}
+	sum := md5.Sum(key)
+	if base64.StdEncoding.EncodeToString(sum[:]) != keyMD5 {
+		return nil, "", ErrCustomerKeyMD5Mismatch
+	}
+	return key, keyMD5, nil
+}
+
+// encrypt returns the stored form of data: data itself when e is nil.
+func (e *encryption) encrypt(data io.Reader) (io.Reader, error) {
+	if e == nil {
+		return data, nil
+	}
+	return sse.NewEncrypter(e.dataKey, data)
+}
+
+// plainSize returns the size of the data stored as written bytes.
+func (e *encryption) plainSize(written int64) (int64, error) {
+	if e == nil {
+		return written, nil
+	}
+	return sse.DecryptedSize(written)
+}
+
+// addTo records the encryption in the Metadata column of the new version.
+func (e *encryption) addTo(metadata string) string {
+	if e == nil {
+		return metadata
+	}
+	values, _ := url.ParseQuery(metadata)
+	if e.customer {
+		values.Set(sseCustomerAlgorithm, SSEAlgorithm)
+		values.Set(sseCustomerKeyMD5, e.keyMD5)
+	} else {
+		values.Set(sseHeader, SSEAlgorithm)
+	}
+	values.Set(sealedKeyKey, e.sealed)
+	return values.Encode()
+}
+
+// setEncryptionHeaders reports the encryption recorded in a Metadata column
+// in the response to a write.
+func setEncryptionHeaders(w http.ResponseWriter, metadata string) {
+	values, _ := url.ParseQuery(metadata)
+	for _, name := range []string{sseHeader, sseCustomerAlgorithm, sseCustomerKeyMD5} {
+		if value := values.Get(name); value != "" {
+			w.Header().Set(name, value)
+		}
+	}
+}
+
+// isEncrypted reports whether a Metadata column describes encrypted data.
+func isEncrypted(metadata string) bool {
+	values, _ := url.ParseQuery(metadata)
+	return values.Get(sealedKeyKey) != ""
+}
+
+// withoutEncryption drops the encryption of a version from its Metadata
+// column, for a copy that is encrypted on its own terms.
+func withoutEncryption(metadata string) string {
+	values, _ := url.ParseQuery(metadata)
+	for _, name := range []string{sseHeader, sseCustomerAlgorithm, sseCustomerKeyMD5, sealedKeyKey, partSizesKey} {
+		values.Del(name)
+	}
+	return values.Encode()
+}
+
+// storedDataKey returns the data key of a stored version, or nil when it is
+// stored unencrypted. The SSE-C key of the request, selected by prefix, must
+// be the one the version was stored with, and must be absent otherwise.
+func storedDataKey(st *storage.Store, metadata string, header http.Header, prefix string) ([]byte, error) {
+	customerKey, keyMD5, err := parseCustomerKey(header, prefix)
+	if err != nil {
+		return nil, err
+	}
+	values, _ := url.ParseQuery(metadata)
+	sealed := values.Get(sealedKeyKey)
+
+	switch {
+	case sealed == "":
+		if customerKey != nil {
+			return nil, ErrCustomerKeyNotApplicable
+		}
+		return nil, nil
+
+	case values.Get(sseCustomerAlgorithm) != "":
+		if customerKey == nil {
+			return nil, ErrCustomerKeyRequired
+		}
+		if keyMD5 != values.Get(sseCustomerKeyMD5) {
+			return nil, ErrCustomerKeyMismatch
+		}
+		dataKey, err := sse.Unseal(customerKey, sealed)
+		if err != nil {
+			return nil, ErrCustomerKeyMismatch
+		}
+		return dataKey, nil
+
+	default:
+		if customerKey != nil {
+			return nil, ErrCustomerKeyNotApplicable
+		}
+		if st.MasterKey == nil {
+			return nil, ErrNoMasterKey
+		}
+		// Failing here means the master key changed: an internal error
+		return sse.Unseal(st.MasterKey, sealed)
+	}
+}
+
+// plainContent is the decrypted data of a version, closed with the stored data.
+type plainContent struct {
+	*sse.Reader
+	io.Closer
+}
+
+// decryptContent returns the plaintext of the data of a stored version, or
+// content itself when the version is stored unencrypted. prefix selects the
+// SSE-C headers of the request that apply.
+func decryptContent(st *storage.Store, record []string, content backend.Content, header http.Header, prefix string) (backend.Content, error) {
+	dataKey, err := storedDataKey(st, record[colMetadata], header, prefix)
+	if err != nil || dataKey == nil {
+		return content, err
+	}
+
+	size, _ := strconv.ParseInt(record[colSize], 10, 64)
+	sizes := []int64{size}
+	values, _ := url.ParseQuery(record[colMetadata])
+	if parts := values.Get(partSizesKey); parts != "" {
+		sizes = sizes[:0]
+		for _, part := range strings.Split(parts, ",") {
+			partSize, _ := strconv.ParseInt(part, 10, 64)
+			sizes = append(sizes, partSize)
+		}
+	}
+
+	reader, err := sse.NewReader(dataKey, content, sizes)
+	if err != nil {
+		return nil, err
+	}
+	return plainContent{reader, content}, nil
+}
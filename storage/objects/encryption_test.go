@@ -0,0 +1,173 @@
+package objects
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"triple-s/storage"
+	"triple-s/storage/buckets"
+)
+
+// customerHeaders returns the SSE-C headers of a key made of one repeated byte.
+func customerHeaders(seed byte) map[string]string {
+	key := bytes.Repeat([]byte{seed}, 32)
+	sum := md5.Sum(key)
+	return map[string]string{
+		sseCustomerAlgorithm: SSEAlgorithm,
+		sseCustomerKey:       base64.StdEncoding.EncodeToString(key),
+		sseCustomerKeyMD5:    base64.StdEncoding.EncodeToString(sum[:]),
+	}
+}
+
+func putWith(st *storage.Store, key, body string, header map[string]string) (*httptest.ResponseRecorder, error) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPut, "/bucket/"+key, strings.NewReader(body))
+	for name, value := range header {
+		r.Header.Set(name, value)
+	}
+	return w, CreateObject(st, "bucket", key, w, r)
+}
+
+func getWith(st *storage.Store, key string, header map[string]string) (*httptest.ResponseRecorder, error) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/bucket/"+key, nil)
+	for name, value := range header {
+		r.Header.Set(name, value)
+	}
+	return w, GetObject(st, "bucket", key, "", w, r)
+}
+
+// storedData returns the bytes the data backend holds for the current version of key.
+func storedData(t *testing.T, st *storage.Store, key string) string {
+	t.Helper()
+	content, err := st.Data.Get(objectName(st, "bucket", key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer content.Close()
+	data, _ := io.ReadAll(io.NewSectionReader(content, 0, content.Size()))
+	return string(data)
+}
+
+func TestServerSideEncryption(t *testing.T) {
+	st := newTestStore(t)
+	body := strings.Repeat("secret data ", 10000)
+
+	if _, err := putWith(st, "key", body, map[string]string{sseHeader: SSEAlgorithm}); err != ErrNoMasterKey {
+		t.Errorf("SSE-S3 without a master key: got %v, want %v", err, ErrNoMasterKey)
+	}
+	st.MasterKey = bytes.Repeat([]byte{9}, 32)
+	if _, err := putWith(st, "key", body, map[string]string{sseHeader: "aws:kms"}); err != ErrInvalidEncryptionAlgorithm {
+		t.Errorf("unknown algorithm: got %v, want %v", err, ErrInvalidEncryptionAlgorithm)
+	}
+
+	w, err := putWith(st, "key", body, map[string]string{sseHeader: SSEAlgorithm})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Header().Get(sseHeader) != SSEAlgorithm {
+		t.Errorf("PUT response headers %v", w.Header())
+	}
+	if stored := storedData(t, st, "key"); strings.Contains(stored, "secret") || len(stored) <= len(body) {
+		t.Error("data is stored in plaintext")
+	}
+	w, err = getWith(st, "key", nil)
+	if err != nil || w.Body.String() != body {
+		t.Fatalf("GET: %v, %d bytes", err, w.Body.Len())
+	}
+	if w.Header().Get(sseHeader) != SSEAlgorithm || w.Header().Get("Content-Length") != "120000" {
+		t.Errorf("GET headers %v", w.Header())
+	}
+	for name := range w.Header() {
+		if strings.HasPrefix(name, internalPrefix) {
+			t.Errorf("GET sends %s", name)
+		}
+	}
+	w, err = getWith(st, "key", map[string]string{"Range": "bytes=65530-65545"})
+	if err != nil || w.Body.String() != body[65530:65546] {
+		t.Errorf("range across a chunk boundary: %v, %q", err, w.Body.String())
+	}
+	if _, err := getWith(st, "key", customerHeaders(1)); err != ErrCustomerKeyNotApplicable {
+		t.Errorf("GET with a customer key: got %v, want %v", err, ErrCustomerKeyNotApplicable)
+	}
+
+	// Buckets can encrypt by default
+	if err := buckets.SetBucketEncryption(st, "bucket", SSEAlgorithm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := putWith(st, "default", "plain", nil); err != nil {
+		t.Fatal(err)
+	}
+	if storedData(t, st, "default") == "plain" {
+		t.Error("bucket default encryption not applied")
+	}
+	if w, err := getWith(st, "default", nil); err != nil || w.Body.String() != "plain" || w.Header().Get(sseHeader) != SSEAlgorithm {
+		t.Errorf("GET of a default-encrypted object: %v, %q", err, w.Body.String())
+	}
+}
+
+func TestCustomerKeys(t *testing.T) {
+	st := newTestStore(t)
+	body := strings.Repeat("customer data ", 10000)
+	key := customerHeaders(1)
+
+	w, err := putWith(st, "key", body, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Header().Get(sseCustomerKeyMD5) != key[sseCustomerKeyMD5] {
+		t.Errorf("PUT response headers %v", w.Header())
+	}
+	if strings.Contains(storedData(t, st, "key"), "customer") {
+		t.Error("data is stored in plaintext")
+	}
+	w, err = getWith(st, "key", key)
+	if err != nil || w.Body.String() != body {
+		t.Fatalf("GET with the key: %v, %d bytes", err, w.Body.Len())
+	}
+	if w.Header().Get(sseCustomerKeyMD5) != key[sseCustomerKeyMD5] || w.Header().Get(sseCustomerKey) != "" {
+		t.Errorf("GET headers %v", w.Header())
+	}
+	if w, err := getWith(st, "key", map[string]string{sseCustomerAlgorithm: SSEAlgorithm, sseCustomerKey: key[sseCustomerKey], sseCustomerKeyMD5: key[sseCustomerKeyMD5], "Range": "bytes=-10"}); err != nil || w.Body.String() != body[len(body)-10:] {
+		t.Errorf("range with the key: %v, %q", err, w.Body.String())
+	}
+
+	badMD5 := customerHeaders(2)
+	badMD5[sseCustomerKeyMD5] = key[sseCustomerKeyMD5]
+	shortKey := customerHeaders(2)
+	shortKey[sseCustomerKey] = base64.StdEncoding.EncodeToString([]byte("short"))
+	withS3 := customerHeaders(2)
+	withS3[sseHeader] = SSEAlgorithm
+
+	for _, tt := range []struct {
+		name   string
+		header map[string]string
+		want   error
+	}{
+		{"no key", nil, ErrCustomerKeyRequired},
+		{"other key", customerHeaders(2), ErrCustomerKeyMismatch},
+		{"key MD5 mismatch", badMD5, ErrCustomerKeyMD5Mismatch},
+		{"short key", shortKey, ErrInvalidCustomerKey},
+	} {
+		if _, err := getWith(st, "key", tt.header); err != tt.want {
+			t.Errorf("GET with %s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+	if _, err := putWith(st, "other", "data", withS3); err != ErrConflictingEncryption {
+		t.Errorf("PUT with SSE-C and SSE-S3: got %v, want %v", err, ErrConflictingEncryption)
+	}
+
+	// An unencrypted object refuses a customer key
+	if _, err := putWith(st, "plain", "data", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getWith(st, "plain", key); err != ErrCustomerKeyNotApplicable {
+		t.Errorf("GET of a plain object with a key: got %v, want %v", err, ErrCustomerKeyNotApplicable)
+	}
+}
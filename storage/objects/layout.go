@@ -0,0 +1,59 @@
+package objects
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"triple-s/storage"
+)
+
+// MigrateLayout moves the data of every stored version from the names of
+// layout from to those of st.Layout, then records st.Layout. The metadata
+// drives the move, so no bucket directory is scanned. A migration cut short
+// by a crash resumes at the next startup: data already moved is skipped.
+func MigrateLayout(st *storage.Store, from storage.Layout) error {
+	buckets, err := st.Meta.Buckets()
+	if err != nil {
+		return err
+	}
+
+	moved, missing := 0, 0
+	for _, bucket := range buckets {
+		var moveErr error
+		err := st.Meta.Scan(bucket[0], "", func(_ string, versions [][]string) bool {
+			for _, record := range versions {
+				if record[colDeleteMarker] == "true" {
+					continue
+				}
+				oldName, newName := dataName(from, record), dataName(st.Layout, record)
+				err := st.Data.Rename(oldName, newName)
+				switch {
+				case err == nil:
+					moved++
+				case errors.Is(err, fs.ErrNotExist):
+					// Moved before a crash, or lost
+					if _, err := st.Data.Stat(newName); err != nil {
+						missing++
+					}
+				default:
+					moveErr = fmt.Errorf("failed to move %s: %w", oldName, err)
+					return false
+				}
+			}
+			return true
+		})
+		if err == nil {
+			err = moveErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if missing > 0 {
+		fmt.Printf("Layout migration found no data for %d object versions\n", missing)
+	}
+	fmt.Printf("Moved %d object versions from the %s to the %s layout\n", moved, from, st.Layout)
+	return st.SaveLayout(st.Layout)
+}
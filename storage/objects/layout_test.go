@@ -0,0 +1,59 @@
+package objects
+
+import (
+	"fmt"
+	"testing"
+
+	"triple-s/storage"
+)
+
+func TestMigrateLayoutRoundTrip(t *testing.T) {
+	st := newTestStore(t)
+	st.Layout = storage.LayoutFlat
+
+	// Every 2-character hex key, so that flat names meet each shard directory
+	var keys []string
+	for i := 0; i < 256; i++ {
+		keys = append(keys, fmt.Sprintf("%02x", i))
+	}
+	keys = append(keys, "dir/ab", "Upper")
+	firsts := map[string]string{}
+	for _, key := range keys {
+		first, err := putObject(t, st, key, "old "+key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		firsts[key] = first
+		if _, err := putObject(t, st, key, "new "+key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	check := func() {
+		t.Helper()
+		for _, key := range keys {
+			if got := readObject(t, st, key, ""); got != "new "+key {
+				t.Errorf("%s layout: current version of %s = %q", st.Layout, key, got)
+			}
+			if got := readObject(t, st, key, firsts[key]); got != "old "+key {
+				t.Errorf("%s layout: first version of %s = %q", st.Layout, key, got)
+			}
+		}
+	}
+
+	for _, to := range []storage.Layout{storage.LayoutSharded, storage.LayoutFlat} {
+		from := st.Layout
+		st.Layout = to
+		if err := MigrateLayout(st, from); err != nil {
+			t.Fatalf("migrating from the %s to the %s layout: %v", from, to, err)
+		}
+		stored, err := st.StoredLayout()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored != to {
+			t.Errorf("stored layout = %s, want %s", stored, to)
+		}
+		check()
+	}
+}
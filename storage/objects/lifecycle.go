@@ -0,0 +1,214 @@
+package objects
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"triple-s/storage"
+	"triple-s/storage/lifecycle"
+)
+
+// LifecycleReport counts what one pass of the lifecycle rules removed.
+type LifecycleReport struct {
+	Expired            int // current versions expired
+	DeleteMarkers      int // delete markers left without versions
+	NoncurrentVersions int
+	Uploads            int // incomplete multipart uploads aborted
+}
+
+// Kinds of lifecycle expiry.
+const (
+	expireCurrent = iota
+	expireDeleteMarker
+	expireNoncurrent
+)
+
+// expiry is a version a lifecycle rule found due. LastModified identifies
+// the row, so a version rewritten since the scan is left alone.
+type expiry struct {
+	kind         int
+	rule         string
+	key          string
+	versionID    string
+	lastModified string
+}
+
+// ApplyLifecycle runs the lifecycle rules of every bucket as of now, logging
+// each version and upload it removes. A bucket that fails does not stop the
+// others; the errors are returned together.
+func ApplyLifecycle(st *storage.Store, now time.Time) (LifecycleReport, error) {
+	var report LifecycleReport
+	records, err := st.Meta.Buckets()
+	if err != nil {
+		return report, err
+	}
+
+	var errs []error
+	for _, record := range records {
+		bucketName := record[0]
+		config, err := st.BucketLifecycle(bucketName)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if config == "" {
+			continue
+		}
+		parsed, err := lifecycle.Parse([]byte(config))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("bucket %s: invalid lifecycle configuration: %w", bucketName, err))
+			continue
+		}
+		if err := applyBucketLifecycle(st, bucketName, parsed.Rules, now, &report); err != nil {
+			errs = append(errs, fmt.Errorf("bucket %s: %w", bucketName, err))
+		}
+	}
+	return report, errors.Join(errs...)
+}
+
+func applyBucketLifecycle(st *storage.Store, bucketName string, rules []lifecycle.Rule, now time.Time, report *LifecycleReport) error {
+	// Collect the due versions first: the metadata cannot change during a scan
+	var due []expiry
+	err := st.Meta.Scan(bucketName, "", func(key string, versions [][]string) bool {
+		due = append(due, dueVersions(rules, key, versions, now)...)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range due {
+		removed, err := expireVersion(st, bucketName, e)
+		if err != nil {
+			return err
+		}
+		if !removed {
+			continue
+		}
+		switch e.kind {
+		case expireCurrent:
+			report.Expired++
+			fmt.Printf("Lifecycle rule %q expired %s/%s\n", e.rule, bucketName, e.key)
+		case expireDeleteMarker:
+			report.DeleteMarkers++
+			fmt.Printf("Lifecycle rule %q removed the delete marker of %s/%s\n", e.rule, bucketName, e.key)
+		case expireNoncurrent:
+			report.NoncurrentVersions++
+			fmt.Printf("Lifecycle rule %q removed version %s of %s/%s\n", e.rule, e.versionID, bucketName, e.key)
+		}
+	}
+
+	uploads, err := ListUploads(st, bucketName)
+	if err != nil {
+		return err
+	}
+	for _, upload := range uploads.Uploads {
+		for _, rule := range rules {
+			abort := rule.AbortIncompleteMultipartUpload
+			if !rule.Enabled() || abort == nil || !rule.MatchesPrefix(upload.Key) || !lifecycle.Due(upload.Initiated, abort.DaysAfterInitiation, now) {
+				continue
+			}
+			err := AbortUpload(st, bucketName, upload.Key, upload.UploadID)
+			if errors.Is(err, ErrNoSuchUpload) {
+				break // Completed or aborted meanwhile
+			}
+			if err != nil {
+				return err
+			}
+			report.Uploads++
+			fmt.Printf("Lifecycle rule %q aborted upload %s of %s/%s\n", rule.ID, upload.UploadID, bucketName, upload.Key)
+			break
+		}
+	}
+	return nil
+}
+
+// dueVersions returns the versions of one key the rules remove as of now.
+func dueVersions(rules []lifecycle.Rule, key string, versions [][]string, now time.Time) []expiry {
+	var due []expiry
+	current := latest(versions)
+	if current != nil && isCurrent(current) {
+		lastModified, _ := time.Parse(time.RFC3339, current[colLastModified])
+		for _, rule := range rules {
+			if rule.Enabled() && rule.Matches(versionObject(current)) && rule.ExpiresCurrent(lastModified, now) {
+				due = append(due, expiry{expireCurrent, rule.ID, key, current[colVersionID], current[colLastModified]})
+				break
+			}
+		}
+	}
+	if current != nil && current[colDeleteMarker] == "true" && len(versions) == 1 {
+		for _, rule := range rules {
+			if rule.Enabled() && rule.Expiration != nil && rule.Expiration.ExpiredObjectDeleteMarker && rule.MatchesPrefix(key) {
+				due = append(due, expiry{expireDeleteMarker, rule.ID, key, current[colVersionID], current[colLastModified]})
+				break
+			}
+		}
+	}
+
+	// A version turns noncurrent when the next one is written
+	newer := 0
+	for i := len(versions) - 2; i >= 0; i-- {
+		record := versions[i]
+		if record[colIsLatest] == "true" {
+			continue
+		}
+		since, _ := time.Parse(time.RFC3339, versions[i+1][colLastModified])
+		for _, rule := range rules {
+			expiration := rule.NoncurrentVersionExpiration
+			if !rule.Enabled() || expiration == nil || newer < expiration.NewerVersions() {
+				continue
+			}
+			if record[colDeleteMarker] == "true" && rule.HasObjectFilter() {
+				continue // Delete markers have no tags or size
+			}
+			if rule.Matches(versionObject(record)) && lifecycle.Due(since, expiration.NoncurrentDays, now) {
+				due = append(due, expiry{expireNoncurrent, rule.ID, key, record[colVersionID], record[colLastModified]})
+				break
+			}
+		}
+		newer++
+	}
+	return due
+}
+
+// versionObject returns what lifecycle filters look at in a version row.
+func versionObject(record []string) lifecycle.Object {
+	size, _ := strconv.ParseInt(record[colSize], 10, 64)
+	return lifecycle.Object{Key: record[colKey], Size: size, Tags: objectTags(record[colMetadata])}
+}
+
+// expireVersion removes the version e names, unless it changed since it was
+// found due. It reports whether it removed it.
+func expireVersion(st *storage.Store, bucketName string, e expiry) (bool, error) {
+	unlock := st.LockBucket(bucketName)
+	defer unlock()
+
+	records, err := readVersions(st, bucketName, e.key)
+	if err != nil {
+		return false, err
+	}
+	record := findVersion(records, e.versionID)
+	if record == nil || record[colLastModified] != e.lastModified {
+		return false, nil
+	}
+	switch e.kind {
+	case expireCurrent:
+		if !isCurrent(record) {
+			return false, nil
+		}
+		_, err = deleteObject(st, bucketName, e.key, "", nil)
+	case expireDeleteMarker:
+		if len(records) != 1 || record[colDeleteMarker] != "true" {
+			return false, nil
+		}
+		_, err = deleteObject(st, bucketName, e.key, e.versionID, nil)
+	case expireNoncurrent:
+		if record[colIsLatest] == "true" {
+			return false, nil
+		}
+		_, err = deleteObject(st, bucketName, e.key, e.versionID, nil)
+	}
+	return err == nil, err
+}
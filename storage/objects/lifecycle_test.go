@@ -0,0 +1,147 @@
+package objects
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"triple-s/storage/buckets"
+)
+
+func TestApplyLifecycle(t *testing.T) {
+	st := newTestStore(t)
+	config := `<LifecycleConfiguration>
+	<Rule><ID>logs</ID><Filter><Prefix>logs/</Prefix></Filter><Status>Enabled</Status>
+		<Expiration><Days>1</Days></Expiration></Rule>
+	<Rule><ID>disabled</ID><Filter><Prefix>data/</Prefix></Filter><Status>Disabled</Status>
+		<Expiration><Days>1</Days></Expiration></Rule>
+	<Rule><ID>versions</ID><Filter><Prefix>versioned</Prefix></Filter><Status>Enabled</Status>
+		<NoncurrentVersionExpiration><NoncurrentDays>1</NoncurrentDays><NewerNoncurrentVersions>1</NewerNoncurrentVersions></NoncurrentVersionExpiration></Rule>
+	<Rule><ID>markers</ID><Filter><Prefix>gone</Prefix></Filter><Status>Enabled</Status>
+		<Expiration><ExpiredObjectDeleteMarker>true</ExpiredObjectDeleteMarker></Expiration></Rule>
+	<Rule><ID>uploads</ID><Filter><Prefix>tmp/</Prefix></Filter><Status>Enabled</Status>
+		<AbortIncompleteMultipartUpload><DaysAfterInitiation>1</DaysAfterInitiation></AbortIncompleteMultipartUpload></Rule>
+</LifecycleConfiguration>`
+	if err := buckets.SetBucketLifecycle(st, "bucket", config); err != nil {
+		t.Fatal(err)
+	}
+	deleteVersion := func(key, versionID string) {
+		t.Helper()
+		if _, err := DeleteObject(st, "bucket", key, versionID, httptest.NewRequest(http.MethodDelete, "/bucket/"+key, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var versions []string
+	for _, body := range []string{"1", "2", "3", "4"} {
+		id, err := putObject(t, st, "versioned", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, id)
+	}
+	for _, key := range []string{"logs/old", "data/kept", "gone"} {
+		if _, err := putObject(t, st, key, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Leave a delete marker that hides nothing
+	deleteVersion("gone", "")
+	records, err := readVersions(st, "bucket", "gone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range records {
+		if record[colVersionID] != "" && record[colDeleteMarker] != "true" {
+			deleteVersion("gone", record[colVersionID])
+		}
+	}
+	uploadID := initiateUpload(t, st, "tmp/upload")
+	initiateUpload(t, st, "kept/upload")
+
+	// Only the delete marker is due right away
+	now := time.Now()
+	if report, err := ApplyLifecycle(st, now); err != nil || report != (LifecycleReport{DeleteMarkers: 1}) {
+		t.Fatalf("ApplyLifecycle now = %+v, %v", report, err)
+	}
+	if records, _ := readVersions(st, "bucket", "gone"); len(records) != 0 {
+		t.Errorf("gone still has %d versions", len(records))
+	}
+
+	later := now.Add(3 * 24 * time.Hour)
+	report, err := ApplyLifecycle(st, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (LifecycleReport{Expired: 1, NoncurrentVersions: 2, Uploads: 1}); report != want {
+		t.Errorf("report = %+v, want %+v", report, want)
+	}
+
+	// The expired key is hidden by a delete marker, its data kept as a noncurrent version
+	if exists, _ := st.ObjectExists("bucket", "logs/old"); exists {
+		t.Error("logs/old was not expired")
+	}
+	if records, _ := readVersions(st, "bucket", "logs/old"); len(records) != 2 {
+		t.Errorf("logs/old has %d versions, want the data and a delete marker", len(records))
+	}
+	if got := readObject(t, st, "data/kept", ""); got != "data/kept" {
+		t.Errorf("disabled rule changed data/kept: %q", got)
+	}
+
+	// The newest noncurrent version is kept along with the current one
+	records, err = readVersions(st, "bucket", "versioned")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0][colVersionID] != versions[2] || records[1][colVersionID] != versions[3] {
+		t.Errorf("versions left: %v, want %v", records, versions[2:])
+	}
+
+	uploads, err := ListUploads(st, "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uploads.Uploads) != 1 || uploads.Uploads[0].Key != "kept/upload" || uploads.Uploads[0].UploadID == uploadID {
+		t.Errorf("uploads left: %+v", uploads.Uploads)
+	}
+
+	// A second pass finds nothing more to do
+	if report, err := ApplyLifecycle(st, later); err != nil || report != (LifecycleReport{}) {
+		t.Errorf("second ApplyLifecycle = %+v, %v", report, err)
+	}
+}
+
+func TestApplyLifecycleUnversioned(t *testing.T) {
+	st := newTestStore(t)
+	if err := buckets.SetBucketVersioning(st, "bucket", ""); err != nil {
+		t.Fatal(err)
+	}
+	config := `<LifecycleConfiguration><Rule><Filter><And><Prefix>a</Prefix><ObjectSizeGreaterThan>3</ObjectSizeGreaterThan></And></Filter>
+		<Status>Enabled</Status><Expiration><Days>1</Days></Expiration></Rule></LifecycleConfiguration>`
+	if err := buckets.SetBucketLifecycle(st, "bucket", config); err != nil {
+		t.Fatal(err)
+	}
+	for key, body := range map[string]string{"a-large": "large", "a-small": "abc", "b-large": "large"} {
+		if _, err := putObject(t, st, key, body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := ApplyLifecycle(st, time.Now().Add(3*24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report != (LifecycleReport{Expired: 1}) {
+		t.Errorf("report = %+v, want one expired object", report)
+	}
+	if records, _ := readVersions(st, "bucket", "a-large"); len(records) != 0 {
+		t.Errorf("expired object left %d rows in an unversioned bucket", len(records))
+	}
+	for _, key := range []string{"a-small", "b-large"} {
+		if exists, _ := st.ObjectExists("bucket", key); !exists {
+			t.Errorf("%s was expired", key)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package objects
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"triple-s/storage"
+)
+
+// DefaultMaxKeys is the page size used when the client does not send max-keys.
+const DefaultMaxKeys = 1000
+
+var ErrInvalidContinuationToken = &storage.Error{Code: "InvalidArgument", Message: "The continuation token provided is incorrect", StatusCode: http.StatusBadRequest}
+
+// ListParams holds the ListObjects and ListObjectsV2 query parameters.
+type ListParams struct {
+	Prefix            string
+	Delimiter         string
+	Marker            string // ListObjects only
+	StartAfter        string
+	ContinuationToken string
+	MaxKeys           int
+}
+
+// ListObjects returns one page of the bucket listing described by params,
+// in the version 1 format that pages with markers.
+func ListObjects(st *storage.Store, bucketName string, params ListParams) (*ListBucketResultV1, error) {
+	if err := requireBucket(st, bucketName); err != nil {
+		return nil, err
+	}
+
+	page := &ListBucketResult{}
+	last, err := listKeys(st, bucketName, params, params.Marker, page)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ListBucketResultV1{
+		Xmlns:          storage.XMLNamespace,
+		Name:           bucketName,
+		Prefix:         params.Prefix,
+		Marker:         params.Marker,
+		Delimiter:      params.Delimiter,
+		MaxKeys:        params.MaxKeys,
+		IsTruncated:    page.IsTruncated,
+		Contents:       page.Contents,
+		CommonPrefixes: page.CommonPrefixes,
+	}
+	if page.IsTruncated {
+		result.NextMarker = last
+	}
+	return result, nil
+}
+
+// ListObjectsV2 returns one page of the bucket listing described by params.
+func ListObjectsV2(st *storage.Store, bucketName string, params ListParams) (*ListBucketResult, error) {
+	if err := requireBucket(st, bucketName); err != nil {
+		return nil, err
+	}
+
+	// The continuation token wins over start-after, as in S3.
+	startKey := params.StartAfter
+	if params.ContinuationToken != "" {
+		token, err := base64.RawURLEncoding.DecodeString(params.ContinuationToken)
+		if err != nil {
+			return nil, ErrInvalidContinuationToken
+		}
+		startKey = string(token)
+	}
+
+	result := &ListBucketResult{
+		Xmlns:             storage.XMLNamespace,
+		Name:              bucketName,
+		Prefix:            params.Prefix,
+		Delimiter:         params.Delimiter,
+		StartAfter:        params.StartAfter,
+		ContinuationToken: params.ContinuationToken,
+		MaxKeys:           params.MaxKeys,
+	}
+	last, err := listKeys(st, bucketName, params, startKey, result)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.IsTruncated {
+		result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+	}
+	return result, nil
+}
+
+// listKeys adds the keys and common prefixes following startKey to result,
+// up to params.MaxKeys, and returns the last one added.
+func listKeys(st *storage.Store, bucketName string, params ListParams, startKey string, result *ListBucketResult) (string, error) {
+	// Walk the keys in order from the later of the prefix and the start key.
+	from := params.Prefix
+	if startKey > from {
+		from = startKey
+	}
+	last, lastPrefix := "", ""
+	err := st.Meta.Scan(bucketName, from, func(key string, versions [][]string) bool {
+		if !strings.HasPrefix(key, params.Prefix) {
+			return false
+		}
+		record := latest(versions)
+		if key == startKey || record == nil || !isCurrent(record) {
+			return true
+		}
+
+		// Group keys sharing the part up to the next delimiter into a common prefix.
+		commonPrefix := ""
+		if params.Delimiter != "" {
+			if i := strings.Index(key[len(params.Prefix):], params.Delimiter); i >= 0 {
+				commonPrefix = key[:len(params.Prefix)+i+len(params.Delimiter)]
+			}
+		}
+		if commonPrefix != "" && (commonPrefix == lastPrefix || commonPrefix <= startKey) {
+			return true
+		}
+
+		if result.KeyCount == params.MaxKeys {
+			result.IsTruncated = params.MaxKeys > 0
+			return false
+		}
+
+		if commonPrefix != "" {
+			result.CommonPrefixes = append(result.CommonPrefixes, CommonPrefix{Prefix: commonPrefix})
+			lastPrefix, last = commonPrefix, commonPrefix
+		} else {
+			size, _ := strconv.ParseInt(record[colSize], 10, 64)
+			lastModifiedTime, _ := time.Parse(time.RFC3339, record[colLastModified])
+			result.Contents = append(result.Contents, ObjectSummary{
+				Key:          key,
+				LastModified: lastModifiedTime,
+				ETag:         quoteETag(record[colETag]),
+				Size:         size,
+				StorageClass: "STANDARD",
+			})
+			last = key
+		}
+		result.KeyCount++
+		return true
+	})
+	return last, err
+}
@@ -0,0 +1,120 @@
+package objects
+
+import (
+	"reflect"
+	"testing"
+
+	"triple-s/storage"
+)
+
+// putKeys stores an object under each key, its key as its content.
+func putKeys(t *testing.T, keys ...string) *storage.Store {
+	t.Helper()
+	st := newTestStore(t)
+	for _, key := range keys {
+		if _, err := putObject(t, st, key, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return st
+}
+
+// listAll follows the continuation tokens of ListObjectsV2 and returns the
+// keys and common prefixes of every page, in order, with the page count.
+func listAll(t *testing.T, st *storage.Store, params ListParams) (entries []string, pages int) {
+	t.Helper()
+	for {
+		result, err := ListObjectsV2(st, "bucket", params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+		if result.KeyCount != len(result.Contents)+len(result.CommonPrefixes) {
+			t.Errorf("page %d: KeyCount %d for %d entries", pages, result.KeyCount, len(result.Contents)+len(result.CommonPrefixes))
+		}
+		if result.KeyCount > params.MaxKeys {
+			t.Errorf("page %d: %d entries, max-keys %d", pages, result.KeyCount, params.MaxKeys)
+		}
+		for _, object := range result.Contents {
+			entries = append(entries, object.Key)
+		}
+		for _, prefix := range result.CommonPrefixes {
+			entries = append(entries, prefix.Prefix)
+		}
+		if !result.IsTruncated {
+			return entries, pages
+		}
+		if result.NextContinuationToken == "" || pages > 20 {
+			t.Fatalf("page %d is truncated without a usable continuation token", pages)
+		}
+		params.ContinuationToken = result.NextContinuationToken
+	}
+}
+
+func TestListObjectsV2Pages(t *testing.T) {
+	st := putKeys(t, "a", "b", "dir/x", "dir/y", "dir2/z", "e")
+	if _, err := DeleteObject(st, "bucket", "b", "", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		params ListParams
+		want   []string
+		pages  int
+	}{
+		{"all keys", ListParams{MaxKeys: 2}, []string{"a", "dir/x", "dir/y", "dir2/z", "e"}, 3},
+		{"one per page", ListParams{MaxKeys: 1}, []string{"a", "dir/x", "dir/y", "dir2/z", "e"}, 5},
+		{"prefix", ListParams{Prefix: "dir", MaxKeys: 2}, []string{"dir/x", "dir/y", "dir2/z"}, 2},
+		{"delimiter", ListParams{Delimiter: "/", MaxKeys: 1}, []string{"a", "dir/", "dir2/", "e"}, 4},
+		{"prefix and delimiter", ListParams{Prefix: "dir/", Delimiter: "/", MaxKeys: 1000}, []string{"dir/x", "dir/y"}, 1},
+		{"start after", ListParams{StartAfter: "dir/x", MaxKeys: 2}, []string{"dir/y", "dir2/z", "e"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, pages := listAll(t, st, tt.params)
+			if !reflect.DeepEqual(entries, tt.want) {
+				t.Errorf("entries = %v, want %v", entries, tt.want)
+			}
+			if pages != tt.pages {
+				t.Errorf("%d pages, want %d", pages, tt.pages)
+			}
+		})
+	}
+}
+
+func TestListObjectsV2MaxKeysZero(t *testing.T) {
+	st := putKeys(t, "a", "b")
+	result, err := ListObjectsV2(st, "bucket", ListParams{MaxKeys: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.KeyCount != 0 || len(result.Contents) != 0 || result.IsTruncated || result.NextContinuationToken != "" {
+		t.Errorf("max-keys=0 gave %+v, want an empty page that is not truncated", result)
+	}
+}
+
+func TestListObjectsV2InvalidToken(t *testing.T) {
+	st := putKeys(t, "a")
+	if _, err := ListObjectsV2(st, "bucket", ListParams{ContinuationToken: "not base64!", MaxKeys: 10}); err != ErrInvalidContinuationToken {
+		t.Errorf("got %v, want %v", err, ErrInvalidContinuationToken)
+	}
+}
+
+func TestListObjectsMarkers(t *testing.T) {
+	st := putKeys(t, "a", "b", "c")
+	first, err := ListObjects(st, "bucket", ListParams{MaxKeys: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.IsTruncated || first.NextMarker != "b" || len(first.Contents) != 2 {
+		t.Fatalf("first page = %+v, want a and b with next marker b", first)
+	}
+	second, err := ListObjects(st, "bucket", ListParams{Marker: first.NextMarker, MaxKeys: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.IsTruncated || len(second.Contents) != 1 || second.Contents[0].Key != "c" {
+		t.Errorf("second page = %+v, want only c", second)
+	}
+}
@@ -11,10 +11,158 @@ type Object struct {
 	Key              string    `xml:"key"`
 	ContentType      string    `xml:"contentType"`
 	Size             string    `xml:"size"`
+	ETag             string    `xml:"etag,omitempty"`
 	LastModifiedTime time.Time `xml:"lastModifiedTime"`
 }
 
+// ObjectList is the bucket listing served in the legacy XML format.
 type ObjectList struct {
 	XMLName xml.Name `xml:"ObjectList"`
 	Objects []Object `xml:"Object"`
 }
+
+// ListBucketResult is the ListObjectsV2 response body.
+type ListBucketResult struct {
+	XMLName               xml.Name        `xml:"ListBucketResult"`
+	Xmlns                 string          `xml:"xmlns,attr"`
+	Name                  string          `xml:"Name"`
+	Prefix                string          `xml:"Prefix"`
+	Delimiter             string          `xml:"Delimiter,omitempty"`
+	StartAfter            string          `xml:"StartAfter,omitempty"`
+	ContinuationToken     string          `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string          `xml:"NextContinuationToken,omitempty"`
+	KeyCount              int             `xml:"KeyCount"`
+	MaxKeys               int             `xml:"MaxKeys"`
+	IsTruncated           bool            `xml:"IsTruncated"`
+	Contents              []ObjectSummary `xml:"Contents"`
+	CommonPrefixes        []CommonPrefix  `xml:"CommonPrefixes"`
+}
+
+// ListBucketResultV1 is the ListObjects (version 1) response body.
+type ListBucketResultV1 struct {
+	XMLName        xml.Name        `xml:"ListBucketResult"`
+	Xmlns          string          `xml:"xmlns,attr"`
+	Name           string          `xml:"Name"`
+	Prefix         string          `xml:"Prefix"`
+	Marker         string          `xml:"Marker"`
+	NextMarker     string          `xml:"NextMarker,omitempty"`
+	Delimiter      string          `xml:"Delimiter,omitempty"`
+	MaxKeys        int             `xml:"MaxKeys"`
+	IsTruncated    bool            `xml:"IsTruncated"`
+	Contents       []ObjectSummary `xml:"Contents"`
+	CommonPrefixes []CommonPrefix  `xml:"CommonPrefixes"`
+}
+
+// ObjectSummary describes one key in a ListBucketResult.
+type ObjectSummary struct {
+	Key          string    `xml:"Key"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag,omitempty"`
+	Size         int64     `xml:"Size"`
+	StorageClass string    `xml:"StorageClass"`
+}
+
+// CommonPrefix is a group of keys rolled up by the delimiter.
+type CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// InitiateMultipartUploadResult is returned when a multipart upload starts.
+type InitiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+// CompleteMultipartUpload is the request body listing the parts to join.
+type CompleteMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []CompletedPart `xml:"Part"`
+}
+
+// CompletedPart names one part of a CompleteMultipartUpload request.
+type CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// CompleteMultipartUploadResult is returned once the parts are joined.
+type CompleteMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+// Part describes an uploaded part of a multipart upload.
+type Part struct {
+	PartNumber   int       `xml:"PartNumber"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"`
+	Size         int64     `xml:"Size"`
+}
+
+// ListPartsResult is the response body of a ListParts request.
+type ListPartsResult struct {
+	XMLName  xml.Name `xml:"ListPartsResult"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+	Parts    []Part   `xml:"Part"`
+}
+
+// Upload describes a multipart upload in progress.
+type Upload struct {
+	Key         string    `xml:"Key"`
+	UploadID    string    `xml:"UploadId"`
+	ContentType string    `xml:"-"`
+	Metadata    string    `xml:"-"`
+	Initiated   time.Time `xml:"Initiated"`
+}
+
+// ListMultipartUploadsResult is the response body of a ListMultipartUploads request.
+type ListMultipartUploadsResult struct {
+	XMLName xml.Name `xml:"ListMultipartUploadsResult"`
+	Bucket  string   `xml:"Bucket"`
+	Uploads []Upload `xml:"Upload"`
+}
+
+// ListVersionsResult is the response body of a ListObjectVersions request.
+// Versions holds ObjectVersion and DeleteMarkerEntry values in listing order.
+type ListVersionsResult struct {
+	XMLName  xml.Name      `xml:"ListVersionsResult"`
+	Xmlns    string        `xml:"xmlns,attr"`
+	Name     string        `xml:"Name"`
+	Prefix   string        `xml:"Prefix"`
+	Versions []interface{} `xml:""`
+}
+
+// ObjectVersion describes one stored version of an object.
+type ObjectVersion struct {
+	XMLName      xml.Name  `xml:"Version"`
+	Key          string    `xml:"Key"`
+	VersionID    string    `xml:"VersionId"`
+	IsLatest     bool      `xml:"IsLatest"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag,omitempty"`
+	Size         int64     `xml:"Size"`
+	StorageClass string    `xml:"StorageClass"`
+}
+
+// DeleteMarkerEntry describes a delete marker in a version listing.
+type DeleteMarkerEntry struct {
+	XMLName      xml.Name  `xml:"DeleteMarker"`
+	Key          string    `xml:"Key"`
+	VersionID    string    `xml:"VersionId"`
+	IsLatest     bool      `xml:"IsLatest"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+// CopyObjectResult is the response body of a CopyObject request.
+type CopyObjectResult struct {
+	XMLName      xml.Name  `xml:"CopyObjectResult"`
+	ETag         string    `xml:"ETag"`
+	LastModified time.Time `xml:"LastModified"`
+}
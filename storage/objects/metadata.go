@@ -0,0 +1,63 @@
+package objects
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"triple-s/storage"
+)
+
+// MaxUserMetadataSize is the largest total size of the x-amz-meta-* headers.
+const MaxUserMetadataSize = 2048
+
+var ErrMetadataTooLarge = &storage.Error{Code: "MetadataTooLarge", Message: "Your metadata headers exceed the maximum allowed metadata size.", StatusCode: http.StatusBadRequest}
+
+// systemHeaders are the standard headers stored with an object and sent back on GET and HEAD.
+var systemHeaders = []string{"Cache-Control", "Content-Disposition", "Content-Encoding", "Content-Language", "Expires"}
+
+// extractMetadata collects the user metadata, stored system headers and tags
+// of a request, encoded for the Metadata column of the object metadata.
+func extractMetadata(header http.Header) (string, error) {
+	values := url.Values{}
+	userSize := 0
+	for name, list := range header {
+		if strings.HasPrefix(name, "X-Amz-Meta-") {
+			value := strings.Join(list, ",")
+			userSize += len(name) - len("X-Amz-Meta-") + len(value)
+			values.Set(name, value)
+		}
+	}
+	if userSize > MaxUserMetadataSize {
+		return "", ErrMetadataTooLarge
+	}
+
+	for _, name := range systemHeaders {
+		if value := header.Get(name); value != "" {
+			values.Set(name, value)
+		}
+	}
+
+	if tagging := header.Get(taggingKey); tagging != "" {
+		tags, err := parseTagging(tagging)
+		if err != nil {
+			return "", err
+		}
+		values.Set(taggingKey, tags.Encode())
+	}
+	return values.Encode(), nil
+}
+
+// setMetadataHeaders writes the stored metadata of an object to the response headers.
+func setMetadataHeaders(w http.ResponseWriter, metadata string) {
+	values, _ := url.ParseQuery(metadata)
+	for name, list := range values {
+		switch {
+		case name == taggingKey:
+			setTaggingCountHeader(w, list[0])
+		case strings.HasPrefix(name, internalPrefix):
+		default:
+			w.Header()[name] = list
+		}
+	}
+}
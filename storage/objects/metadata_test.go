@@ -0,0 +1,84 @@
+package objects
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetadataRoundTrip(t *testing.T) {
+	st := newTestStore(t)
+	header := map[string]string{
+		"X-Amz-Meta-Git-Sha":  "1a2b3c",
+		"X-Amz-Meta-Build-Id": "build 42 & more",
+		"Cache-Control":       "max-age=60",
+		"Content-Disposition": `attachment; filename="report.txt"`,
+		"Content-Encoding":    "gzip",
+		"Content-Language":    "en",
+		"Expires":             "Wed, 21 Oct 2026 07:28:00 GMT",
+		"X-Amz-Tagging":       "team=storage&env=dev",
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPut, "/bucket/key", strings.NewReader("data"))
+	for name, value := range header {
+		r.Header.Set(name, value)
+	}
+	if err := CreateObject(st, "bucket", "key", w, r); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		w := httptest.NewRecorder()
+		if err := GetObject(st, "bucket", "key", "", w, httptest.NewRequest(method, "/bucket/key", nil)); err != nil {
+			t.Fatal(err)
+		}
+		for name, want := range header {
+			if name == "X-Amz-Tagging" {
+				continue
+			}
+			if got := w.Header().Get(name); got != want {
+				t.Errorf("%s: %s = %q, want %q", method, name, got, want)
+			}
+		}
+		if got := w.Header().Get("x-amz-tagging-count"); got != "2" {
+			t.Errorf("%s: x-amz-tagging-count = %q, want 2", method, got)
+		}
+		if got := w.Header().Get("X-Amz-Tagging"); got != "" {
+			t.Errorf("%s: tags sent back as a header: %q", method, got)
+		}
+	}
+}
+
+func TestExtractMetadata(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   error
+	}{
+		{"none", http.Header{}, nil},
+		{"at the limit", http.Header{"X-Amz-Meta-A": {strings.Repeat("v", MaxUserMetadataSize-1)}}, nil},
+		{"too large", http.Header{"X-Amz-Meta-A": {strings.Repeat("v", MaxUserMetadataSize)}}, ErrMetadataTooLarge},
+		{"too large in total", http.Header{
+			"X-Amz-Meta-A": {strings.Repeat("v", MaxUserMetadataSize/2)},
+			"X-Amz-Meta-B": {strings.Repeat("v", MaxUserMetadataSize/2)},
+		}, ErrMetadataTooLarge},
+		{"bad tagging", http.Header{"X-Amz-Tagging": {"a=1&a=2"}}, ErrInvalidTag},
+	}
+	for _, tt := range tests {
+		if _, err := extractMetadata(tt.header); err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestSetMetadataHeadersHidesInternalValues(t *testing.T) {
+	w := httptest.NewRecorder()
+	setMetadataHeaders(w, internalPrefix+"Sealed-Key=secret&X-Amz-Meta-Color=blue")
+	if got := w.Header().Get(internalPrefix + "Sealed-Key"); got != "" {
+		t.Errorf("internal metadata sent as a header: %q", got)
+	}
+	if got := w.Header().Get("X-Amz-Meta-Color"); got != "blue" {
+		t.Errorf("X-Amz-Meta-Color = %q, want blue", got)
+	}
+}
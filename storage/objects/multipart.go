@@ -0,0 +1,436 @@
+package objects
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"triple-s/storage"
+	"triple-s/storage/backend"
+	"triple-s/storage/sse"
+)
+
+// MinPartSize is the smallest size allowed for every part but the last one.
+const MinPartSize = 5 << 20
+
+// MaxPartNumber is the highest part number a client may upload.
+const MaxPartNumber = 10000
+
+var (
+	ErrNoSuchUpload     = &storage.Error{Code: "NoSuchUpload", Message: "The specified multipart upload does not exist. The upload ID might be invalid, or the multipart upload might have been aborted or completed.", StatusCode: http.StatusNotFound}
+	ErrInvalidPart      = &storage.Error{Code: "InvalidPart", Message: "One or more of the specified parts could not be found. The part might not have been uploaded, or the specified entity tag might not have matched the part's entity tag.", StatusCode: http.StatusBadRequest}
+	ErrInvalidPartOrder = &storage.Error{Code: "InvalidPartOrder", Message: "The list of parts was not in ascending order. The parts list must be specified in order by part number.", StatusCode: http.StatusBadRequest}
+	ErrEntityTooSmall   = &storage.Error{Code: "EntityTooSmall", Message: "Your proposed upload is smaller than the minimum allowed object size.", StatusCode: http.StatusBadRequest}
+)
+
+// uploadPrefix returns the prefix of the data names of a multipart upload.
+func uploadPrefix(bucketName, uploadID string) string {
+	return bucketName + "/" + storage.UploadsDir + "/" + uploadID + "/"
+}
+
+// InitiateUpload creates the staging area for a new multipart upload and returns
+// its ID. The content type and metadata headers of r are applied on completion.
+// An encrypted upload gets its data key now: every part is encrypted with it.
+func InitiateUpload(st *storage.Store, bucketName, objectKey string, w http.ResponseWriter, r *http.Request) (string, error) {
+	if err := requireBucket(st, bucketName); err != nil {
+		return "", err
+	}
+	metadata, err := extractMetadata(r.Header)
+	if err != nil {
+		return "", err
+	}
+	enc, err := newEncryption(st, bucketName, r.Header)
+	if err != nil {
+		return "", err
+	}
+	metadata = enc.addTo(metadata)
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	uploadID := hex.EncodeToString(id)
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write([]string{"ObjectKey", "ContentType", "Initiated", "Metadata"})
+	writer.Write([]string{objectKey, r.Header.Get("Content-Type"), time.Now().Format(time.RFC3339), metadata})
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return "", err
+	}
+	if _, err := st.Data.Put(uploadPrefix(bucketName, uploadID)+"upload.csv", &buf); err != nil {
+		return "", err
+	}
+	setEncryptionHeaders(w, metadata)
+	return uploadID, nil
+}
+
+// readUpload loads the description of an upload and checks that it belongs to objectKey.
+// An empty objectKey matches any upload.
+func readUpload(st *storage.Store, bucketName, objectKey, uploadID string) (Upload, error) {
+	if err := requireBucket(st, bucketName); err != nil {
+		return Upload{}, err
+	}
+	if uploadID == "" || strings.ContainsAny(uploadID, `/\.`) {
+		return Upload{}, ErrNoSuchUpload
+	}
+
+	content, err := st.Data.Get(uploadPrefix(bucketName, uploadID) + "upload.csv")
+	if errors.Is(err, fs.ErrNotExist) {
+		return Upload{}, ErrNoSuchUpload
+	}
+	if err != nil {
+		return Upload{}, err
+	}
+	defer content.Close()
+
+	reader := csv.NewReader(io.NewSectionReader(content, 0, content.Size()))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return Upload{}, err
+	}
+	if len(records) < 2 || len(records[1]) < 3 || (objectKey != "" && records[1][0] != objectKey) {
+		return Upload{}, ErrNoSuchUpload
+	}
+
+	initiated, _ := time.Parse(time.RFC3339, records[1][2])
+	upload := Upload{
+		Key:         records[1][0],
+		UploadID:    uploadID,
+		ContentType: records[1][1],
+		Initiated:   initiated,
+	}
+	// Uploads started by older releases have no Metadata column
+	if len(records[1]) > 3 {
+		upload.Metadata = records[1][3]
+	}
+	return upload, nil
+}
+
+// UploadPart stores the body of r as one part of a multipart upload and
+// returns its ETag. Uploading the same part number again replaces the earlier
+// part. A Content-MD5 header is checked against the received bytes. Parts of
+// an SSE-C upload need the customer key the upload was started with.
+func UploadPart(st *storage.Store, bucketName, objectKey, uploadID string, partNumber int, w http.ResponseWriter, r *http.Request) (string, error) {
+	upload, err := readUpload(st, bucketName, objectKey, uploadID)
+	if err != nil {
+		return "", err
+	}
+	expectedMD5, err := parseContentMD5(r.Header.Get("Content-MD5"))
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := storedDataKey(st, upload.Metadata, r.Header, "")
+	if err != nil {
+		return "", err
+	}
+	prefix := uploadPrefix(bucketName, uploadID)
+
+	tempName := storage.TempName("part-")
+	defer st.Data.Delete(tempName)
+
+	hash := md5.New()
+	data := io.TeeReader(r.Body, hash)
+	if dataKey != nil {
+		if data, err = sse.NewEncrypter(dataKey, data); err != nil {
+			return "", err
+		}
+	}
+	if _, err := st.Data.Put(tempName, data); err != nil {
+		return "", fmt.Errorf("failed to write part: %w", err)
+	}
+	if err := verifyDigest(expectedMD5, hash.Sum(nil)); err != nil {
+		return "", err
+	}
+	etag := hex.EncodeToString(hash.Sum(nil))
+
+	// The upload may have been completed or aborted while the part was sent
+	unlock := st.LockUpload(bucketName, uploadID)
+	defer unlock()
+	if _, err := readUpload(st, bucketName, objectKey, uploadID); err != nil {
+		return "", err
+	}
+
+	// Drop an earlier upload of the same part before moving the new one in.
+	var old []string
+	err = st.Data.List(fmt.Sprintf("%s%05d-", prefix, partNumber), func(name string, _ backend.Info) bool {
+		old = append(old, name)
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, name := range old {
+		if err := st.Data.Delete(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+	}
+	if err := st.Data.Rename(tempName, fmt.Sprintf("%s%05d-%s", prefix, partNumber, etag)); err != nil {
+		return "", err
+	}
+	setEncryptionHeaders(w, upload.Metadata)
+	return etag, nil
+}
+
+// listPartFiles returns the uploaded parts of an upload sorted by part
+// number, along with their data names. The sizes are those of the plaintext.
+func listPartFiles(st *storage.Store, bucketName string, upload Upload) ([]Part, []string, error) {
+	prefix := uploadPrefix(bucketName, upload.UploadID)
+	encrypted := isEncrypted(upload.Metadata)
+
+	var parts []Part
+	var names []string
+	err := st.Data.List(prefix, func(name string, info backend.Info) bool {
+		number, etag, found := strings.Cut(strings.TrimPrefix(name, prefix), "-")
+		partNumber, err := strconv.Atoi(number)
+		if !found || err != nil || strings.HasSuffix(etag, ".tmp") {
+			return true
+		}
+		size := info.Size
+		if encrypted {
+			size, _ = sse.DecryptedSize(size)
+		}
+		parts = append(parts, Part{
+			PartNumber:   partNumber,
+			LastModified: info.ModTime.UTC(),
+			ETag:         `"` + etag + `"`,
+			Size:         size,
+		})
+		names = append(names, name)
+		return true
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Backends need not list in order; the part numbers are zero-padded.
+	sort.Sort(partsByName{parts, names})
+	return parts, names, nil
+}
+
+type partsByName struct {
+	parts []Part
+	names []string
+}
+
+func (p partsByName) Len() int           { return len(p.parts) }
+func (p partsByName) Less(i, j int) bool { return p.names[i] < p.names[j] }
+func (p partsByName) Swap(i, j int) {
+	p.parts[i], p.parts[j] = p.parts[j], p.parts[i]
+	p.names[i], p.names[j] = p.names[j], p.names[i]
+}
+
+// ListParts describes the parts uploaded so far.
+func ListParts(st *storage.Store, bucketName, objectKey, uploadID string) (*ListPartsResult, error) {
+	upload, err := readUpload(st, bucketName, objectKey, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	parts, _, err := listPartFiles(st, bucketName, upload)
+	if err != nil {
+		return nil, err
+	}
+	return &ListPartsResult{Bucket: bucketName, Key: objectKey, UploadID: uploadID, Parts: parts}, nil
+}
+
+// CompleteUpload joins the requested parts into the final object, records its
+// metadata and removes the staging area. It returns the multipart ETag and,
+// when the bucket has versioning configured, the new version ID. The parts of
+// an encrypted upload are kept as they are, each its own encrypted stream.
+func CompleteUpload(st *storage.Store, bucketName, objectKey, uploadID string, requested []CompletedPart, w http.ResponseWriter, r *http.Request) (string, string, error) {
+	unlockUpload := st.LockUpload(bucketName, uploadID)
+	defer unlockUpload()
+
+	upload, err := readUpload(st, bucketName, objectKey, uploadID)
+	if err != nil {
+		return "", "", err
+	}
+	parts, names, err := listPartFiles(st, bucketName, upload)
+	if err != nil {
+		return "", "", err
+	}
+	byNumber := make(map[int]int, len(parts))
+	for i, part := range parts {
+		byNumber[part.PartNumber] = i
+	}
+
+	if len(requested) == 0 {
+		return "", "", ErrInvalidPart
+	}
+	var selected []int
+	var total int64
+	for i, req := range requested {
+		if i > 0 && req.PartNumber <= requested[i-1].PartNumber {
+			return "", "", ErrInvalidPartOrder
+		}
+		idx, ok := byNumber[req.PartNumber]
+		if !ok || strings.Trim(req.ETag, `"`) != strings.Trim(parts[idx].ETag, `"`) {
+			return "", "", ErrInvalidPart
+		}
+		if i < len(requested)-1 && parts[idx].Size < MinPartSize {
+			return "", "", ErrEntityTooSmall
+		}
+		selected = append(selected, idx)
+		total += parts[idx].Size
+	}
+	maxSize, err := maxObjectSize(st, bucketName)
+	if err != nil {
+		return "", "", err
+	}
+	if maxSize > 0 && total > maxSize {
+		return "", "", ErrQuotaExceeded
+	}
+
+	// Join the parts in the staging area, then move the result into place in one step.
+	tempName := storage.TempName("object-")
+	var c *commit
+	defer func() { discardStaged(st, tempName, c) }()
+
+	etags := md5.New()
+	var selectedNames, partSizes []string
+	for _, idx := range selected {
+		selectedNames = append(selectedNames, names[idx])
+		partSizes = append(partSizes, strconv.FormatInt(parts[idx].Size, 10))
+		sum, _ := hex.DecodeString(strings.Trim(parts[idx].ETag, `"`))
+		etags.Write(sum)
+	}
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(appendParts(st, writer, selectedNames))
+	}()
+	_, err = st.Data.Put(tempName, reader)
+	reader.Close()
+	if err != nil {
+		return "", "", err
+	}
+	size, metadata := total, upload.Metadata
+	if isEncrypted(metadata) {
+		values, _ := url.ParseQuery(metadata)
+		values.Set(partSizesKey, strings.Join(partSizes, ","))
+		metadata = values.Encode()
+	}
+
+	etag := fmt.Sprintf("%s-%d", hex.EncodeToString(etags.Sum(nil)), len(selected))
+	unlock := st.LockBucket(bucketName)
+	defer unlock()
+	c, versioning, err := planVersion(st, bucketName, objectKey, r)
+	if err != nil {
+		return "", "", err
+	}
+	if err := checkQuota(st, c, size); err != nil {
+		return "", "", err
+	}
+	c.TempName = tempName
+	c.Record = newRecord(bucketName, objectKey, c.VersionID, upload.ContentType, strconv.FormatInt(size, 10), etag, metadata)
+	if err := runCommit(st, c); err != nil {
+		return "", "", fmt.Errorf("failed to commit object: %w", err)
+	}
+
+	if err := removeUpload(st, bucketName, uploadID); err != nil {
+		return "", "", fmt.Errorf("failed to remove completed upload: %w", err)
+	}
+	setEncryptionHeaders(w, metadata)
+	versionID := c.VersionID
+	if versioning == "" {
+		versionID = ""
+	}
+	return etag, versionID, nil
+}
+
+// appendParts copies the named parts to dst one after the other.
+func appendParts(st *storage.Store, dst io.Writer, names []string) error {
+	for _, name := range names {
+		part, err := st.Data.Get(name)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(dst, io.NewSectionReader(part, 0, part.Size()))
+		part.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeUpload deletes the parts of an upload, then its description, so an
+// upload that failed to be removed can still be aborted.
+func removeUpload(st *storage.Store, bucketName, uploadID string) error {
+	prefix := uploadPrefix(bucketName, uploadID)
+	var names []string
+	err := st.Data.List(prefix, func(name string, _ backend.Info) bool {
+		if name != prefix+"upload.csv" {
+			names = append(names, name)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range append(names, prefix+"upload.csv") {
+		if err := st.Data.Delete(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// AbortUpload discards a multipart upload and all of its parts.
+func AbortUpload(st *storage.Store, bucketName, objectKey, uploadID string) error {
+	unlock := st.LockUpload(bucketName, uploadID)
+	defer unlock()
+
+	if _, err := readUpload(st, bucketName, objectKey, uploadID); err != nil {
+		return err
+	}
+	return removeUpload(st, bucketName, uploadID)
+}
+
+// ListUploads returns the multipart uploads in progress in the bucket, ordered by key.
+func ListUploads(st *storage.Store, bucketName string) (*ListMultipartUploadsResult, error) {
+	if err := requireBucket(st, bucketName); err != nil {
+		return nil, err
+	}
+
+	prefix := bucketName + "/" + storage.UploadsDir + "/"
+	var uploadIDs []string
+	err := st.Data.List(prefix, func(name string, _ backend.Info) bool {
+		if uploadID, file, _ := strings.Cut(strings.TrimPrefix(name, prefix), "/"); file == "upload.csv" {
+			uploadIDs = append(uploadIDs, uploadID)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ListMultipartUploadsResult{Bucket: bucketName}
+	for _, uploadID := range uploadIDs {
+		upload, err := readUpload(st, bucketName, "", uploadID)
+		if err != nil {
+			continue
+		}
+		result.Uploads = append(result.Uploads, upload)
+	}
+	sort.Slice(result.Uploads, func(i, j int) bool {
+		if result.Uploads[i].Key != result.Uploads[j].Key {
+			return result.Uploads[i].Key < result.Uploads[j].Key
+		}
+		return result.Uploads[i].Initiated.Before(result.Uploads[j].Initiated)
+	})
+	return result, nil
+}
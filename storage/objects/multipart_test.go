@@ -0,0 +1,135 @@
+package objects
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"triple-s/storage"
+)
+
+func initiateUpload(t *testing.T, st *storage.Store, key string) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/bucket/"+key+"?uploads", nil)
+	uploadID, err := InitiateUpload(st, "bucket", key, w, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return uploadID
+}
+
+func uploadPart(t *testing.T, st *storage.Store, key, uploadID string, partNumber int, body []byte) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPut, "/bucket/"+key, bytes.NewReader(body))
+	etag, err := UploadPart(st, "bucket", key, uploadID, partNumber, w, r)
+	if err != nil {
+		t.Fatalf("part %d: %v", partNumber, err)
+	}
+	return etag
+}
+
+func completeUpload(st *storage.Store, key, uploadID string, parts []CompletedPart) (string, error) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/bucket/"+key, nil)
+	etag, _, err := CompleteUpload(st, "bucket", key, uploadID, parts, w, r)
+	return etag, err
+}
+
+func TestMultipartUpload(t *testing.T) {
+	st := newTestStore(t)
+	uploadID := initiateUpload(t, st, "big")
+
+	first := bytes.Repeat([]byte("a"), MinPartSize)
+	etag1 := uploadPart(t, st, "big", uploadID, 1, first)
+	uploadPart(t, st, "big", uploadID, 2, []byte("replaced"))
+	etag2 := uploadPart(t, st, "big", uploadID, 2, []byte("tail"))
+
+	listed, err := ListParts(st, "bucket", "big", uploadID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed.Parts) != 2 || listed.Parts[0].Size != MinPartSize || listed.Parts[1].Size != 4 {
+		t.Fatalf("parts = %+v, want part 1 and the second upload of part 2", listed.Parts)
+	}
+
+	// Rejected completions leave the upload as it was
+	for _, tt := range []struct {
+		name  string
+		parts []CompletedPart
+		want  error
+	}{
+		{"no parts", nil, ErrInvalidPart},
+		{"repeated part", []CompletedPart{{1, etag1}, {1, etag1}}, ErrInvalidPartOrder},
+		{"replaced part", []CompletedPart{{1, etag1}, {2, fmt.Sprintf("%x", md5.Sum([]byte("replaced")))}}, ErrInvalidPart},
+		{"missing part", []CompletedPart{{1, etag1}, {3, etag2}}, ErrInvalidPart},
+	} {
+		if _, err := completeUpload(st, "big", uploadID, tt.parts); err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	etag, err := completeUpload(st, "big", uploadID, []CompletedPart{{1, `"` + etag1 + `"`}, {2, etag2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sums := md5.New()
+	for _, part := range []string{etag1, etag2} {
+		sum, _ := hex.DecodeString(part)
+		sums.Write(sum)
+	}
+	if want := hex.EncodeToString(sums.Sum(nil)) + "-2"; etag != want {
+		t.Errorf("ETag = %s, want %s", etag, want)
+	}
+	if got := readObject(t, st, "big", ""); got != string(first)+"tail" {
+		t.Errorf("object holds %d bytes, want the %d of both parts", len(got), MinPartSize+4)
+	}
+	if _, err := ListParts(st, "bucket", "big", uploadID); err != ErrNoSuchUpload {
+		t.Errorf("ListParts after completion: got %v, want %v", err, ErrNoSuchUpload)
+	}
+	if _, err := completeUpload(st, "big", uploadID, []CompletedPart{{1, etag1}}); err != ErrNoSuchUpload {
+		t.Errorf("completing twice: got %v, want %v", err, ErrNoSuchUpload)
+	}
+}
+
+func TestMultipartSmallPartBeforeLast(t *testing.T) {
+	st := newTestStore(t)
+	uploadID := initiateUpload(t, st, "key")
+	etag1 := uploadPart(t, st, "key", uploadID, 1, []byte("small"))
+	etag2 := uploadPart(t, st, "key", uploadID, 2, []byte("last"))
+	if _, err := completeUpload(st, "key", uploadID, []CompletedPart{{1, etag1}, {2, etag2}}); err != ErrEntityTooSmall {
+		t.Errorf("got %v, want %v", err, ErrEntityTooSmall)
+	}
+}
+
+func TestAbortUpload(t *testing.T) {
+	st := newTestStore(t)
+	kept := initiateUpload(t, st, "a")
+	aborted := initiateUpload(t, st, "b")
+	uploadPart(t, st, "b", aborted, 1, []byte("data"))
+
+	if err := AbortUpload(st, "bucket", "b", aborted); err != nil {
+		t.Fatal(err)
+	}
+	if err := AbortUpload(st, "bucket", "b", aborted); err != ErrNoSuchUpload {
+		t.Errorf("aborting twice: got %v, want %v", err, ErrNoSuchUpload)
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPut, "/bucket/b", bytes.NewReader([]byte("late")))
+	if _, err := UploadPart(st, "bucket", "b", aborted, 2, w, r); err != ErrNoSuchUpload {
+		t.Errorf("part of an aborted upload: got %v, want %v", err, ErrNoSuchUpload)
+	}
+
+	uploads, err := ListUploads(st, "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uploads.Uploads) != 1 || uploads.Uploads[0].UploadID != kept {
+		t.Errorf("uploads = %+v, want only %s", uploads.Uploads, kept)
+	}
+}
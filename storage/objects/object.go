@@ -1,38 +1,109 @@
 package objects
 
 import (
+	"crypto/md5"
+	"encoding/hex"
 	"encoding/xml"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
-	"os"
-	"path/filepath"
+	"net/textproto"
+	"strconv"
 	"time"
 
 	"triple-s/storage"
+	"triple-s/storage/backend"
 )
 
-func CreateObject(bucketName, objectKey string, w http.ResponseWriter, r *http.Request) error {
-	// Construct the object path
-	objectPath := filepath.Join(storage.StorageDir, bucketName, objectKey)
-	// Open file
-	objectFile, err := os.Create(objectPath)
+// CreateObject stores the request body as a new version of the object. The
+// size and ETag are measured from the bytes received, so bodies sent without
+// a Content-Length are accepted, and a Content-MD5 header is verified before
+// the upload replaces anything.
+func CreateObject(st *storage.Store, bucketName, objectKey string, w http.ResponseWriter, r *http.Request) error {
+	// Refuse early rather than receive a body with nowhere to go
+	if err := requireBucket(st, bucketName); err != nil {
+		return err
+	}
+	if err := precheckWrite(st, bucketName, objectKey, r); err != nil {
+		return err
+	}
+
+	// Collect the user metadata and system headers to store with the object
+	metadata, err := extractMetadata(r.Header)
+	if err != nil {
+		return err
+	}
+	expectedMD5, err := parseContentMD5(r.Header.Get("Content-MD5"))
+	if err != nil {
+		return err
+	}
+	enc, err := newEncryption(st, bucketName, r.Header)
 	if err != nil {
 		return err
 	}
-	defer objectFile.Close()
 
-	// Copy the content of the Request body to the object
-	io.Copy(objectFile, r.Body)
+	// A body larger than the bucket quota is refused without storing it
+	maxSize, err := maxObjectSize(st, bucketName)
+	if err != nil {
+		return err
+	}
+	body := io.Reader(r.Body)
+	if maxSize > 0 {
+		if r.ContentLength > maxSize {
+			return ErrQuotaExceeded
+		}
+		body = io.LimitReader(body, maxSize+1)
+	}
 
-	// Extract the size and the content type from the header
-	size := r.Header.Get("Content-Length")
+	// Receive the body in the staging area so a failed upload leaves the object untouched
+	tempName := storage.TempName("upload-")
+	var c *commit
+	defer func() { discardStaged(st, tempName, c) }()
+
+	// Copy the content of the Request body to the object, hashing it for the ETag
+	hash := md5.New()
+	data, err := enc.encrypt(io.TeeReader(body, hash))
+	if err != nil {
+		return err
+	}
+	stored, err := st.Data.Put(tempName, data)
+	if err != nil {
+		return fmt.Errorf("failed to write object: %w", err)
+	}
+	written, err := enc.plainSize(stored)
+	if err != nil {
+		return err
+	}
+	if maxSize > 0 && written > maxSize {
+		return ErrQuotaExceeded
+	}
+	if err := verifyDigest(expectedMD5, hash.Sum(nil)); err != nil {
+		return err
+	}
+	etag := hex.EncodeToString(hash.Sum(nil))
+
+	// The size is what was written, whatever the client announced
+	size := strconv.FormatInt(written, 10)
 	typeMime := r.Header.Get("Content-Type")
 
-	// Store object metadata
-	if err := CreateObjectMeta(bucketName, objectKey, typeMime, size); err != nil {
-		return fmt.Errorf("failed to store object metadata: %w", err)
+	// Pick the version ID, then install the data and its metadata together
+	unlock := st.LockBucket(bucketName)
+	defer unlock()
+	c, versioning, err := planVersion(st, bucketName, objectKey, r)
+	if err != nil {
+		return err
+	}
+	if err := checkQuota(st, c, written); err != nil {
+		return err
+	}
+	c.TempName = tempName
+	c.Record = newRecord(bucketName, objectKey, c.VersionID, typeMime, size, etag, enc.addTo(metadata))
+	if err := runCommit(st, c); err != nil {
+		return fmt.Errorf("failed to commit object: %w", err)
 	}
+	versionID := c.VersionID
+	lastModified, _ := time.Parse(time.RFC3339, c.Record[colLastModified])
 
 	// Write response
 	response := Object{
@@ -40,50 +111,154 @@ func CreateObject(bucketName, objectKey string, w http.ResponseWriter, r *http.R
 		Key:              objectKey,
 		ContentType:      typeMime,
 		Size:             size,
-		LastModifiedTime: time.Now(),
+		ETag:             quoteETag(etag),
+		LastModifiedTime: lastModified,
 	}
+	w.Header().Set("ETag", quoteETag(etag))
+	if versioning != "" {
+		w.Header().Set("x-amz-version-id", versionID)
+	}
+	setEncryptionHeaders(w, c.Record[colMetadata])
 	w.Header().Set("Content-Type", "application/xml")
 	w.WriteHeader(http.StatusOK)
 	xml.NewEncoder(w).Encode(response)
 	return nil
 }
 
-// DeleteObject removes the object and updates the metadata.
-func DeleteObject(bucketName, objectKey string) error {
-	objectPath := filepath.Join(storage.StorageDir, bucketName, objectKey)
-
-	if err := os.Remove(objectPath); err != nil {
-		return fmt.Errorf("failed to delete object: %w", err)
+// GetObject streams the content of the object to the ResponseWriter with the
+// stored Content-Type and Last-Modified. A Range header selects one or more
+// parts of the object. An empty versionID selects the latest version. HEAD
+// requests get the same headers without the body.
+func GetObject(st *storage.Store, bucketName, objectKey, versionID string, w http.ResponseWriter, r *http.Request) error {
+	record, content, err := openVersion(st, bucketName, objectKey, versionID)
+	if err != nil {
+		return err
+	}
+	if content != nil {
+		defer content.Close()
+	}
+	switch {
+	case record == nil && versionID != "":
+		return ErrNoSuchVersion
+	case record == nil:
+		return ErrNoSuchKey
+	case record[colDeleteMarker] == "true":
+		w.Header().Set("x-amz-delete-marker", "true")
+		w.Header().Set("x-amz-version-id", record[colVersionID])
+		if versionID != "" {
+			return ErrDeleteMarker
+		}
+		return ErrNoSuchKey
 	}
 
-	return DeleteObjectMeta(bucketName, objectKey)
-}
-
-// GetObject copies the content of the object to the ResponseWriter.
-func GetObject(bucketName, objectKey string, w http.ResponseWriter, r *http.Request) error {
-	objectPath := filepath.Join(storage.StorageDir, bucketName, objectKey)
-	objectFile, err := os.Open(objectPath)
+	// Encrypted versions need the key before anything about them is sent
+	content, err = decryptContent(st, record, content, r.Header, "")
 	if err != nil {
 		return err
 	}
-	_, err = io.Copy(w, objectFile)
-	if err != nil {
+
+	lastModified, _ := time.Parse(time.RFC3339, record[colLastModified])
+	if record[colETag] != "" {
+		w.Header().Set("ETag", quoteETag(record[colETag]))
+	}
+	w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	if err := checkPreconditions(r, record[colETag], lastModified, true, true); err != nil {
 		return err
 	}
 
-	size := r.Header.Get("Content-Length")
-	typeMime := r.Header.Get("Content-Type")
+	size := content.Size()
 
-	response := Object{
-		BucketName:       bucketName,
-		Key:              objectKey,
-		ContentType:      typeMime,
-		Size:             size,
-		LastModifiedTime: time.Now(),
+	ranges, err := parseRange(r.Header.Get("Range"), size)
+	if err != nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		return err
 	}
 
-	w.Header().Set("Content-Type", "application/xml")
-	w.WriteHeader(http.StatusOK)
-	xml.NewEncoder(w).Encode(response)
+	if versioning, _ := st.BucketVersioning(bucketName); versioning != "" {
+		w.Header().Set("x-amz-version-id", record[colVersionID])
+	}
+	contentType := record[colContentType]
+	if contentType == "" {
+		contentType = "binary/octet-stream"
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
+	setMetadataHeaders(w, record[colMetadata])
+
+	switch len(ranges) {
+	case 0:
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		w.WriteHeader(http.StatusOK)
+		if r.Method != http.MethodHead {
+			copyBody(w, io.NewSectionReader(content, 0, size))
+		}
+
+	case 1:
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Range", ranges[0].contentRange(size))
+		w.Header().Set("Content-Length", strconv.FormatInt(ranges[0].length, 10))
+		w.WriteHeader(http.StatusPartialContent)
+		if r.Method != http.MethodHead {
+			copyBody(w, io.NewSectionReader(content, ranges[0].start, ranges[0].length))
+		}
+
+	default:
+		// Several ranges are sent as the parts of a multipart/byteranges body.
+		parts := multipart.NewWriter(w)
+		w.Header().Set("Content-Type", "multipart/byteranges; boundary="+parts.Boundary())
+		w.WriteHeader(http.StatusPartialContent)
+		if r.Method == http.MethodHead {
+			return nil
+		}
+		for _, br := range ranges {
+			part, err := parts.CreatePart(textproto.MIMEHeader{
+				"Content-Type":  {contentType},
+				"Content-Range": {br.contentRange(size)},
+			})
+			if err != nil {
+				return nil
+			}
+			if !copyBody(part, io.NewSectionReader(content, br.start, br.length)) {
+				return nil
+			}
+		}
+		parts.Close()
+	}
 	return nil
 }
+
+// openVersion looks up a version of an object and opens its data under the
+// bucket's read lock, so the data cannot be moved aside in between. The content
+// is nil for delete markers, and the record is nil when there is no such version.
+func openVersion(st *storage.Store, bucketName, objectKey, versionID string) ([]string, backend.Content, error) {
+	unlock := st.RLockBucket(bucketName)
+	defer unlock()
+
+	if err := requireBucket(st, bucketName); err != nil {
+		return nil, nil, err
+	}
+	versions, err := readVersions(st, bucketName, objectKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	record := findVersion(versions, versionID)
+	if record == nil || record[colDeleteMarker] == "true" {
+		return record, nil, nil
+	}
+
+	content, err := st.Data.Get(dataName(st.Layout, record))
+	if err != nil {
+		return nil, nil, err
+	}
+	return record, content, nil
+}
+
+// copyBody streams src to the client. Once the headers are sent a failure can
+// only be logged, so it reports whether the copy succeeded.
+func copyBody(w io.Writer, src io.Reader) bool {
+	if _, err := io.Copy(w, src); err != nil {
+		fmt.Printf("Error streaming object: %v\n", err)
+		return false
+	}
+	return true
+}
@@ -1,103 +1,161 @@
 package objects
 
 import (
-	"encoding/csv"
 	"encoding/xml"
 	"fmt"
-	"io"
 	"net/http"
-	"os"
-	"path/filepath"
 	"time"
 
 	"triple-s/storage"
 )
 
-// CreateObjectMeta saves object metadata (content type, size, timestamps).
-func CreateObjectMeta(bucketName, key, contentType, size string) error {
-	objectFile := filepath.Join(storage.StorageDir, bucketName, "objects.csv")
+// Columns of an object version row. The versions of a key are kept in the
+// order they were written, so the last row is its newest version.
+const (
+	colBucket = iota
+	colKey
+	colContentType
+	colSize
+	colLastModified
+	colVersionID
+	colIsLatest
+	colDeleteMarker
+	colETag
+	colMetadata
+	numColumns
+)
+
+// readVersions returns the rows of every version of an object, oldest first.
+func readVersions(st *storage.Store, bucketName, key string) ([][]string, error) {
+	return st.Meta.Versions(bucketName, key)
+}
 
-	// Open the CSV file for reading and writing; create it if it doesn't exist.
-	file, err := os.OpenFile(objectFile, os.O_RDWR|os.O_CREATE, 0o644)
+// writeVersions replaces the rows of every version of an object and updates
+// the usage of the bucket by the difference. The caller holds the bucket's
+// lock, as the rows must not have changed since they were read.
+func writeVersions(st *storage.Store, bucketName, key string, records [][]string) error {
+	// Callers edit the rows they read in place, so read the old ones again
+	previous, err := readVersions(st, bucketName, key)
 	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+		return err
 	}
-	defer file.Close()
-
-	// Read existing records from the file.
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
-	if err != nil && err != io.EOF {
-		return fmt.Errorf("failed to read records: %w", err)
+	if err := st.Meta.SetVersions(bucketName, key, records); err != nil {
+		return err
 	}
+	return st.AddBucketUsage(bucketName, versionsUsage(records).Sub(versionsUsage(previous)))
+}
 
-	// Move the file pointer back to the start to overwrite the content.
-	if _, err := file.Seek(0, io.SeekStart); err != nil {
-		return fmt.Errorf("failed to seek file: %w", err)
+// latest returns the row of the latest version among versions, or nil.
+func latest(versions [][]string) []string {
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i][colIsLatest] == "true" {
+			return versions[i]
+		}
 	}
+	return nil
+}
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+// isCurrent reports whether the row is the visible version of its key.
+func isCurrent(record []string) bool {
+	return record[colIsLatest] == "true" && record[colDeleteMarker] != "true"
+}
 
-	currentTime := time.Now().Format(time.RFC3339)
-	modified := false
+// CreateObjectMeta saves the metadata of a new object version (content type,
+// size, ETag, timestamps, user metadata and system headers) and makes it the
+// latest one. A row with the same version ID, such as an earlier null
+// version, is replaced.
+func CreateObjectMeta(st *storage.Store, bucketName, key, versionID, contentType, size, etag, metadata string) error {
+	unlock := st.LockBucket(bucketName)
+	defer unlock()
+	return addVersionRecord(st, bucketName, key, newRecord(bucketName, key, versionID, contentType, size, etag, metadata))
+}
 
-	// Iterate over the records to update if the key matches.
-	for _, record := range records {
-		if record[0] == bucketName && record[1] == key {
-			// Update the record if it matches the bucket and key.
-			record = []string{bucketName, key, contentType, size, currentTime}
-			modified = true
-		}
-		// Write each record back to the file.
-		if err := writer.Write(record); err != nil {
-			return fmt.Errorf("failed to write record: %w", err)
-		}
+// requireBucket returns storage.ErrNoSuchBucket unless the bucket exists.
+func requireBucket(st *storage.Store, bucketName string) error {
+	exists, err := st.BucketExists(bucketName)
+	if err == nil && !exists {
+		err = storage.ErrNoSuchBucket
 	}
+	return err
+}
 
-	// If no matching record was found, write a new one.
-	if !modified {
-		if err := writer.Write([]string{bucketName, key, contentType, size, currentTime}); err != nil {
-			return fmt.Errorf("failed to write new record: %w", err)
-		}
+// newRecord builds the row of a new, latest object version.
+func newRecord(bucketName, key, versionID, contentType, size, etag, metadata string) []string {
+	return []string{
+		bucketName, key, contentType, size, time.Now().Format(time.RFC3339), versionID, "true", "false", etag, metadata,
 	}
+}
 
-	// Ensure the file is properly flushed and truncated at the right point.
-	if err := file.Sync(); err != nil {
-		return fmt.Errorf("failed to sync file: %w", err)
+// addVersionRecord appends record as the latest version of key. The caller
+// holds the bucket's lock.
+func addVersionRecord(st *storage.Store, bucketName, key string, record []string) error {
+	records, err := readVersions(st, bucketName, key)
+	if err != nil {
+		return fmt.Errorf("failed to read records: %w", err)
 	}
 
-	return nil
-}
+	kept := records[:0]
+	for _, existing := range records {
+		if existing[colVersionID] == record[colVersionID] {
+			continue
+		}
+		existing[colIsLatest] = "false"
+		kept = append(kept, existing)
+	}
 
-func ListObjects(w http.ResponseWriter, r *http.Request, bucketName string) error {
-	objectFile := filepath.Join(storage.StorageDir, bucketName, "/objects.csv")
+	return writeVersions(st, bucketName, key, append(kept, record))
+}
 
-	// Open the CSV file for reading
-	file, err := os.Open(objectFile)
+// removeVersionRecord removes the row of versionID from the versions of key.
+// When it was the latest, the newest remaining version becomes the latest.
+// The caller holds the bucket's lock.
+func removeVersionRecord(st *storage.Store, bucketName, key, versionID string) error {
+	records, err := readVersions(st, bucketName, key)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to read records: %w", err)
 	}
-	defer file.Close()
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
-	if err != nil {
+	wasLatest := false
+	kept := records[:0]
+	for _, existing := range records {
+		if existing[colVersionID] == versionID {
+			wasLatest = existing[colIsLatest] == "true"
+			continue
+		}
+		kept = append(kept, existing)
+	}
+	if len(kept) == len(records) {
+		return nil // Removed before a crash cut the commit short
+	}
+	if wasLatest && len(kept) > 0 {
+		kept[len(kept)-1][colIsLatest] = "true"
+	}
+	return writeVersions(st, bucketName, key, kept)
+}
+
+// ListObjectsLegacy writes every current object of a bucket as an ObjectList.
+func ListObjectsLegacy(st *storage.Store, w http.ResponseWriter, r *http.Request, bucketName string) error {
+	if err := requireBucket(st, bucketName); err != nil {
 		return err
 	}
 
 	var objects []Object
-	for _, record := range records[1:] { // Assuming the first record is a header
-		if record[0] == bucketName {
-			lastModifiedTime, _ := time.Parse(time.RFC3339, record[4])
+	err := st.Meta.Scan(bucketName, "", func(key string, versions [][]string) bool {
+		if record := latest(versions); record != nil && isCurrent(record) {
+			lastModifiedTime, _ := time.Parse(time.RFC3339, record[colLastModified])
 			objects = append(objects, Object{
-				BucketName:       record[0],
-				Key:              record[1],
-				ContentType:      r.Header.Get("Content-Type"),
-				Size:             r.Header.Get("Content-Length"),
+				BucketName:       record[colBucket],
+				Key:              record[colKey],
+				ContentType:      record[colContentType],
+				Size:             record[colSize],
+				ETag:             quoteETag(record[colETag]),
 				LastModifiedTime: lastModifiedTime,
 			})
 		}
+		return true
+	})
+	if err != nil {
+		return err
 	}
 	response := ObjectList{Objects: objects}
 	w.Header().Set("Content-Type", "application/xml")
@@ -106,37 +164,21 @@ func ListObjects(w http.ResponseWriter, r *http.Request, bucketName string) erro
 	return nil
 }
 
-func DeleteObjectMeta(bucketName, key string) error {
-	objectFile := filepath.Join(storage.StorageDir, bucketName, "/objects.csv")
-
-	file, err := os.Open(objectFile)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
+// DeleteObjectMeta removes the row of one version of an object.
+func DeleteObjectMeta(st *storage.Store, bucketName, key, versionID string) error {
+	unlock := st.LockBucket(bucketName)
+	defer unlock()
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	records, err := readVersions(st, bucketName, key)
 	if err != nil {
 		return err
 	}
 
-	newFile, err := os.Create(objectFile)
-	if err != nil {
-		return err
-	}
-	defer newFile.Close()
-
-	writer := csv.NewWriter(newFile)
-	defer writer.Flush()
-
+	kept := records[:0]
 	for _, record := range records {
-		if record[0] != bucketName || record[1] != key {
-			err := writer.Write(record)
-			if err != nil {
-				return err
-			}
+		if record[colVersionID] != versionID {
+			kept = append(kept, record)
 		}
 	}
-	return nil
+	return writeVersions(st, bucketName, key, kept)
 }
@@ -0,0 +1,101 @@
+package objects
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"triple-s/storage"
+)
+
+var ErrQuotaExceeded = &storage.Error{Code: "QuotaExceeded", Message: "The bucket quota does not allow this object to be stored.", StatusCode: http.StatusForbidden}
+
+// versionsUsage returns what the version rows of an object add to the usage
+// of their bucket.
+func versionsUsage(records [][]string) storage.Usage {
+	var usage storage.Usage
+	for _, record := range records {
+		if record[colDeleteMarker] == "true" {
+			continue
+		}
+		size, _ := strconv.ParseInt(record[colSize], 10, 64)
+		usage.Bytes += size
+		usage.Objects++
+	}
+	return usage
+}
+
+// maxObjectSize returns the byte quota of a bucket, which no single object
+// may exceed, or 0 when it has none. Uploads check it before receiving the
+// data, so a body that cannot fit is refused without filling the disk.
+func maxObjectSize(st *storage.Store, bucketName string) (int64, error) {
+	quota, _, _, err := st.BucketQuota(bucketName)
+	return quota.MaxBytes, err
+}
+
+// checkQuota returns ErrQuotaExceeded when committing c with size bytes of
+// data would take the bucket over its quota. The version c replaces, if any,
+// is given back. The caller holds the bucket's lock.
+func checkQuota(st *storage.Store, c *commit, size int64) error {
+	quota, usage, _, err := st.BucketQuota(c.Bucket)
+	if err != nil || quota == (storage.Quota{}) {
+		return err
+	}
+
+	delta := storage.Usage{Bytes: size, Objects: 1}
+	versions, err := readVersions(st, c.Bucket, c.Key)
+	if err != nil {
+		return err
+	}
+	if replaced := findVersion(versions, c.VersionID); replaced != nil {
+		delta = delta.Sub(versionsUsage([][]string{replaced}))
+	}
+	if usage.Exceeds(quota, delta) {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// RecountUsage sets the usage of a bucket from the metadata of its objects.
+func RecountUsage(st *storage.Store, bucketName string) error {
+	unlock := st.LockBucket(bucketName)
+	defer unlock()
+
+	var usage storage.Usage
+	err := st.Meta.Scan(bucketName, "", func(_ string, versions [][]string) bool {
+		usage = usage.Add(versionsUsage(versions))
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return st.SetBucketUsage(bucketName, usage)
+}
+
+// CountUsage counts the usage of the buckets created by releases that did
+// not keep it, and of every bucket when all is set: a crash between a
+// metadata write and its usage update leaves the count behind. It runs once
+// at startup; later writes keep the counts current.
+func CountUsage(st *storage.Store, all bool) error {
+	records, err := st.Meta.Buckets()
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if record[3] == "Deleted" {
+			continue
+		}
+		_, _, counted, err := st.BucketQuota(record[0])
+		if err != nil {
+			return err
+		}
+		if counted && !all {
+			continue
+		}
+		if err := RecountUsage(st, record[0]); err != nil {
+			return err
+		}
+		fmt.Printf("Counted the usage of bucket %s\n", record[0])
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package objects
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"triple-s/storage"
+)
+
+// ErrInvalidRange is returned when none of the requested ranges overlap the object.
+var ErrInvalidRange = &storage.Error{Code: "InvalidRange", Message: "The requested range is not satisfiable", StatusCode: http.StatusRequestedRangeNotSatisfiable}
+
+// byteRange is a span of an object selected by a Range header.
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+// contentRange formats the range for a Content-Range header.
+func (br byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", br.start, br.start+br.length-1, size)
+}
+
+// parseRange parses a Range header such as "bytes=0-99,-500" against an object
+// of the given size. It returns nil when the header is absent or malformed, in
+// which case the whole object is served, and ErrInvalidRange when no range can
+// be satisfied. Ranges: https://www.rfc-editor.org/rfc/rfc9110#section-14.1.2
+func parseRange(header string, size int64) ([]byteRange, error) {
+	specs, found := strings.CutPrefix(header, "bytes=")
+	if !found {
+		return nil, nil
+	}
+
+	var ranges []byteRange
+	for _, spec := range strings.Split(specs, ",") {
+		first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+		if !found {
+			return nil, nil
+		}
+
+		var br byteRange
+		if first == "" {
+			// Suffix range: the last N bytes.
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, nil
+			}
+			if n > size {
+				n = size
+			}
+			if n == 0 {
+				// Nothing of an empty object can be selected
+				continue
+			}
+			br = byteRange{start: size - n, length: n}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, nil
+			}
+			end := size - 1
+			if last != "" {
+				if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+					return nil, nil
+				}
+				if end >= size {
+					end = size - 1
+				}
+			}
+			if start >= size {
+				continue
+			}
+			br = byteRange{start: start, length: end - start + 1}
+		}
+		ranges = append(ranges, br)
+	}
+
+	if len(ranges) == 0 {
+		return nil, ErrInvalidRange
+	}
+	return ranges, nil
+}
@@ -0,0 +1,122 @@
+package objects
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header string
+		size   int64
+		want   []byteRange
+		err    error
+	}{
+		{"", 10, nil, nil},
+		{"bytes=0-4", 10, []byteRange{{0, 5}}, nil},
+		{"bytes=5-", 10, []byteRange{{5, 5}}, nil},
+		{"bytes=9-9", 10, []byteRange{{9, 1}}, nil},
+		{"bytes=-3", 10, []byteRange{{7, 3}}, nil},
+		{"bytes=0-0,-1", 10, []byteRange{{0, 1}, {9, 1}}, nil},
+		{"bytes= 0-1 , 4-5", 10, []byteRange{{0, 2}, {4, 2}}, nil},
+
+		// Ranges reaching past the end are cut at the end
+		{"bytes=5-100", 10, []byteRange{{5, 5}}, nil},
+		{"bytes=-100", 10, []byteRange{{0, 10}}, nil},
+
+		// Unsatisfiable ranges are left out, or fail when none is left
+		{"bytes=10-", 10, nil, ErrInvalidRange},
+		{"bytes=10-20", 10, nil, ErrInvalidRange},
+		{"bytes=-0", 10, nil, ErrInvalidRange},
+		{"bytes=0-", 0, nil, ErrInvalidRange},
+		{"bytes=-5", 0, nil, ErrInvalidRange},
+		{"bytes=20-30,2-3", 10, []byteRange{{2, 2}}, nil},
+
+		// Malformed headers select the whole object
+		{"items=0-4", 10, nil, nil},
+		{"bytes=4", 10, nil, nil},
+		{"bytes=5-4", 10, nil, nil},
+		{"bytes=a-4", 10, nil, nil},
+		{"bytes=--4", 10, nil, nil},
+		{"bytes=0-4,x", 10, nil, nil},
+	}
+	for _, tt := range tests {
+		got, err := parseRange(tt.header, tt.size)
+		if err != tt.err || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseRange(%q, %d) = %v, %v; want %v, %v", tt.header, tt.size, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestGetObjectRange(t *testing.T) {
+	st := newTestStore(t)
+	if _, err := putObject(t, st, "key", "0123456789"); err != nil {
+		t.Fatal(err)
+	}
+	get := func(method, header string) (*httptest.ResponseRecorder, error) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, "/bucket/key", nil)
+		r.Header.Set("Range", header)
+		return w, GetObject(st, "bucket", "key", "", w, r)
+	}
+
+	for _, tt := range []struct {
+		header, contentRange, body string
+	}{
+		{"bytes=2-4", "bytes 2-4/10", "234"},
+		{"bytes=-3", "bytes 7-9/10", "789"},
+		{"bytes=8-100", "bytes 8-9/10", "89"},
+	} {
+		w, err := get(http.MethodGet, tt.header)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.header, err)
+		}
+		if w.Code != http.StatusPartialContent || w.Header().Get("Content-Range") != tt.contentRange || w.Body.String() != tt.body {
+			t.Errorf("%s: %d %q %q, want 206 %q %q", tt.header, w.Code, w.Header().Get("Content-Range"), w.Body.String(), tt.contentRange, tt.body)
+		}
+		if w.Header().Get("Content-Length") != strconv.Itoa(len(tt.body)) {
+			t.Errorf("%s: Content-Length %s", tt.header, w.Header().Get("Content-Length"))
+		}
+	}
+
+	w, err := get(http.MethodGet, "bytes=10-")
+	if err != ErrInvalidRange || w.Header().Get("Content-Range") != "bytes */10" {
+		t.Errorf("unsatisfiable range: %v with Content-Range %q, want %v with %q", err, w.Header().Get("Content-Range"), ErrInvalidRange, "bytes */10")
+	}
+
+	w, err = get(http.MethodHead, "bytes=0-1")
+	if err != nil || w.Code != http.StatusPartialContent || w.Body.Len() != 0 {
+		t.Errorf("HEAD with a range: %v %d with %d bytes", err, w.Code, w.Body.Len())
+	}
+
+	w, err = get(http.MethodGet, "bytes=0-0,-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if mediaType != "multipart/byteranges" {
+		t.Fatalf("several ranges sent as %q", w.Header().Get("Content-Type"))
+	}
+	var parts []string
+	reader := multipart.NewReader(w.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(part)
+		parts = append(parts, part.Header.Get("Content-Range")+" "+string(data))
+	}
+	if want := []string{"bytes 0-0/10 0", "bytes 8-9/10 89"}; !reflect.DeepEqual(parts, want) {
+		t.Errorf("parts = %q, want %q", parts, want)
+	}
+}
@@ -0,0 +1,54 @@
+package objects
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"unicode/utf8"
+
+	"triple-s/storage"
+)
+
+// Object tags are sent URL-encoded in the x-amz-tagging header and kept in
+// the Metadata column under the header's name. They are not sent back as a
+// header; responses carry their count instead.
+const (
+	taggingKey     = "X-Amz-Tagging"
+	maxTags        = 10
+	maxTagKeyLen   = 128
+	maxTagValueLen = 256
+)
+
+var ErrInvalidTag = &storage.Error{Code: "InvalidTag", Message: "The TagValue you have provided is invalid", StatusCode: http.StatusBadRequest}
+
+// parseTagging validates the x-amz-tagging header and returns its tags.
+func parseTagging(header string) (url.Values, error) {
+	tags, err := url.ParseQuery(header)
+	if err != nil || len(tags) > maxTags {
+		return nil, ErrInvalidTag
+	}
+	for key, values := range tags {
+		if len(values) != 1 || key == "" || utf8.RuneCountInString(key) > maxTagKeyLen || utf8.RuneCountInString(values[0]) > maxTagValueLen {
+			return nil, ErrInvalidTag
+		}
+	}
+	return tags, nil
+}
+
+// objectTags returns the tags stored in the Metadata column of a version.
+func objectTags(metadata string) map[string]string {
+	values, _ := url.ParseQuery(metadata)
+	tags, _ := url.ParseQuery(values.Get(taggingKey))
+	result := make(map[string]string, len(tags))
+	for key := range tags {
+		result[key] = tags.Get(key)
+	}
+	return result
+}
+
+// setTaggingCountHeader reports how many tags the stored tagging holds.
+func setTaggingCountHeader(w http.ResponseWriter, tagging string) {
+	if tags, _ := url.ParseQuery(tagging); len(tags) > 0 {
+		w.Header().Set("x-amz-tagging-count", strconv.Itoa(len(tags)))
+	}
+}
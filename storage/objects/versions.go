@@ -0,0 +1,199 @@
+package objects
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"triple-s/storage"
+)
+
+var (
+	ErrNoSuchKey     = &storage.Error{Code: "NoSuchKey", Message: "The specified key does not exist.", StatusCode: http.StatusNotFound}
+	ErrNoSuchVersion = &storage.Error{Code: "NoSuchVersion", Message: "The specified version does not exist.", StatusCode: http.StatusNotFound}
+	ErrDeleteMarker  = &storage.Error{Code: "MethodNotAllowed", Message: "The specified method is not allowed against this resource.", StatusCode: http.StatusMethodNotAllowed}
+)
+
+// objectName returns the data name of the current version of an object.
+func objectName(st *storage.Store, bucketName, objectKey string) string {
+	return st.Layout.ObjectName(bucketName, objectKey)
+}
+
+// versionName returns the data name of a noncurrent version of an object.
+func versionName(st *storage.Store, bucketName, objectKey, versionID string) string {
+	return st.Layout.VersionName(bucketName, objectKey, versionID)
+}
+
+// dataName returns the data name of a version row in the given layout.
+func dataName(layout storage.Layout, record []string) string {
+	if record[colIsLatest] == "true" {
+		return layout.ObjectName(record[colBucket], record[colKey])
+	}
+	return layout.VersionName(record[colBucket], record[colKey], record[colVersionID])
+}
+
+// newVersionID returns a random, opaque version ID.
+func newVersionID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// findVersion returns the row of versionID among the versions of an object,
+// or of the latest version when versionID is empty. It returns nil when there
+// is no such row.
+func findVersion(versions [][]string, versionID string) []string {
+	for i := len(versions) - 1; i >= 0; i-- {
+		record := versions[i]
+		if (versionID == "" && record[colIsLatest] == "true") || record[colVersionID] == versionID {
+			return record
+		}
+	}
+	return nil
+}
+
+// DeleteResult describes the outcome of a DeleteObject call.
+type DeleteResult struct {
+	VersionID    string
+	DeleteMarker bool
+}
+
+// DeleteObject removes an object. Without a versionID, a bucket with
+// versioning configured keeps the data and gets a delete marker instead;
+// with one, that version is removed permanently. The write preconditions of
+// r are checked against the current version.
+func DeleteObject(st *storage.Store, bucketName, objectKey, versionID string, r *http.Request) (DeleteResult, error) {
+	unlock := st.LockBucket(bucketName)
+	defer unlock()
+
+	if err := requireBucket(st, bucketName); err != nil {
+		return DeleteResult{}, err
+	}
+	return deleteObject(st, bucketName, objectKey, versionID, r)
+}
+
+// deleteObject does the work of DeleteObject. The caller holds the bucket's
+// lock; r may be nil for deletes without preconditions.
+func deleteObject(st *storage.Store, bucketName, objectKey, versionID string, r *http.Request) (DeleteResult, error) {
+	if err := finishPending(st, bucketName, objectKey); err != nil {
+		return DeleteResult{}, err
+	}
+	if r != nil {
+		versions, err := readVersions(st, bucketName, objectKey)
+		if err != nil {
+			return DeleteResult{}, err
+		}
+		if err := checkWritePreconditions(r, versions); err != nil {
+			return DeleteResult{}, err
+		}
+	}
+	if versionID != "" {
+		return deleteVersion(st, bucketName, objectKey, versionID)
+	}
+
+	status, err := st.BucketVersioning(bucketName)
+	if err != nil {
+		return DeleteResult{}, err
+	}
+	if status == "" {
+		// Deleting a key that does not exist succeeds, as in S3
+		_, err := deleteVersion(st, bucketName, objectKey, storage.NullVersionID)
+		if errors.Is(err, ErrNoSuchVersion) {
+			err = nil
+		}
+		return DeleteResult{}, err
+	}
+
+	c, _, err := planVersion(st, bucketName, objectKey, nil)
+	if err != nil {
+		return DeleteResult{}, err
+	}
+	c.Record = []string{bucketName, objectKey, "", "0", time.Now().Format(time.RFC3339), c.VersionID, "true", "true", "", ""}
+	if err := runCommit(st, c); err != nil {
+		return DeleteResult{}, err
+	}
+	return DeleteResult{VersionID: c.VersionID, DeleteMarker: true}, nil
+}
+
+// deleteVersion permanently removes one version of an object. When it was the
+// latest version, the newest remaining one becomes current again.
+func deleteVersion(st *storage.Store, bucketName, objectKey, versionID string) (DeleteResult, error) {
+	records, err := readVersions(st, bucketName, objectKey)
+	if err != nil {
+		return DeleteResult{}, err
+	}
+	record := findVersion(records, versionID)
+	if record == nil {
+		return DeleteResult{}, ErrNoSuchVersion
+	}
+
+	c := &commit{Bucket: bucketName, Key: objectKey, VersionID: versionID, Record: record, Remove: true}
+	if record[colIsLatest] == "true" {
+		var promoted []string
+		for _, existing := range records {
+			if existing[colVersionID] != versionID {
+				promoted = existing
+			}
+		}
+		if promoted != nil && promoted[colDeleteMarker] != "true" {
+			c.Promote = promoted[colVersionID]
+		}
+	}
+	if err := runCommit(st, c); err != nil {
+		return DeleteResult{}, err
+	}
+	return DeleteResult{VersionID: versionID, DeleteMarker: record[colDeleteMarker] == "true"}, nil
+}
+
+// ListObjectVersions lists every version and delete marker whose key starts
+// with prefix, ordered by key and then from newest to oldest.
+func ListObjectVersions(st *storage.Store, bucketName, prefix string) (*ListVersionsResult, error) {
+	if err := requireBucket(st, bucketName); err != nil {
+		return nil, err
+	}
+
+	var matched [][]string
+	err := st.Meta.Scan(bucketName, prefix, func(key string, versions [][]string) bool {
+		if !strings.HasPrefix(key, prefix) {
+			return false
+		}
+		for i := len(versions) - 1; i >= 0; i-- {
+			matched = append(matched, versions[i])
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ListVersionsResult{Xmlns: storage.XMLNamespace, Name: bucketName, Prefix: prefix}
+	for _, record := range matched {
+		lastModified, _ := time.Parse(time.RFC3339, record[colLastModified])
+		if record[colDeleteMarker] == "true" {
+			result.Versions = append(result.Versions, DeleteMarkerEntry{
+				Key:          record[colKey],
+				VersionID:    record[colVersionID],
+				IsLatest:     record[colIsLatest] == "true",
+				LastModified: lastModified,
+			})
+			continue
+		}
+		size, _ := strconv.ParseInt(record[colSize], 10, 64)
+		result.Versions = append(result.Versions, ObjectVersion{
+			Key:          record[colKey],
+			VersionID:    record[colVersionID],
+			IsLatest:     record[colIsLatest] == "true",
+			LastModified: lastModified,
+			ETag:         quoteETag(record[colETag]),
+			Size:         size,
+			StorageClass: "STANDARD",
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,28 @@
+package objects
+
+import (
+	"testing"
+	"time"
+
+	"triple-s/storage"
+)
+
+func TestDeleteMissingKeySucceeds(t *testing.T) {
+	st := newTestStore(t)
+	if err := st.Meta.PutBucket(storage.NewBucketRow("plain", time.Now().Format(time.RFC3339))); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := DeleteObject(st, "plain", "missing", "", nil)
+	if err != nil {
+		t.Fatalf("DELETE of a missing key: %v", err)
+	}
+	if result != (DeleteResult{}) {
+		t.Errorf("DELETE of a missing key = %+v, want an empty result", result)
+	}
+
+	// A version that does not exist is still reported
+	if _, err := DeleteObject(st, "plain", "missing", "v1", nil); err != ErrNoSuchVersion {
+		t.Errorf("DELETE of a missing version: got %v, want %v", err, ErrNoSuchVersion)
+	}
+}
@@ -0,0 +1,312 @@
+// Package sse encrypts object data at rest. Every object version has its own
+// random data key, sealed by a key-encryption key: the server's master key
+// for SSE-S3, the client's key for SSE-C.
+//
+// Data is encrypted as one or more streams stored one after the other, one
+// per multipart upload part. A stream starts with a random nonce prefix and
+// holds chunks of ChunkSize plaintext bytes, the last one shorter, each
+// sealed with AES-256-GCM. The nonce of a chunk is the prefix, its index and
+// a flag set on the last chunk, so chunks cannot be reordered, dropped or
+// cut off unnoticed, and any chunk can be decrypted alone, which is what
+// range reads need.
+package sse
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// KeySize is the size of master, customer and data keys: AES-256.
+const KeySize = 32
+
+// ChunkSize is the plaintext size of every chunk of a stream but the last.
+const ChunkSize = 64 << 10
+
+const (
+	prefixSize = 8
+	tagSize    = 16
+	lastChunk  = 1 << 31 // flag in the chunk index of a nonce
+)
+
+// ErrDecrypt is returned for data or sealed keys that fail authentication,
+// whether tampered with or opened with the wrong key.
+var ErrDecrypt = errors.New("sse: message authentication failed")
+
+// LoadKey reads a master key file holding 32 raw bytes, or the key in hex or
+// base64.
+func LoadKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == KeySize {
+		return data, nil
+	}
+	text := string(bytes.TrimSpace(data))
+	if key, err := hex.DecodeString(text); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%s does not hold a %d-byte key in raw, hex or base64 form", path, KeySize)
+}
+
+// NewDataKey returns a random data key.
+func NewDataKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Seal encrypts a data key with a key-encryption key, for keeping it in the
+// object metadata.
+func Seal(kek, dataKey []byte) (string, error) {
+	aead, err := newAEAD(kek)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, dataKey, nil)), nil
+}
+
+// Unseal returns the data key Seal encrypted with kek.
+func Unseal(kek []byte, sealed string) ([]byte, error) {
+	aead, err := newAEAD(kek)
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	dataKey, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return dataKey, nil
+}
+
+// EncryptedSize returns the size of the stream encrypting size bytes.
+func EncryptedSize(size int64) int64 {
+	chunks := (size + ChunkSize - 1) / ChunkSize
+	if chunks == 0 {
+		chunks = 1 // an empty stream still has its last chunk
+	}
+	return prefixSize + size + chunks*tagSize
+}
+
+// DecryptedSize returns the plaintext size of a stream of size bytes.
+func DecryptedSize(size int64) (int64, error) {
+	body := size - prefixSize
+	if body < tagSize {
+		return 0, ErrDecrypt
+	}
+	chunks := (body + ChunkSize + tagSize - 1) / (ChunkSize + tagSize)
+	plain := body - chunks*tagSize
+	if EncryptedSize(plain) != size {
+		return 0, ErrDecrypt
+	}
+	return plain, nil
+}
+
+func chunkNonce(prefix []byte, index uint32, last bool) []byte {
+	nonce := make([]byte, prefixSize+4)
+	copy(nonce, prefix)
+	if last {
+		index |= lastChunk
+	}
+	binary.BigEndian.PutUint32(nonce[prefixSize:], index)
+	return nonce
+}
+
+// encrypter reads plaintext from src and returns the stream encrypting it.
+type encrypter struct {
+	src    io.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	index  uint32
+	buf    []byte // one chunk and the first byte of the next
+	carry  int    // bytes of the next chunk already in buf
+	out    []byte // encrypted bytes not read yet
+	done   bool
+}
+
+// NewEncrypter returns a reader of the stream encrypting src with dataKey.
+func NewEncrypter(dataKey []byte, src io.Reader) (io.Reader, error) {
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, prefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	return &encrypter{src: src, aead: aead, prefix: prefix, buf: make([]byte, ChunkSize+1), out: prefix}, nil
+}
+
+func (e *encrypter) Read(p []byte) (int, error) {
+	for len(e.out) == 0 {
+		if e.done {
+			return 0, io.EOF
+		}
+		if err := e.sealChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
+
+// sealChunk encrypts the next chunk. Reading one byte past it tells whether
+// it is the last.
+func (e *encrypter) sealChunk() error {
+	n, err := io.ReadFull(e.src, e.buf[e.carry:])
+	n += e.carry
+	last := err == io.EOF || err == io.ErrUnexpectedEOF
+	if err != nil && !last {
+		return err
+	}
+	if e.index >= lastChunk {
+		return errors.New("sse: stream too long")
+	}
+
+	size := n
+	if !last {
+		size = ChunkSize
+	}
+	e.out = e.aead.Seal(nil, chunkNonce(e.prefix, e.index, last), e.buf[:size], nil)
+	e.index++
+	e.done = last
+	if !last {
+		e.buf[0] = e.buf[ChunkSize]
+		e.carry = 1
+	}
+	return nil
+}
+
+// stream is one encrypted stream within the data of an object.
+type stream struct {
+	start  int64 // plaintext offset
+	offset int64 // offset of its nonce prefix in the data
+	size   int64 // plaintext size
+	prefix []byte
+}
+
+// Reader decrypts the data of an object for reading at any offset.
+type Reader struct {
+	src     io.ReaderAt
+	aead    cipher.AEAD
+	streams []stream
+	size    int64
+
+	mu        sync.Mutex
+	cached    []byte // the plaintext of the last chunk read
+	cachedAt  int64  // its plaintext offset
+	cachedSet bool
+}
+
+// NewReader returns a Reader of the streams stored one after the other in
+// src, given their plaintext sizes. It reads nothing until ReadAt is called.
+func NewReader(dataKey []byte, src io.ReaderAt, sizes []int64) (*Reader, error) {
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	r := &Reader{src: src, aead: aead}
+	var offset int64
+	for _, size := range sizes {
+		r.streams = append(r.streams, stream{start: r.size, offset: offset, size: size})
+		r.size += size
+		offset += EncryptedSize(size)
+	}
+	return r, nil
+}
+
+// Size returns the plaintext size.
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+// ReadAt reads plaintext at off, decrypting the chunks it spans.
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if off < 0 {
+		return 0, errors.New("sse: negative offset")
+	}
+	n := 0
+	for n < len(p) {
+		if off >= r.size {
+			return n, io.EOF
+		}
+		if !r.cachedSet || off < r.cachedAt || off >= r.cachedAt+int64(len(r.cached)) {
+			if err := r.loadChunk(off); err != nil {
+				return n, err
+			}
+		}
+		copied := copy(p[n:], r.cached[off-r.cachedAt:])
+		n += copied
+		off += int64(copied)
+	}
+	return n, nil
+}
+
+// loadChunk decrypts the chunk holding the plaintext offset off into the cache.
+func (r *Reader) loadChunk(off int64) error {
+	i := len(r.streams) - 1
+	for i > 0 && r.streams[i].start > off {
+		i--
+	}
+	s := &r.streams[i]
+	if s.prefix == nil {
+		prefix := make([]byte, prefixSize)
+		if _, err := r.src.ReadAt(prefix, s.offset); err != nil {
+			return fmt.Errorf("sse: reading stream header: %w", err)
+		}
+		s.prefix = prefix
+	}
+
+	index := (off - s.start) / ChunkSize
+	size := s.size - index*ChunkSize
+	if size > ChunkSize {
+		size = ChunkSize
+	}
+	last := index*ChunkSize+size == s.size
+
+	sealed := make([]byte, size+tagSize)
+	if _, err := r.src.ReadAt(sealed, s.offset+prefixSize+index*(ChunkSize+tagSize)); err != nil && err != io.EOF {
+		return fmt.Errorf("sse: reading chunk: %w", err)
+	}
+	plain, err := r.aead.Open(sealed[:0], chunkNonce(s.prefix, uint32(index), last), sealed, nil)
+	if err != nil {
+		return ErrDecrypt
+	}
+	r.cached, r.cachedAt, r.cachedSet = plain, s.start+index*ChunkSize, true
+	return nil
+}
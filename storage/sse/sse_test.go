@@ -0,0 +1,200 @@
+package sse
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testKey(seed byte) []byte {
+	return bytes.Repeat([]byte{seed}, KeySize)
+}
+
+func plaintext(size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(data)
+	return data
+}
+
+func encrypt(t *testing.T, key, plain []byte) []byte {
+	t.Helper()
+	r, err := NewEncrypter(key, bytes.NewReader(plain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sealed
+}
+
+// decrypt reads all of the streams in sealed with a Reader.
+func decrypt(key, sealed []byte, sizes ...int64) ([]byte, error) {
+	r, err := NewReader(key, bytes.NewReader(sealed), sizes)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+}
+
+var sizes = []int{0, 1, 100, ChunkSize - 1, ChunkSize, ChunkSize + 1, 3*ChunkSize + 5}
+
+func TestRoundTrip(t *testing.T) {
+	key := testKey(1)
+	for _, size := range sizes {
+		plain := plaintext(size)
+		sealed := encrypt(t, key, plain)
+		if int64(len(sealed)) != EncryptedSize(int64(size)) {
+			t.Errorf("size %d: encrypted to %d bytes, EncryptedSize says %d", size, len(sealed), EncryptedSize(int64(size)))
+		}
+		if got, err := DecryptedSize(int64(len(sealed))); err != nil || got != int64(size) {
+			t.Errorf("size %d: DecryptedSize = %d, %v", size, got, err)
+		}
+		if got, err := decrypt(key, sealed, int64(size)); err != nil || !bytes.Equal(got, plain) {
+			t.Errorf("size %d: decrypted %d bytes, %v", size, len(got), err)
+		}
+	}
+}
+
+func TestReadAt(t *testing.T) {
+	key := testKey(1)
+	plain := plaintext(3*ChunkSize + 5)
+	r, err := NewReader(key, bytes.NewReader(encrypt(t, key, plain)), []int64{int64(len(plain))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct{ off, n int }{
+		{0, 10},
+		{ChunkSize - 3, 6},     // across a chunk boundary
+		{ChunkSize, ChunkSize}, // a whole chunk
+		{10, 2*ChunkSize + 100},
+		{len(plain) - 5, 5},
+		{5, 1},
+	} {
+		buf := make([]byte, tt.n)
+		if n, err := r.ReadAt(buf, int64(tt.off)); err != nil || n != tt.n || !bytes.Equal(buf, plain[tt.off:tt.off+tt.n]) {
+			t.Errorf("ReadAt(%d bytes at %d) = %d, %v", tt.n, tt.off, n, err)
+		}
+	}
+	buf := make([]byte, 10)
+	if n, err := r.ReadAt(buf, int64(len(plain)-4)); err != io.EOF || n != 4 {
+		t.Errorf("ReadAt past the end = %d, %v, want 4, EOF", n, err)
+	}
+}
+
+// TestStreams reads data made of several streams, as multipart uploads store it.
+func TestStreams(t *testing.T) {
+	key := testKey(1)
+	var plain, sealed []byte
+	var partSizes []int64
+	for _, size := range []int{ChunkSize + 7, 0, 3, 2 * ChunkSize} {
+		part := plaintext(size)
+		plain = append(plain, part...)
+		sealed = append(sealed, encrypt(t, key, part)...)
+		partSizes = append(partSizes, int64(size))
+	}
+	if got, err := decrypt(key, sealed, partSizes...); err != nil || !bytes.Equal(got, plain) {
+		t.Errorf("decrypted %d of %d bytes: %v", len(got), len(plain), err)
+	}
+}
+
+func TestTamperDetected(t *testing.T) {
+	key := testKey(1)
+	plain := plaintext(3*ChunkSize + 5)
+	sealed := encrypt(t, key, plain)
+	chunk := ChunkSize + tagSize
+	size := int64(len(plain))
+
+	flipped := append([]byte(nil), sealed...)
+	flipped[prefixSize+chunk+10] ^= 1
+
+	swapped := append([]byte(nil), sealed...)
+	copy(swapped[prefixSize:], sealed[prefixSize+chunk:prefixSize+2*chunk])
+	copy(swapped[prefixSize+chunk:], sealed[prefixSize:prefixSize+chunk])
+
+	// Cut off after whole chunks, so the sizes still add up
+	cut := sealed[:prefixSize+2*chunk]
+
+	tests := []struct {
+		name   string
+		key    []byte
+		sealed []byte
+		size   int64
+	}{
+		{"wrong key", testKey(2), sealed, size},
+		{"flipped bit", key, flipped, size},
+		{"swapped chunks", key, swapped, size},
+		{"cut off", key, cut, 2 * ChunkSize},
+		{"other prefix", key, append(bytes.Repeat([]byte{0}, prefixSize), sealed[prefixSize:]...), size},
+	}
+	for _, tt := range tests {
+		if _, err := decrypt(tt.key, tt.sealed, tt.size); err != ErrDecrypt {
+			t.Errorf("%s: got %v, want %v", tt.name, err, ErrDecrypt)
+		}
+	}
+
+	for _, n := range []int64{0, prefixSize + tagSize - 1, prefixSize + int64(chunk) + 5} {
+		if _, err := DecryptedSize(n); err != ErrDecrypt {
+			t.Errorf("DecryptedSize(%d) = %v, want %v", n, err, ErrDecrypt)
+		}
+	}
+}
+
+func TestSealUnseal(t *testing.T) {
+	dataKey, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := Seal(testKey(1), dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Unseal(testKey(1), sealed); err != nil || !bytes.Equal(got, dataKey) {
+		t.Errorf("Unseal = %x, %v", got, err)
+	}
+	for _, tt := range []struct {
+		name   string
+		kek    []byte
+		sealed string
+	}{
+		{"wrong key", testKey(2), sealed},
+		{"not base64", testKey(1), "!"},
+		{"too short", testKey(1), base64.StdEncoding.EncodeToString([]byte("short"))},
+	} {
+		if _, err := Unseal(tt.kek, tt.sealed); err != ErrDecrypt {
+			t.Errorf("%s: got %v, want %v", tt.name, err, ErrDecrypt)
+		}
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	dir := t.TempDir()
+	key := testKey(7)
+	for name, content := range map[string][]byte{
+		"raw":    key,
+		"hex":    []byte(hex.EncodeToString(key) + "\n"),
+		"base64": []byte(base64.StdEncoding.EncodeToString(key) + "\n"),
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := LoadKey(path); err != nil || !bytes.Equal(got, key) {
+			t.Errorf("%s: LoadKey = %x, %v", name, got, err)
+		}
+	}
+
+	path := filepath.Join(dir, "short")
+	if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key[:16])), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadKey(path); err == nil {
+		t.Error("LoadKey of a 16-byte key succeeded")
+	}
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"triple-s/storage/backend"
+)
+
+// TempDirName is the prefix of the data names where writes are staged before
+// they are moved into place. On disk it is a directory of the storage root,
+// on the same file system as the buckets.
+const TempDirName = ".tmp"
+
+// TempName returns a new, unused name in the staging area.
+func TempName(prefix string) string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return TempDirName + "/" + prefix + hex.EncodeToString(id)
+}
+
+// SetPendingCommit records intent as the commit of an object write that
+// failed part way. Until it is cleared, the next write of the object has to
+// finish it first.
+func (s *Store) SetPendingCommit(bucketName, key, intent string) {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	s.pending[bucketName+"/"+key] = intent
+}
+
+// PendingCommit returns the intent of the failed commit of an object, or an
+// empty string.
+func (s *Store) PendingCommit(bucketName, key string) string {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	return s.pending[bucketName+"/"+key]
+}
+
+// ClearPendingCommit forgets the failed commit of an object once finished.
+func (s *Store) ClearPendingCommit(bucketName, key string) {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	delete(s.pending, bucketName+"/"+key)
+}
+
+// CleanTemp removes the data left behind by writes that were interrupted,
+// including the in-bucket temp files of older releases.
+func (s *Store) CleanTemp() error {
+	var leftovers []string
+	err := s.Data.List(TempDirName+"/", func(name string, _ backend.Info) bool {
+		leftovers = append(leftovers, name)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range leftovers {
+		if err := s.Data.Delete(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	if s.Dir == "" {
+		return nil
+	}
+	patterns := []string{
+		filepath.Join(s.Dir, "*", ".*.tmp"),
+		filepath.Join(s.Dir, "*", UploadsDir, "*", "*.tmp"),
+		filepath.Join(s.Dir, ".*.tmp"),
+		filepath.Join(s.Dir, JournalName+"-*.tmp"),
+		filepath.Join(s.Dir, BTreeName+".compact"),
+	}
+	for _, pattern := range patterns {
+		matches, _ := filepath.Glob(pattern)
+		for _, leftover := range matches {
+			if err := os.Remove(leftover); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -1,83 +1,52 @@
 package storage
 
-import (
-	"encoding/csv"
-	"errors"
-	"os"
-	"path/filepath"
-)
+import "errors"
+
+// UploadsDir is the directory inside a bucket where multipart uploads are staged.
+const UploadsDir = ".uploads"
 
-var (
-	ErrBucketExists = errors.New("bucket already exists")
-	ErrObjectExists = errors.New("object already exists")
+var ErrObjectExists = errors.New("object already exists")
+
+// Columns of an object row read here, those of csvmeta.ObjectHeaders.
+const (
+	objectColIsLatest     = 6
+	objectColDeleteMarker = 7
 )
 
 // BucketExists checks if a bucket with the given name exists.
-func BucketExists(name string) (bool, error) {
-	// Open the bucket file for reading
-	file, err := os.Open(BucketFile)
-	if err != nil {
-		return false, err
-	}
-	defer file.Close()
-
-	// Read all records from the CSV file
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+func (s *Store) BucketExists(name string) (bool, error) {
+	row, ok, err := s.Meta.Bucket(name)
 	if err != nil {
 		return false, err
 	}
-
-	// Check if the specified bucket name exists in the records
-	for _, record := range records {
-		if record[0] == name && record[3] != "Deleted" {
-			return true, nil
-		}
-	}
-	return false, nil
+	return ok && bucketField(row, bucketColStatus) != "Deleted", nil
 }
 
-// IsBucketEmpty checks if the bucket has any objects other than 'objects.csv'.
-func IsBucketEmpty(bucketName string) bool {
-	bucketDir := filepath.Join(StorageDir, bucketName)
-
-	files, err := os.ReadDir(bucketDir)
-	if err != nil {
+// IsBucketEmpty checks if the metadata of the bucket holds any object.
+// Noncurrent versions and delete markers count; multipart uploads in
+// progress do not.
+func (s *Store) IsBucketEmpty(bucketName string) bool {
+	empty := true
+	err := s.Meta.Scan(bucketName, "", func(string, [][]string) bool {
+		empty = false
 		return false
-	}
-
-	if len(files) == 0 {
-		return true
-	}
-
-	if len(files) == 1 && files[0].Name() == "objects.csv" {
-		return true
-	}
-
-	return false
+	})
+	return err == nil && empty
 }
 
 // ObjectExists checks if an object with the given key in the specified bucket exists.
-func ObjectExists(bucketName, key string) (bool, error) {
-	objectFile := filepath.Join(StorageDir, bucketName, "objects.csv")
-
-	// Open the object file for reading
-	file, err := os.Open(objectFile)
-	if err != nil {
-		return false, err
-	}
-	defer file.Close()
-
-	// Read all records from the CSV file
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+func (s *Store) ObjectExists(bucketName, key string) (bool, error) {
+	versions, err := s.Meta.Versions(bucketName, key)
 	if err != nil {
 		return false, err
 	}
 
-	// Check if the specified object exists in the records
-	for _, record := range records {
-		if record[0] == bucketName && record[1] == key {
+	// Only the latest version counts, and not when it is a delete marker.
+	for _, record := range versions {
+		if len(record) <= objectColDeleteMarker {
+			continue
+		}
+		if record[objectColIsLatest] == "true" && record[objectColDeleteMarker] != "true" {
 			return true, nil
 		}
 	}
@@ -0,0 +1,29 @@
+package storage
+
+// Bucket versioning states. A bucket that never had versioning configured
+// has an empty state.
+const (
+	VersioningEnabled   = "Enabled"
+	VersioningSuspended = "Suspended"
+)
+
+// NullVersionID is the version ID of objects written while versioning is off.
+const NullVersionID = "null"
+
+// VersionsDir is the directory inside a bucket holding noncurrent object versions.
+const VersionsDir = ".versions"
+
+// BucketVersioning returns the versioning state of a bucket.
+func (s *Store) BucketVersioning(name string) (string, error) {
+	row, ok, err := s.Meta.Bucket(name)
+	if err != nil || !ok {
+		return "", err
+	}
+	return bucketField(row, bucketColVersioning), nil
+}
+
+// SetRowVersioning records the versioning state in a bucket row padded by
+// PadBucketRow.
+func SetRowVersioning(row []string, status string) {
+	row[bucketColVersioning] = status
+}
@@ -6,5 +6,18 @@ func PrintUsage() {
 	fmt.Println("Usage:")
 	fmt.Println("  --port N       Port number (default :8080)")
 	fmt.Println("  --dir S       Path to the storage directory (default ./storage)")
+	fmt.Println("  --credentials S  CSV file of access keys (AccessKeyID,SecretAccessKey); enables SigV4 checks")
+	fmt.Println("  --admin-key S  Access key allowed to administer bucket quotas under /_admin/quota;")
+	fmt.Println("                without credentials every request may")
+	fmt.Println("  --backend S   Object data store: fs (default) or memory")
+	fmt.Println("  --meta-backend S  Metadata store: journal (default), btree, csv or memory")
+	fmt.Println("                (default memory with --backend=memory)")
+	fmt.Println("  --layout S    Object data layout: sharded (default) or flat; existing data is moved")
+	fmt.Println("  --lifecycle-interval D  How often bucket lifecycle rules run (default 1h; negative disables)")
+	fmt.Println("  --master-key S  File holding the 32-byte master key (raw, hex or base64) of SSE-S3")
+	fmt.Println("  --legacy-xml  List buckets and objects as BucketList and ObjectList")
 	fmt.Println("  --help        Show this screen.")
+	fmt.Println()
+	fmt.Println("  presign --credentials S --bucket B --key K [--method GET|PUT] [--ttl 15m] [--endpoint URL] [--access-key A]")
+	fmt.Println("                Print a presigned URL for an object.")
 }
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateObjectKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"key", true},
+		{"releases/v1.2/App.tar.gz", true},
+		{"été/日本語", true},
+		{"../a", true},
+		{strings.Repeat("a", 1024), true},
+		{"", false},
+		{strings.Repeat("a", 1025), false},
+		{"bad\xff", false},
+	}
+	for _, tt := range tests {
+		if got := ValidateObjectKey(tt.key); got != tt.want {
+			t.Errorf("ValidateObjectKey(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}